@@ -5,11 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/urfave/cli/v3"
 
+	"github.com/wharflab/container-source-policy/internal/config"
 	"github.com/wharflab/container-source-policy/internal/pin"
+	"github.com/wharflab/container-source-policy/internal/registry"
 )
 
 func pinCommand() *cli.Command {
@@ -24,7 +29,82 @@ current digest.
 Example:
   container-source-policy pin --output policy.json Dockerfile
   container-source-policy pin --stdout Dockerfile.* > policy.json
-  cat Dockerfile | container-source-policy pin --stdout -`,
+  cat Dockerfile | container-source-policy pin --stdout -
+  container-source-policy pin --build-context base=oci-layout://./layout:v1 --stdout Dockerfile`,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "build-context",
+				Usage: "named build context as passed to buildx (name=value); oci-layout:// contexts are pinned from the local index.json",
+			},
+			&cli.StringFlag{
+				Name:  "report",
+				Usage: "write a JSON report of pinned sources (aliases, warnings) to this file",
+			},
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "TOML configuration file (per-remote git signing keys, ...)",
+			},
+			&cli.BoolFlag{
+				Name:  "verify-git-signatures",
+				Usage: "refuse to pin git sources whose tag or commit is not signed by a key configured for the remote in --config",
+			},
+			&cli.BoolFlag{
+				Name: "archive-as-git",
+				Usage: "convert GitHub archive URLs (/archive/, codeload.github.com) to the git source of the same ref with git.checksum; " +
+					"the build then gets the repository tree instead of the archive file",
+			},
+			&cli.StringFlag{
+				Name:  "max-download-size",
+				Usage: "skip HTTP sources whose checksum needs downloading more than this (e.g., 500MB, 2GiB)",
+			},
+			&cli.StringFlag{
+				Name:  "download-budget",
+				Usage: "skip HTTP sources once this much has been downloaded for checksums in total (e.g., 10GB)",
+			},
+			&cli.DurationFlag{
+				Name:  "http-timeout",
+				Value: 5 * time.Minute,
+				Usage: "time limit for each HTTP checksum request, including the download",
+			},
+			&cli.DurationFlag{
+				Name:  "git-timeout",
+				Value: 30 * time.Second,
+				Usage: "time limit for each git network operation (listing refs, fetching objects)",
+			},
+			&cli.StringFlag{
+				Name:  "authfile",
+				Usage: "registry auth file (auth.json or Docker config.json) to use instead of the default ones (default: $REGISTRY_AUTH_FILE)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "creds",
+				Usage: "credentials for a registry as registry=username:password (repeatable); takes precedence over auth files",
+			},
+			&cli.BoolFlag{
+				Name:  "debug-auth",
+				Usage: "log which credential source is used for each registry (secrets are never printed)",
+			},
+			&cli.StringFlag{
+				Name:  "buildkitd-config",
+				Usage: "BuildKit's buildkitd.toml: resolve images through its registry mirrors and apply its http, insecure, ca and keypair settings",
+			},
+			&cli.StringFlag{
+				Name:  "cacert",
+				Usage: "PEM bundle of certificate authorities to trust in addition to the system roots, for HTTP, registry and git connections",
+			},
+			&cli.StringFlag{
+				Name:  "client-cert",
+				Usage: "PEM client certificate presented to servers that ask for one (requires --client-key)",
+			},
+			&cli.StringFlag{
+				Name:  "client-key",
+				Usage: "PEM private key of --client-cert",
+			},
+			&cli.StringFlag{
+				Name:  "git-backend",
+				Value: "auto",
+				Usage: "how to resolve git refs: cli (git ls-remote), native (built-in, no git binary needed), or auto (cli when git is installed)",
+			},
+		},
 		MutuallyExclusiveFlags: []cli.MutuallyExclusiveFlags{
 			{
 				Flags: [][]cli.Flag{
@@ -64,14 +144,63 @@ Example:
 				return errors.New("at least one Dockerfile path is required")
 			}
 
+			cfg, err := config.LoadOptional(cmd.String("config"))
+			if err != nil {
+				return err
+			}
+
+			var registryMirrors map[string][]string
+			if path := cmd.String("buildkitd-config"); path != "" {
+				buildkitd, err := config.LoadBuildkitd(path)
+				if err != nil {
+					return err
+				}
+				cfg.Network.MergeHosts(buildkitd.NetworkHosts()...)
+				registryMirrors = buildkitd.Mirrors()
+			}
+			if err := applyNetworkFlags(cmd, &cfg.Network); err != nil {
+				return err
+			}
+
+			maxDownloadSize, err := parseSize(cmd, "max-download-size")
+			if err != nil {
+				return err
+			}
+			downloadBudget, err := parseSize(cmd, "download-budget")
+			if err != nil {
+				return err
+			}
+
+			var registryCreds []registry.Credential
+			for _, value := range cmd.StringSlice("creds") {
+				cred, err := registry.ParseCredential(value)
+				if err != nil {
+					return err
+				}
+				registryCreds = append(registryCreds, cred)
+			}
+
 			opts := pin.Options{
-				Dockerfiles:     cmd.Args().Slice(),
-				PreferDHI:       cmd.Bool("prefer-dhi"),
-				PreferECRPublic: cmd.Bool("prefer-ecr-public"),
-				PreferMCR:       cmd.Bool("prefer-mcr"),
+				Dockerfiles:         cmd.Args().Slice(),
+				PreferDHI:           cmd.Bool("prefer-dhi"),
+				PreferECRPublic:     cmd.Bool("prefer-ecr-public"),
+				PreferMCR:           cmd.Bool("prefer-mcr"),
+				BuildContexts:       cmd.StringSlice("build-context"),
+				GitBackend:          cmd.String("git-backend"),
+				Config:              cfg,
+				VerifyGitSignatures: cmd.Bool("verify-git-signatures"),
+				ArchiveAsGit:        cmd.Bool("archive-as-git"),
+				MaxDownloadSize:     maxDownloadSize,
+				DownloadBudget:      downloadBudget,
+				HTTPTimeout:         cmd.Duration("http-timeout"),
+				GitTimeout:          cmd.Duration("git-timeout"),
+				AuthFile:            cmd.String("authfile"),
+				RegistryCredentials: registryCreds,
+				DebugAuth:           cmd.Bool("debug-auth"),
+				RegistryMirrors:     registryMirrors,
 			}
 
-			policy, err := pin.GeneratePolicy(ctx, opts)
+			result, err := pin.Generate(ctx, opts)
 			if err != nil {
 				return fmt.Errorf("failed to generate policy: %w", err)
 			}
@@ -91,11 +220,61 @@ Example:
 				w = f
 			}
 
-			if err := pin.WritePolicy(w, policy); err != nil {
+			if err := pin.WritePolicy(w, result.Policy); err != nil {
 				return fmt.Errorf("failed to write policy: %w", err)
 			}
 
+			if reportFile := cmd.String("report"); reportFile != "" {
+				if err := writeReportFile(reportFile, result.Report); err != nil {
+					return fmt.Errorf("failed to write report: %w", err)
+				}
+			}
+
 			return nil
 		},
 	}
 }
+
+func writeReportFile(path string, report *pin.Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pin.WriteReport(f, report); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// applyNetworkFlags overrides the [network] settings of the configuration file with --cacert, --client-cert
+// and --client-key
+func applyNetworkFlags(cmd *cli.Command, network *config.NetworkConfig) error {
+	if cacert := cmd.String("cacert"); cacert != "" {
+		network.CACert = cacert
+	}
+	cert, key := cmd.String("client-cert"), cmd.String("client-key")
+	if (cert == "") != (key == "") {
+		return errors.New("--client-cert and --client-key must be set together")
+	}
+	if cert != "" {
+		network.ClientCert, network.ClientKey = cert, key
+	}
+	return nil
+}
+
+// parseSize reads a size flag such as 500MB or 2GiB; unset means no limit (0)
+func parseSize(cmd *cli.Command, name string) (int64, error) {
+	value := cmd.String(name)
+	if value == "" {
+		return 0, nil
+	}
+	size, err := humanize.ParseBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --%s %q: %w", name, value, err)
+	}
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid --%s %q: too large", name, value)
+	}
+	return int64(size), nil
+}
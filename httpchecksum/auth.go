@@ -0,0 +1,223 @@
+package httpchecksum
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// Credential authenticates requests to one host.
+// Token is sent as a bearer token; otherwise Username and Password are sent with basic auth.
+type Credential struct {
+	Host     string
+	Username string
+	Password string
+	Token    string
+}
+
+// envTokens maps the environment variables read by default to the hosts their tokens are sent to
+var envTokens = []struct {
+	env   string
+	hosts []string
+}{
+	{env: "GITHUB_TOKEN", hosts: []string{"github.com", "raw.githubusercontent.com"}},
+	{env: "GITLAB_TOKEN", hosts: []string{"gitlab.com"}},
+}
+
+// WithCredentials authenticates requests to the given hosts.
+// Credentials are only sent after the host answers 401 or 403 (404 for GitHub and GitLab hosts) without them, they never
+// follow a redirect to another host, and they are not reported in ChecksumResult.Headers.
+// Later entries for the same host replace earlier ones (including GITHUB_TOKEN and GITLAB_TOKEN).
+func WithCredentials(creds ...Credential) Option {
+	return func(c *Client) {
+		if c.credentials == nil {
+			c.credentials = make(map[string]Credential)
+		}
+		for _, cred := range creds {
+			c.credentials[strings.ToLower(cred.Host)] = cred
+		}
+	}
+}
+
+// envCredentials returns the GITHUB_TOKEN and GITLAB_TOKEN credentials for their hosts
+func envCredentials() []Credential {
+	var creds []Credential
+	for _, entry := range envTokens {
+		token := os.Getenv(entry.env)
+		if token == "" {
+			continue
+		}
+		for _, host := range entry.hosts {
+			creds = append(creds, Credential{Host: host, Token: token})
+		}
+	}
+	return creds
+}
+
+// DefaultNetrcPath returns $NETRC, or ~/.netrc (~/_netrc on Windows)
+func DefaultNetrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	return filepath.Join(home, name)
+}
+
+// LoadNetrc reads the machine entries of a netrc file.
+// The default entry is ignored so that credentials are only ever sent to hosts named in the file.
+func LoadNetrc(path string) ([]Credential, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseNetrc(string(data))
+}
+
+// parseNetrc parses netrc(5) tokens: machine, default, login, password, account and macdef
+func parseNetrc(data string) ([]Credential, error) {
+	var creds []Credential
+	var current *Credential
+	inDefault, inMacro := false, false
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if inMacro {
+			// A macro definition runs until the next empty line
+			inMacro = len(fields) > 0
+			continue
+		}
+		if len(fields) > 0 && fields[0] == "macdef" {
+			inMacro = true
+			continue
+		}
+		for i := 0; i < len(fields); i++ {
+			if strings.HasPrefix(fields[i], "#") {
+				break
+			}
+			switch key := fields[i]; key {
+			case "machine":
+				if i+1 >= len(fields) {
+					return nil, fmt.Errorf("netrc: missing host after %q", key)
+				}
+				i++
+				creds = append(creds, Credential{Host: fields[i]})
+				current, inDefault = &creds[len(creds)-1], false
+			case "default":
+				current, inDefault = nil, true
+			case "login", "password", "account":
+				if i+1 >= len(fields) {
+					return nil, fmt.Errorf("netrc: missing value after %q", key)
+				}
+				i++
+				if current == nil {
+					if inDefault {
+						continue
+					}
+					return nil, fmt.Errorf("netrc: %q outside a machine entry", key)
+				}
+				switch key {
+				case "login":
+					current.Username = fields[i]
+				case "password":
+					current.Password = fields[i]
+				}
+			default:
+				return nil, fmt.Errorf("netrc: unexpected token %q", key)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// authTrackerKey is the context key of the per-lookup authTracker
+type authTrackerKey struct{}
+
+// authTracker records that the source URL of a lookup was only reachable with credentials
+// (requests for API endpoints, sidecar files and the like are ignored)
+type authTracker struct {
+	source string
+	used   atomic.Bool
+}
+
+// withAuthTracker returns a context that records whether source needed credentials
+func withAuthTracker(ctx context.Context, source *url.URL) (context.Context, *authTracker) {
+	tracker := &authTracker{source: source.String()}
+	return context.WithValue(ctx, authTrackerKey{}, tracker), tracker
+}
+
+// authTransport retries requests that were refused without credentials with the credentials of their host
+type authTransport struct {
+	base        http.RoundTripper
+	credentials map[string]Credential
+	// hidesPrivate reports whether a host answers 404 instead of 401 or 403 for private files
+	hidesPrivate func(host string) bool
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cred, ok := t.credentials[strings.ToLower(req.URL.Hostname())]
+	// Requests that carry their own Authorization (e.g., GitHub API calls) or a body are sent as is
+	if !ok || req.Header.Get("Authorization") != "" || (req.Body != nil && req.Body != http.NoBody) {
+		return t.base.RoundTrip(req)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+	case resp.StatusCode == http.StatusNotFound && t.hidesPrivate(req.URL.Hostname()):
+	default:
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+
+	authReq := req.Clone(req.Context())
+	if cred.Token != "" {
+		authReq.Header.Set("Authorization", "Bearer "+cred.Token)
+	} else {
+		authReq.SetBasicAuth(cred.Username, cred.Password)
+	}
+	authResp, err := t.base.RoundTrip(authReq)
+	if err != nil {
+		return nil, err
+	}
+	// Probes that fail with credentials too say nothing about the source.
+	// A redirect counts: GitHub sends private release downloads to its asset storage.
+	tracker, ok := req.Context().Value(authTrackerKey{}).(*authTracker)
+	if ok && authResp.StatusCode < http.StatusBadRequest && req.URL.String() == tracker.source {
+		tracker.used.Store(true)
+	}
+	return authResp, nil
+}
+
+// hidesPrivateFiles reports whether host is a GitHub or GitLab host, which answer 404 for private files
+func (c *Client) hidesPrivateFiles(host string) bool {
+	host = strings.ToLower(host)
+	if host == "raw.githubusercontent.com" {
+		return true
+	}
+	if _, ok := c.gitHubAPIURL(host); ok {
+		return true
+	}
+	_, ok := c.gitLabAPIURL(host)
+	return ok
+}
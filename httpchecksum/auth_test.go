@@ -0,0 +1,242 @@
+package httpchecksum
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	const netrc = `# company hosts
+machine artifacts.internal login ci password s3cr3t
+machine files.internal
+  login deploy
+  password "unquoted"
+
+macdef init
+cd /pub
+bin
+
+default login anonymous password user@example.com
+`
+	creds, err := parseNetrc(netrc)
+	if err != nil {
+		t.Fatalf("parseNetrc() error = %v", err)
+	}
+	want := []Credential{
+		{Host: "artifacts.internal", Username: "ci", Password: "s3cr3t"},
+		{Host: "files.internal", Username: "deploy", Password: `"unquoted"`},
+	}
+	if !slices.Equal(creds, want) {
+		t.Errorf("parseNetrc() = %+v, want %+v", creds, want)
+	}
+
+	for _, bad := range []string{"machine", "login ci", "machine a.internal login", "machine a.internal port 21"} {
+		if _, err := parseNetrc(bad); err == nil {
+			t.Errorf("parseNetrc(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestGetChecksum_Credentials(t *testing.T) {
+	const content = "private artifact"
+	const wantChecksum = "sha256:01de074da76345a11b07c4af83bae2a9cd1d721f5941ee50cf4c04369bb0893d"
+
+	var mu sync.Mutex
+	var seen []string // Authorization header of every request, in order
+	private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("Authorization"))
+		mu.Unlock()
+
+		w.Header().Set("Vary", "Authorization")
+		if r.URL.Path == "/public.txt" {
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); ok && user == "ci" && pass == "s3cr3t" {
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		if r.Header.Get("Authorization") == "Bearer t0ken" {
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer private.Close()
+	host := mustParseURL(t, private.URL).Hostname()
+
+	tests := []struct {
+		name         string
+		path         string
+		creds        []Credential
+		wantAuthErr  bool
+		wantAuthUsed bool
+	}{
+		{name: "basic auth", path: "/private.txt", creds: []Credential{{Host: host, Username: "ci", Password: "s3cr3t"}}, wantAuthUsed: true},
+		{name: "bearer token", path: "/private.txt", creds: []Credential{{Host: host, Token: "t0ken"}}, wantAuthUsed: true},
+		{name: "later entry wins", path: "/private.txt", creds: []Credential{{Host: host, Token: "stale"}, {Host: host, Token: "t0ken"}}, wantAuthUsed: true},
+		{name: "public file", path: "/public.txt", creds: []Credential{{Host: host, Token: "t0ken"}}},
+		{name: "wrong password", path: "/private.txt", creds: []Credential{{Host: host, Username: "ci", Password: "nope"}}, wantAuthErr: true},
+		{name: "other host", path: "/private.txt", creds: []Credential{{Host: "elsewhere.internal", Token: "t0ken"}}, wantAuthErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			seen = nil
+			mu.Unlock()
+
+			result, err := NewClient(WithCredentials(tt.creds...)).GetChecksumWithHeaders(context.Background(), private.URL+tt.path)
+			if tt.wantAuthErr {
+				if !IsAuthError(err) {
+					t.Fatalf("GetChecksumWithHeaders() error = %v, want AuthError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+			}
+			if result.Checksum != wantChecksum {
+				t.Errorf("Checksum = %s, want %s", result.Checksum, wantChecksum)
+			}
+			if result.AuthRequired != tt.wantAuthUsed {
+				t.Errorf("AuthRequired = %v, want %v", result.AuthRequired, tt.wantAuthUsed)
+			}
+			// Credentials must never end up in the policy, even when the response varies by them
+			if _, ok := result.Headers["authorization"]; ok {
+				t.Errorf("Headers leak the Authorization header: %v", result.Headers)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(seen) == 0 || seen[0] != "" {
+				t.Errorf("first request carried Authorization %q, want an anonymous request first", seen)
+			}
+		})
+	}
+}
+
+func TestGetChecksum_CredentialsNotForwardedOnRedirect(t *testing.T) {
+	var leaked string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked += r.Header.Get("Authorization")
+		_, _ = w.Write([]byte("artifact"))
+	}))
+	defer cdn.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// Redirect to the CDN under another hostname (localhost instead of 127.0.0.1)
+		http.Redirect(w, r, "http://localhost:"+mustParseURL(t, cdn.URL).Port()+r.URL.Path, http.StatusFound)
+	}))
+	defer origin.Close()
+
+	client := NewClient(WithCredentials(Credential{Host: mustParseURL(t, origin.URL).Hostname(), Token: "t0ken"}))
+	result, err := client.GetChecksumWithHeaders(context.Background(), origin.URL+"/artifact.bin")
+	if err != nil {
+		t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+	}
+	if !result.AuthRequired {
+		t.Error("AuthRequired = false, want true")
+	}
+	if leaked != "" {
+		t.Errorf("redirect target received Authorization %q", leaked)
+	}
+}
+
+func TestGetChecksum_CredentialsOnNotFound(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string // Authorization header of every request for the file, in order
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/private.bin" {
+			// Sidecar probes are missing with or without credentials
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		seen = append(seen, r.Header.Get("Authorization"))
+		mu.Unlock()
+		if r.Header.Get("Authorization") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("artifact"))
+	}))
+	defer server.Close()
+	host := mustParseURL(t, server.URL).Hostname()
+	creds := WithCredentials(Credential{Host: host, Token: "t0ken"})
+
+	// Any host may answer 404 for a file that does not exist; only GitHub and GitLab hide private files that way
+	t.Run("other host", func(t *testing.T) {
+		mu.Lock()
+		seen = nil
+		mu.Unlock()
+		_, err := NewClient(creds).GetChecksumWithHeaders(context.Background(), server.URL+"/private.bin")
+		if err == nil {
+			t.Fatal("GetChecksumWithHeaders() succeeded, want the 404")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if slices.Contains(seen, "Bearer t0ken") {
+			t.Errorf("credentials sent after a 404 from a host that is not GitHub or GitLab: %q", seen)
+		}
+	})
+
+	t.Run("GitLab host", func(t *testing.T) {
+		client := NewClient(
+			creds,
+			WithGitLabHosts(GitLabHost{Host: host, APIURL: server.URL + "/api/v4"}),
+			WithSidecars(SidecarConfig{Host: host}),
+		)
+		result, err := client.GetChecksumWithHeaders(context.Background(), server.URL+"/private.bin")
+		if err != nil {
+			t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+		}
+		if !result.AuthRequired {
+			t.Error("AuthRequired = false, want true")
+		}
+	})
+
+	// Probes that fail with credentials too must not mark a public file as private
+	t.Run("failed probes", func(t *testing.T) {
+		public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/public.bin" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte("artifact"))
+		}))
+		defer public.Close()
+		publicHost := mustParseURL(t, public.URL).Hostname()
+		client := NewClient(
+			WithCredentials(Credential{Host: publicHost, Token: "t0ken"}),
+			WithGitLabHosts(GitLabHost{Host: publicHost, APIURL: public.URL + "/api/v4"}),
+			WithSidecars(SidecarConfig{Host: publicHost}),
+		)
+		result, err := client.GetChecksumWithHeaders(context.Background(), public.URL+"/public.bin")
+		if err != nil {
+			t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+		}
+		if result.AuthRequired {
+			t.Error("AuthRequired = true for a public file, want false")
+		}
+	})
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("url.Parse(%q) error = %v", rawURL, err)
+	}
+	return u
+}
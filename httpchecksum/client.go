@@ -3,9 +3,22 @@
 //
 // The client attempts to retrieve checksums without downloading full content when possible:
 //   - AWS S3: Uses X-Amz-Checksum-Sha256 header
-//   - GitHub Releases: Uses GitHub API to fetch asset digests
+//   - JFrog Artifactory / Sonatype Nexus: Uses X-Checksum-Sha256 header
+//   - GitHub Releases: Uses GitHub API to fetch asset digests (one call per release; GHES via WithGitHubHosts)
+//   - GitLab generic packages and release links: Uses the file_sha256 from the Packages API
 //   - raw.githubusercontent.com: Uses ETag header (SHA256)
-//   - Other servers: Downloads and computes SHA256
+//   - Hugging Face Hub: Uses X-Linked-Etag from the /resolve/ redirect (LFS SHA256)
+//   - media.githubusercontent.com: Uses the oid of the Git LFS pointer file
+//   - RFC 9530 servers: Uses Repr-Digest (or the legacy Digest header)
+//   - PyPI, npm, Maven and Go module proxy downloads: Uses the digests published by the registry
+//     (npm and Go modules publish other hashes, so their downloads are verified against them)
+//   - Hosts enabled with WithSidecars: Uses published <file>.sha256 / SHA256SUMS files
+//   - Other servers: Downloads and computes SHA256 (large files in parallel ranges, see WithParallelDownloads)
+//
+// Private sources are fetched with credentials from WithCredentials (see LoadNetrc), GITHUB_TOKEN
+// (github.com, raw.githubusercontent.com) or GITLAB_TOKEN (gitlab.com); they are never part of the result.
+//
+// Each strategy is a Provider; WithProvider registers custom ones with a priority.
 //
 // The client also validates HTTP cache headers to detect volatile content that should
 // not be pinned for reproducible builds.
@@ -25,13 +38,11 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -43,6 +54,9 @@ import (
 
 const amazonS3Server = "AmazonS3"
 
+// Server header prefixes of artifact repository managers that return X-Checksum-* headers
+var repositoryManagerServers = []string{"Artifactory", "Nexus"}
+
 // AuthError indicates an HTTP resource requires authentication
 type AuthError struct {
 	URL        string
@@ -83,6 +97,17 @@ type ChecksumResult struct {
 	// Headers contains HTTP headers that should be included in the source policy
 	// These are the request headers that the response varies by (from the Vary header)
 	Headers map[string]string
+	// MutableReason explains why the content behind the URL is expected to change
+	// (e.g., a Hugging Face branch revision); empty when the URL looks immutable
+	MutableReason string
+	// StableURL is a URL that pins the content MutableReason is about (e.g., the versioned
+	// location a "latest" URL redirected to); empty when there is none to suggest
+	StableURL string
+	// Redirects are the locations the URL redirected to, in order; the last one served the content
+	Redirects []string
+	// AuthRequired reports that the source was refused without the configured credentials,
+	// so BuildKit needs credentials for it at build time too
+	AuthRequired bool
 }
 
 // ProgressWriterFactory creates a progress writer for a download
@@ -94,24 +119,69 @@ type ProgressWriterFactory func(contentLength int64) io.Writer
 type Client struct {
 	httpClient      *http.Client
 	progressFactory ProgressWriterFactory
+	sidecars        map[string]SidecarConfig // host -> sidecar settings (opt-in)
+	registries      map[string]RegistryHost  // host -> package registry serving its files
+	goSumDBKey      string                   // verifier key of the Go checksum database
+	providers       []prioritizedProvider    // custom providers, tried along with the built-in ones
+	credentials     map[string]Credential    // host -> credentials sent when the host refuses anonymous requests
+	githubHosts     map[string]GitHubHost    // host -> GitHub API serving its release downloads
+	githubReleases  *releaseCache            // release API responses, shared with WithProgressFactory copies
+	gitlabHosts     map[string]GitLabHost    // host -> GitLab API serving its packages and releases
+	redirectPolicy  RedirectPolicy           // redirects followed
+	maxDownloadSize int64                    // largest content downloaded, 0 for no limit
+	budget          *downloadBudget          // bytes left to download, shared with WithProgressFactory copies
+	// Large downloads are split into segmentSize ranges fetched over parallelDownloads connections
+	parallelDownloads int
+	segmentSize       int64
+	rangedThreshold   int64
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithTransport sets the transport requests are sent through (e.g., one with a custom CA or a proxy)
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.httpClient.Transport = transport
+	}
 }
 
 // NewClient creates a new HTTP client
-func NewClient() *Client {
-	return &Client{
+func NewClient(opts ...Option) *Client {
+	c := &Client{
 		httpClient: &http.Client{
 			Timeout: 5 * time.Minute, // Allow time for large file downloads
 		},
+		goSumDBKey:        goSumDBKey,
+		githubReleases:    &releaseCache{},
+		parallelDownloads: defaultParallelDownloads,
+		segmentSize:       defaultSegmentSize,
+		rangedThreshold:   defaultRangedThreshold,
+	}
+	WithRegistryHosts(defaultRegistryHosts...)(c)
+	WithGitHubHosts(defaultGitHubHosts()...)(c)
+	WithGitLabHosts(defaultGitLabHosts()...)(c)
+	WithCredentials(envCredentials()...)(c)
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.httpClient.CheckRedirect = c.checkRedirect
+	if len(c.credentials) > 0 {
+		base := c.httpClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		c.httpClient.Transport = &authTransport{base: base, credentials: c.credentials, hidesPrivate: c.hidesPrivateFiles}
 	}
+	return c
 }
 
 // WithProgressFactory returns a copy of the client with progress reporting enabled
 // The factory is called when a download starts, receiving the content length
 func (c *Client) WithProgressFactory(factory ProgressWriterFactory) *Client {
-	return &Client{
-		httpClient:      c.httpClient,
-		progressFactory: factory,
-	}
+	clone := *c
+	clone.progressFactory = factory
+	return &clone
 }
 
 // GetChecksum fetches the SHA256 checksum for a URL
@@ -133,95 +203,49 @@ func (c *Client) GetChecksumWithHeaders(ctx context.Context, rawURL string) (*Ch
 		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
 
-	// GitHub releases require a separate API call (can't detect from headers)
-	if parsedURL.Host == "github.com" && strings.Contains(parsedURL.Path, "/releases/download/") {
-		checksum, err := c.getChecksumFromGitHubRelease(ctx, parsedURL)
-		if err == nil && checksum != "" {
-			return &ChecksumResult{Checksum: checksum, Headers: make(map[string]string)}, nil
-		}
-		// Propagate auth errors immediately, don't fall through
-		if IsAuthError(err) {
-			return nil, err
+	ctx, tracker := withAuthTracker(ctx, parsedURL)
+	ctx, redirects := withRedirectTracker(ctx, parsedURL)
+	lookup := &Lookup{URL: parsedURL, RawURL: rawURL, client: c}
+	result, err := c.runProviders(ctx, lookup, c.orderedProviders())
+	if err != nil {
+		return nil, err
+	}
+	result.AuthRequired = tracker.used.Load()
+	result.Redirects = redirects.redirects()
+	if result.MutableReason == "" {
+		result.MutableReason = c.mutableReason(parsedURL)
+	}
+	if result.MutableReason == "" {
+		// e.g., /download/latest/tool.tar.gz redirecting to /download/v3.2.1/tool.tar.gz
+		if location, version := versionedRedirect(parsedURL, result.Redirects); location != "" {
+			result.MutableReason = fmt.Sprintf("it redirects to %s, which names version %s", location, version)
+			result.StableURL = location
 		}
-		// Fall through to HEAD-based detection on other failures
 	}
+	return result, nil
+}
 
-	// Try HEAD request first to detect server type and extract checksums without downloading
-	result, err := c.getChecksumFromHEADWithHeaders(ctx, rawURL)
-	if err == nil && result.Checksum != "" {
-		return result, nil
+// mutableReason explains why the content behind a URL is expected to change, or returns ""
+func (c *Client) mutableReason(u *url.URL) string {
+	if hf, ok := parseHuggingFaceURL(u); ok {
+		return hf.mutableReason()
 	}
-	// Propagate auth errors and volatile content errors immediately
-	if IsAuthError(err) || IsVolatileContentError(err) {
-		return nil, err
+	if _, ok := c.gitHubAPIURL(u.Hostname()); ok {
+		if asset, err := parseGitHubReleaseURL(u); err == nil && asset.Tag == "" {
+			return asset.latestMutableReason("")
+		}
 	}
-
-	// Fallback: download and compute SHA256
-	return c.computeChecksumWithHeaders(ctx, rawURL)
+	return ""
 }
 
 // getChecksumFromHEADWithHeaders makes a HEAD request and tries to extract checksum from response headers.
 // It also extracts headers that should be included in the source policy based on the Vary header.
 func (c *Client) getChecksumFromHEADWithHeaders(ctx context.Context, rawURL string) (*ChecksumResult, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, http.NoBody)
-	if err != nil {
-		return nil, err
-	}
-
-	// Set User-Agent to identify the tool making requests
-	// Matches BuildKit's convention: "buildkit/{version}"
-	req.Header.Set("User-Agent", version.UserAgent())
-
-	// Request S3 checksums if available (this header is ignored by non-S3 servers)
-	req.Header.Set("X-Amz-Checksum-Mode", "ENABLED")
-
-	resp, err := c.httpClient.Do(req)
+	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	// Handle authentication errors gracefully
-	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return nil, &AuthError{URL: rawURL, StatusCode: resp.StatusCode}
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HEAD request failed: %s", resp.Status)
-	}
-
-	// Check cacheability before processing - volatile content should not be pinned
-	if err := checkCacheability(rawURL, resp.Header); err != nil {
-		return nil, err
-	}
-
-	// Extract checksum
-	var checksum string
-	// Detect S3 from Server header (more reliable than URL pattern matching)
-	server := resp.Header.Get("Server")
-	if server == amazonS3Server {
-		checksum, err = c.extractS3Checksum(resp)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// Check for raw.githubusercontent.com ETag pattern (SHA256 hash)
-		etag := resp.Header.Get("ETag")
-		etag = strings.Trim(etag, `"`)
-		if len(etag) == 64 && isHexString(etag) {
-			checksum = "sha256:" + etag
-		} else {
-			return nil, errors.New("no usable checksum found in headers")
-		}
+		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
-
-	// Extract headers based on Vary response header
-	headers := extractVaryHeaders(req.Header, resp.Header)
-
-	return &ChecksumResult{
-		Checksum: checksum,
-		Headers:  headers,
-	}, nil
+	return c.runProviders(ctx, &Lookup{URL: parsedURL, RawURL: rawURL, client: c}, headerProviders)
 }
 
 // getChecksumFromHEAD makes a HEAD request and tries to extract checksum from response headers.
@@ -253,90 +277,40 @@ func (c *Client) extractS3Checksum(resp *http.Response) (string, error) {
 	return "", errors.New("no SHA-256 checksum found in S3 headers")
 }
 
-// GitHubReleaseAsset represents a release asset from the GitHub API
-type GitHubReleaseAsset struct {
-	Name   string `json:"name"`
-	Digest string `json:"digest"` // Available since June 2025
-}
-
-// GitHubRelease represents a release from the GitHub API
-type GitHubRelease struct {
-	Assets []GitHubReleaseAsset `json:"assets"`
-}
-
-// getChecksumFromGitHubRelease uses the GitHub API to get the digest for a release asset
-func (c *Client) getChecksumFromGitHubRelease(ctx context.Context, parsedURL *url.URL) (string, error) {
-	// Parse the release URL: /owner/repo/releases/download/tag/asset
-	// e.g., /cli/cli/releases/download/v2.50.0/gh_2.50.0_linux_amd64.tar.gz
-	pathParts := strings.Split(strings.TrimPrefix(parsedURL.Path, "/"), "/")
-	if len(pathParts) < 6 {
-		return "", errors.New("invalid GitHub release URL format")
+// isRepositoryManager detects JFrog Artifactory and Sonatype Nexus from their response headers
+func isRepositoryManager(headers http.Header) bool {
+	if headers.Get("X-Artifactory-Id") != "" || headers.Get("X-JFrog-Version") != "" {
+		return true
 	}
-
-	owner := pathParts[0]
-	repo := pathParts[1]
-	tag := pathParts[4]
-	rawAssetName := strings.Join(pathParts[5:], "/")
-
-	// URL-decode the asset name to match GitHub API response (which returns unencoded names)
-	assetName, err := url.PathUnescape(rawAssetName)
-	if err != nil {
-		return "", fmt.Errorf("invalid asset name encoding: %w", err)
-	}
-
-	// Query the GitHub API for the release
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/tags/%s", owner, repo, tag)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, http.NoBody)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("User-Agent", version.UserAgent())
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("X-Github-Api-Version", "2022-11-28")
-
-	// Support GITHUB_TOKEN for authenticated requests (5,000 req/hr vs 60 req/hr)
-	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-		req.Header.Set("Authorization", "Bearer "+token)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	// Handle authentication errors
-	// Note: 404 is NOT treated as auth error because GitHub returns 404 for both:
-	// - Private repos/releases without auth (hiding existence)
-	// - Genuinely missing tags/assets on public repos
-	// We can't distinguish these cases, so treat 404 as a real "not found" error
-	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return "", &AuthError{URL: parsedURL.String(), StatusCode: resp.StatusCode}
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("GitHub API request failed: %s", resp.Status)
-	}
-
-	var release GitHubRelease
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return "", fmt.Errorf("failed to decode GitHub API response: %w", err)
+	server := headers.Get("Server")
+	for _, prefix := range repositoryManagerServers {
+		if strings.HasPrefix(server, prefix) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Find the matching asset
-	for _, asset := range release.Assets {
-		if asset.Name == assetName && asset.Digest != "" {
-			// Digest is already in format "sha256:..."
-			return asset.Digest, nil
-		}
+// extractRepositoryManagerChecksum extracts the SHA-256 checksum from Artifactory/Nexus headers
+func (c *Client) extractRepositoryManagerChecksum(resp *http.Response) (string, error) {
+	// Repository managers return hex-encoded checksums (their ETag is usually a SHA-1)
+	sha256Checksum := strings.ToLower(strings.TrimSpace(resp.Header.Get("X-Checksum-Sha256")))
+	if len(sha256Checksum) == 64 && isHexString(sha256Checksum) {
+		return "sha256:" + sha256Checksum, nil
 	}
 
-	return "", fmt.Errorf("asset %s not found or has no digest", assetName)
+	// No SHA-256 available from headers - caller will fall back to computing it
+	return "", errors.New("no SHA-256 checksum found in repository manager headers")
 }
 
 // computeChecksumWithHeaders downloads the content, computes SHA256, and extracts relevant headers
 func (c *Client) computeChecksumWithHeaders(ctx context.Context, rawURL string) (*ChecksumResult, error) {
+	return c.download(ctx, rawURL, nil)
+}
+
+// download computes the SHA256 of rawURL's content, also copying the content to extra when it is not nil
+// (to verify another published digest or keep the file)
+func (c *Client) download(ctx context.Context, rawURL string, extra io.Writer) (*ChecksumResult, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, http.NoBody)
 	if err != nil {
 		return nil, err
@@ -345,6 +319,11 @@ func (c *Client) computeChecksumWithHeaders(ctx context.Context, rawURL string)
 	// Set User-Agent to identify the tool making requests
 	req.Header.Set("User-Agent", version.UserAgent())
 
+	return c.downloadRequest(req, rawURL, extra)
+}
+
+// downloadRequest sends a prepared GET request for rawURL and computes the SHA256 of the response body
+func (c *Client) downloadRequest(req *http.Request, rawURL string, extra io.Writer) (*ChecksumResult, error) {
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -364,17 +343,40 @@ func (c *Client) computeChecksumWithHeaders(ctx context.Context, rawURL string)
 	if err := checkCacheability(rawURL, resp.Header); err != nil {
 		return nil, err
 	}
+	if err := c.checkDownloadSize(rawURL, resp.ContentLength); err != nil {
+		return nil, err
+	}
+	reservation, err := c.reserveDownload(rawURL, resp.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+	defer reservation.release()
 
 	hash := sha256.New()
 
 	// Create writer chain: hash the content, optionally report progress
-	var dst io.Writer = hash
+	writers := []io.Writer{hash}
+	if extra != nil {
+		writers = append(writers, extra)
+	}
 	if c.progressFactory != nil {
-		progressWriter := c.progressFactory(resp.ContentLength)
-		dst = io.MultiWriter(hash, progressWriter)
+		writers = append(writers, c.progressFactory(resp.ContentLength))
 	}
+	dst := io.MultiWriter(writers...)
 
-	n, err := io.Copy(dst, resp.Body)
+	var n int64
+	if c.canDownloadRanges(resp) {
+		n, err = c.downloadRanges(req.Context(), resp, rawURL, dst, reservation)
+		if err != nil && !IsDownloadLimitError(err) && req.Context().Err() == nil {
+			// A range request failed (a 200 instead of 206, a reset connection): get the rest over one connection
+			n, err = c.downloadRest(req, resp, rawURL, dst, reservation, n)
+		}
+	} else {
+		n, err = io.Copy(dst, c.limitDownload(rawURL, resp.Body, reservation))
+	}
+	if IsDownloadLimitError(err) {
+		return nil, err
+	}
 	// Validate Content-Length if provided (-1 means not present, e.g., chunked encoding)
 	// A mismatch indicates server misconfiguration or network issues - we shouldn't trust such sources for pinning
 	if resp.ContentLength >= 0 && n != resp.ContentLength {
@@ -253,6 +253,95 @@ func TestGetChecksumFromHEAD(t *testing.T) {
 			wantChecksum: "",
 			wantErr:      true,
 		},
+		// Artifact repository managers (detected via X-Artifactory-Id or Server header)
+		{
+			name: "Artifactory with SHA256 checksum header",
+			headers: map[string]string{
+				"X-Artifactory-Id":  "a1b2c3d4",
+				"ETag":              "\"a94a8fe5ccb19ba61c4c0873d391e987982fbbd3\"",
+				"X-Checksum-Sha256": "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+			},
+			statusCode:   http.StatusOK,
+			wantChecksum: "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+		},
+		{
+			name: "Nexus with SHA256 checksum header",
+			headers: map[string]string{
+				"Server":            "Nexus/3.68.1-02 (OSS)",
+				"X-Checksum-Sha256": "2C26B46B68FFC68FF99B453C1D30413413422D706483BFA0F98A5E886266E7AE",
+			},
+			statusCode:   http.StatusOK,
+			wantChecksum: "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+		},
+		{
+			name: "Artifactory with SHA1 only falls back",
+			headers: map[string]string{
+				"Server":          "Artifactory/7.77.5",
+				"X-Checksum-Sha1": "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
+			},
+			statusCode: http.StatusOK,
+			wantErr:    true,
+		},
+		{
+			name: "X-Checksum-Sha256 ignored without repository manager headers",
+			headers: map[string]string{
+				"X-Checksum-Sha256": "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+			},
+			statusCode: http.StatusOK,
+			wantErr:    true,
+		},
+		// Digest fields (RFC 9530 and legacy RFC 3230)
+		{
+			name: "Repr-Digest",
+			headers: map[string]string{
+				"Repr-Digest": "sha-512=:AAAA:, sha-256=:LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=:",
+			},
+			statusCode:   http.StatusOK,
+			wantChecksum: "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+		},
+		{
+			name: "Repr-Digest preferred over ETag",
+			headers: map[string]string{
+				"Repr-Digest": "sha-256=:LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=:",
+				"ETag":        "abc123def456abc123def456abc123def456abc123def456abc123def456abcd",
+			},
+			statusCode:   http.StatusOK,
+			wantChecksum: "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+		},
+		{
+			// A HEAD response has no content, so its Content-Digest says nothing about the file
+			name: "Content-Digest on HEAD is ignored",
+			headers: map[string]string{
+				"Content-Digest": "sha-256=:LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=:",
+			},
+			statusCode: http.StatusOK,
+			wantErr:    true,
+		},
+		{
+			name: "legacy Digest",
+			headers: map[string]string{
+				"Digest": "MD5=CY9rzUYh03PK3k6DJie09g==,SHA-256=LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=",
+			},
+			statusCode:   http.StatusOK,
+			wantChecksum: "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+		},
+		{
+			name: "digest of gzip-encoded content is ignored",
+			headers: map[string]string{
+				"Content-Encoding": "gzip",
+				"Repr-Digest":      "sha-256=:LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=:",
+			},
+			statusCode: http.StatusOK,
+			wantErr:    true,
+		},
+		{
+			name: "sha-512 only falls back",
+			headers: map[string]string{
+				"Repr-Digest": "sha-512=:WZRHGrsBESr8wYFZ9sx0tPURuZgG2lmzyvWpwXPKz8U=:",
+			},
+			statusCode: http.StatusOK,
+			wantErr:    true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -265,6 +354,9 @@ func TestGetChecksumFromHEAD(t *testing.T) {
 				if r.Header.Get("X-Amz-Checksum-Mode") != "ENABLED" {
 					t.Error("expected x-amz-checksum-mode: ENABLED header")
 				}
+				if r.Header.Get("Want-Repr-Digest") != "sha-256=10" {
+					t.Error("expected Want-Repr-Digest: sha-256=10 header")
+				}
 				for k, v := range tt.headers {
 					w.Header().Set(k, v)
 				}
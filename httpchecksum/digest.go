@@ -0,0 +1,59 @@
+package httpchecksum
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Digest fields from RFC 9530 (Digest Fields) and the obsolete RFC 3230 (Instance Digests)
+const (
+	headerReprDigest   = "Repr-Digest"
+	headerLegacyDigest = "Digest"
+)
+
+// extractDigestFieldChecksum returns the SHA-256 in the digest fields of a HEAD response, in order of preference:
+//   - Repr-Digest: sha-256=:<base64>: (RFC 9530, digest of the selected representation)
+//   - Digest: SHA-256=<base64> (RFC 3230, digest of the instance)
+//
+// Content-Digest is not used: it covers the message content, and a HEAD response has none.
+// Both fields cover the representation after content coding. BuildKit hashes the decoded body,
+// so the digests are only usable when the response is not content-encoded.
+func extractDigestFieldChecksum(headers http.Header) (string, bool) {
+	if encoding := strings.TrimSpace(headers.Get("Content-Encoding")); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return "", false
+	}
+
+	if value, ok := parseDigestDictionary(headers.Values(headerReprDigest), "sha-256", true); ok {
+		return value, true
+	}
+	return parseDigestDictionary(headers.Values(headerLegacyDigest), "sha-256", false)
+}
+
+// parseDigestDictionary finds algorithm in digest field values and returns the digest as hex.
+// RFC 9530 fields are structured-field dictionaries whose values are byte sequences (:<base64>:),
+// possibly with parameters; RFC 3230 values are plain base64 and algorithm names are case-insensitive.
+func parseDigestDictionary(values []string, algorithm string, structured bool) (string, bool) {
+	for _, value := range values {
+		for member := range strings.SplitSeq(value, ",") {
+			key, encoded, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), algorithm) {
+				continue
+			}
+			encoded, _, _ = strings.Cut(strings.TrimSpace(encoded), ";")
+			if structured {
+				inner, ok := strings.CutPrefix(encoded, ":")
+				if !ok {
+					continue
+				}
+				if encoded, ok = strings.CutSuffix(inner, ":"); !ok {
+					continue
+				}
+			}
+			decoded, err := decodeBase64ToHex(encoded)
+			if err == nil && isSHA256Hex(decoded) {
+				return decoded, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,328 @@
+package httpchecksum
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/wharflab/container-source-policy/internal/version"
+)
+
+const defaultGitHubAPIURL = "https://api.github.com"
+
+// GitHubHost maps a GitHub (or GitHub Enterprise Server) web host to its REST API
+type GitHubHost struct {
+	// Host is the hostname release downloads are served from (e.g., github.example.com)
+	Host string
+	// APIURL is the REST API root; empty means https://<Host>/api/v3
+	APIURL string
+}
+
+// GitHubReleaseAsset represents a release asset from the GitHub API
+type GitHubReleaseAsset struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Digest string `json:"digest"` // Available since June 2025
+}
+
+// GitHubRelease represents a release from the GitHub API
+type GitHubRelease struct {
+	TagName string               `json:"tag_name"`
+	Assets  []GitHubReleaseAsset `json:"assets"`
+}
+
+// WithGitHubHosts registers GitHub Enterprise Server hosts whose release downloads are looked up
+// through their API. github.com and the host of GITHUB_API_URL are registered by default.
+func WithGitHubHosts(hosts ...GitHubHost) Option {
+	return func(c *Client) {
+		if c.githubHosts == nil {
+			c.githubHosts = make(map[string]GitHubHost)
+		}
+		for _, host := range hosts {
+			host.APIURL = strings.TrimSuffix(cmp.Or(host.APIURL, "https://"+host.Host+"/api/v3"), "/")
+			c.githubHosts[strings.ToLower(host.Host)] = host
+		}
+	}
+}
+
+// defaultGitHubHosts returns github.com and, in GitHub Actions on GHES, the server of GITHUB_API_URL
+func defaultGitHubHosts() []GitHubHost {
+	hosts := []GitHubHost{{Host: "github.com", APIURL: defaultGitHubAPIURL}}
+	apiURL := os.Getenv("GITHUB_API_URL")
+	if apiURL == "" {
+		return hosts
+	}
+	parsed, err := url.Parse(apiURL)
+	if err != nil || parsed.Hostname() == "" {
+		return hosts
+	}
+	host := parsed.Hostname()
+	if server, err := url.Parse(os.Getenv("GITHUB_SERVER_URL")); err == nil && server.Hostname() != "" {
+		host = server.Hostname()
+	} else if host == "api.github.com" {
+		host = "github.com"
+	}
+	return append(hosts, GitHubHost{Host: host, APIURL: apiURL})
+}
+
+// gitHubAPIURL returns the API root for a release download host
+func (c *Client) gitHubAPIURL(host string) (string, bool) {
+	if gh, ok := c.githubHosts[strings.ToLower(host)]; ok {
+		return gh.APIURL, true
+	}
+	if host == "github.com" {
+		return defaultGitHubAPIURL, true
+	}
+	return "", false
+}
+
+// gitHubToken returns the token for API requests: the configured credentials of the API host, or GITHUB_TOKEN
+// for api.github.com and the GITHUB_API_URL host (the server a GitHub Actions job runs on)
+func (c *Client) gitHubToken(apiURL string) string {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if cred, ok := c.credentials[host]; ok && cred.Token != "" {
+		return cred.Token
+	}
+	envAPI, err := url.Parse(os.Getenv("GITHUB_API_URL"))
+	if host != "api.github.com" && (err != nil || !strings.EqualFold(envAPI.Hostname(), host)) {
+		return ""
+	}
+	// GITHUB_TOKEN raises the rate limit from 60 to 5,000 requests/hour
+	return os.Getenv("GITHUB_TOKEN")
+}
+
+// gitHubAsset is a release asset download URL:
+// /owner/repo/releases/download/tag/asset or /owner/repo/releases/latest/download/asset
+type gitHubAsset struct {
+	Owner, Repo string
+	Tag         string // empty for latest
+	Name        string
+}
+
+// isGitHubReleaseDownload reports whether the path looks like a release asset download
+func isGitHubReleaseDownload(u *url.URL) bool {
+	return strings.Contains(u.Path, "/releases/download/") || strings.Contains(u.Path, "/releases/latest/download/")
+}
+
+// parseGitHubReleaseURL splits a release asset download URL into its parts
+func parseGitHubReleaseURL(u *url.URL) (gitHubAsset, error) {
+	pathParts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+	if len(pathParts) < 6 || pathParts[2] != "releases" {
+		return gitHubAsset{}, errors.New("invalid GitHub release URL format")
+	}
+
+	asset := gitHubAsset{Owner: pathParts[0], Repo: pathParts[1]}
+	rawAssetName := ""
+	switch {
+	case pathParts[3] == "download":
+		asset.Tag = pathParts[4]
+		rawAssetName = strings.Join(pathParts[5:], "/")
+	case pathParts[3] == "latest" && pathParts[4] == "download":
+		rawAssetName = strings.Join(pathParts[5:], "/")
+	default:
+		return gitHubAsset{}, errors.New("invalid GitHub release URL format")
+	}
+
+	// URL-decode the asset name to match GitHub API response (which returns unencoded names)
+	name, err := url.PathUnescape(rawAssetName)
+	if err != nil {
+		return gitHubAsset{}, fmt.Errorf("invalid asset name encoding: %w", err)
+	}
+	asset.Name = name
+	return asset, nil
+}
+
+// latestMutableReason explains why a /releases/latest/download/ URL is not stable
+func (a gitHubAsset) latestMutableReason(tag string) string {
+	if tag == "" {
+		return "/releases/latest/ follows the newest release"
+	}
+	return fmt.Sprintf("/releases/latest/ currently resolves to %s", tag)
+}
+
+// errGitHubReleaseNotFound is returned when the API answers 404 for a release
+var errGitHubReleaseNotFound = errors.New("GitHub release not found")
+
+// releaseCache memoises GitHub release responses for the lifetime of a Client (and its copies),
+// so assets of the same release cost one API call
+type releaseCache struct {
+	mu    sync.Mutex
+	calls map[string]*releaseCall
+}
+
+type releaseCall struct {
+	done    chan struct{}
+	release *GitHubRelease
+	err     error
+}
+
+// get returns the cached release for key. Concurrent callers share one fetch; only releases and
+// 404s are kept, so rate limits, network and auth errors are retried by later lookups.
+func (r *releaseCache) get(key string, fetch func() (*GitHubRelease, error)) (*GitHubRelease, error) {
+	if r == nil {
+		return fetch()
+	}
+	r.mu.Lock()
+	if r.calls == nil {
+		r.calls = make(map[string]*releaseCall)
+	}
+	if call, ok := r.calls[key]; ok {
+		r.mu.Unlock()
+		<-call.done
+		return call.release, call.err
+	}
+	call := &releaseCall{done: make(chan struct{})}
+	r.calls[key] = call
+	r.mu.Unlock()
+
+	call.release, call.err = fetch()
+	if call.err != nil && !errors.Is(call.err, errGitHubReleaseNotFound) {
+		r.mu.Lock()
+		delete(r.calls, key)
+		r.mu.Unlock()
+	}
+	close(call.done)
+	return call.release, call.err
+}
+
+// getGitHubRelease fetches a release by tag (or the latest release when tag is empty)
+func (c *Client) getGitHubRelease(ctx context.Context, apiURL string, asset gitHubAsset, sourceURL string) (*GitHubRelease, error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s", apiURL, asset.Owner, asset.Repo, asset.Tag)
+	if asset.Tag == "" {
+		endpoint = fmt.Sprintf("%s/repos/%s/%s/releases/latest", apiURL, asset.Owner, asset.Repo)
+	}
+
+	return c.githubReleases.get(endpoint, func() (*GitHubRelease, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", version.UserAgent())
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-Github-Api-Version", "2022-11-28")
+		if token := c.gitHubToken(apiURL); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		// Handle authentication errors
+		// Note: 404 is NOT treated as auth error because GitHub returns 404 for both:
+		// - Private repos/releases without auth (hiding existence)
+		// - Genuinely missing tags/assets on public repos
+		// We can't distinguish these cases, so treat 404 as a real "not found" error
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return nil, &AuthError{URL: sourceURL, StatusCode: resp.StatusCode}
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("GitHub API request failed: %w: %s", errGitHubReleaseNotFound, endpoint)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GitHub API request failed: %s", resp.Status)
+		}
+
+		var release GitHubRelease
+		if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+			return nil, fmt.Errorf("failed to decode GitHub API response: %w", err)
+		}
+		return &release, nil
+	})
+}
+
+// getChecksumFromGitHubRelease uses the GitHub API to get the digest for a release asset
+func (c *Client) getChecksumFromGitHubRelease(ctx context.Context, parsedURL *url.URL) (string, error) {
+	result, err := c.getGitHubReleaseChecksum(ctx, parsedURL)
+	if err != nil {
+		return "", err
+	}
+	return result.Checksum, nil
+}
+
+// getGitHubReleaseChecksum looks up a release asset's digest. Assets uploaded before GitHub started
+// publishing digests are downloaded through the API by asset ID, which also works for private repositories.
+// For /releases/latest/ URLs, MutableReason names the release "latest" resolved to and StableURL its download URL.
+func (c *Client) getGitHubReleaseChecksum(ctx context.Context, parsedURL *url.URL) (*ChecksumResult, error) {
+	// e.g., /cli/cli/releases/download/v2.50.0/gh_2.50.0_linux_amd64.tar.gz
+	asset, err := parseGitHubReleaseURL(parsedURL)
+	if err != nil {
+		return nil, err
+	}
+	apiURL, ok := c.gitHubAPIURL(parsedURL.Hostname())
+	if !ok {
+		return nil, fmt.Errorf("%s is not a known GitHub host", parsedURL.Host)
+	}
+
+	release, err := c.getGitHubRelease(ctx, apiURL, asset, parsedURL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	result := checksumResult("")
+	if asset.Tag == "" {
+		result.MutableReason = asset.latestMutableReason(release.TagName)
+		if release.TagName != "" {
+			result.StableURL = strings.Replace(parsedURL.String(), "/releases/latest/download/",
+				"/releases/download/"+url.PathEscape(release.TagName)+"/", 1)
+		}
+	}
+
+	// Find the matching asset
+	for _, releaseAsset := range release.Assets {
+		if releaseAsset.Name != asset.Name {
+			continue
+		}
+		if releaseAsset.Digest != "" {
+			// Digest is already in format "sha256:..."
+			result.Checksum = releaseAsset.Digest
+			return result, nil
+		}
+		if releaseAsset.ID != 0 {
+			checksum, err := c.downloadGitHubAsset(ctx, apiURL, asset, releaseAsset.ID, parsedURL.String())
+			if err != nil {
+				return nil, err
+			}
+			result.Checksum = checksum
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("asset %s not found or has no digest", asset.Name)
+}
+
+// downloadGitHubAsset downloads a release asset through the API and computes its SHA256
+func (c *Client) downloadGitHubAsset(ctx context.Context, apiURL string, asset gitHubAsset, id int64, sourceURL string) (string, error) {
+	assetURL := fmt.Sprintf("%s/repos/%s/%s/releases/assets/%d", apiURL, asset.Owner, asset.Repo, id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Accept", "application/octet-stream")
+	req.Header.Set("X-Github-Api-Version", "2022-11-28")
+	if token := c.gitHubToken(apiURL); token != "" {
+		// Not forwarded to the storage host the API redirects to
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	result, err := c.downloadRequest(req, sourceURL, nil)
+	if err != nil {
+		return "", err
+	}
+	return result.Checksum, nil
+}
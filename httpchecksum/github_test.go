@@ -0,0 +1,273 @@
+package httpchecksum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func TestParseGitHubReleaseURL(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    gitHubAsset
+		wantErr bool
+	}{
+		{path: "/cli/cli/releases/download/v2.50.0/gh.tar.gz", want: gitHubAsset{Owner: "cli", Repo: "cli", Tag: "v2.50.0", Name: "gh.tar.gz"}},
+		{path: "/cli/cli/releases/latest/download/gh.tar.gz", want: gitHubAsset{Owner: "cli", Repo: "cli", Name: "gh.tar.gz"}},
+		{path: "/owner/repo/releases/download/v1/file%20name.zip", want: gitHubAsset{Owner: "owner", Repo: "repo", Tag: "v1", Name: "file name.zip"}},
+		{path: "/cli/cli/releases/latest", wantErr: true},
+		{path: "/cli/cli/archive/refs/tags/v1/x.tar.gz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseGitHubReleaseURL(mustParseURL(t, "https://github.com"+tt.path))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGitHubReleaseURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseGitHubReleaseURL() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultGitHubHosts(t *testing.T) {
+	tests := []struct {
+		name      string
+		apiURL    string
+		serverURL string
+		want      []GitHubHost
+	}{
+		{name: "github.com only", want: []GitHubHost{{Host: "github.com", APIURL: defaultGitHubAPIURL}}},
+		{
+			name:   "GHES from the API URL",
+			apiURL: "https://ghe.example.com/api/v3",
+			want: []GitHubHost{
+				{Host: "github.com", APIURL: defaultGitHubAPIURL},
+				{Host: "ghe.example.com", APIURL: "https://ghe.example.com/api/v3"},
+			},
+		},
+		{
+			name:      "GHES with a separate API host",
+			apiURL:    "https://api.ghe.example.com",
+			serverURL: "https://ghe.example.com",
+			want: []GitHubHost{
+				{Host: "github.com", APIURL: defaultGitHubAPIURL},
+				{Host: "ghe.example.com", APIURL: "https://api.ghe.example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_API_URL", tt.apiURL)
+			t.Setenv("GITHUB_SERVER_URL", tt.serverURL)
+			got := defaultGitHubHosts()
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("defaultGitHubHosts() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// gitHubServer stands in for a GitHub Enterprise Server: the API lives under /api/v3
+type gitHubServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string]int // API path -> number of requests
+}
+
+func newGitHubServer(t *testing.T, releases map[string]string, assets map[string]string) *gitHubServer {
+	t.Helper()
+	gh := &gitHubServer{requests: make(map[string]int)}
+	gh.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gh.mu.Lock()
+		gh.requests[r.URL.Path]++
+		gh.mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer ghes-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if body, ok := releases[r.URL.Path]; ok {
+			_, _ = w.Write([]byte(body))
+			return
+		}
+		if body, ok := assets[r.URL.Path]; ok && r.Header.Get("Accept") == "application/octet-stream" {
+			_, _ = w.Write([]byte(body))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(gh.Close)
+	return gh
+}
+
+func (gh *gitHubServer) count(path string) int {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	return gh.requests[path]
+}
+
+func TestGetChecksum_GitHubEnterprise(t *testing.T) {
+	var assets strings.Builder
+	for i := range 20 {
+		if i > 0 {
+			assets.WriteString(",")
+		}
+		fmt.Fprintf(&assets, `{"id":%d,"name":"tool_%d.tar.gz","digest":"sha256:%064d"}`, i+1, i, i)
+	}
+	assets.WriteString(`,{"id":99,"name":"legacy.tar.gz","digest":""}`)
+	release := `{"tag_name":"v1.2.3","assets":[` + assets.String() + `]}`
+
+	gh := newGitHubServer(t,
+		map[string]string{
+			"/api/v3/repos/acme/tool/releases/tags/v1.2.3": release,
+			"/api/v3/repos/acme/tool/releases/latest":      release,
+		},
+		map[string]string{"/api/v3/repos/acme/tool/releases/assets/99": "legacy asset"},
+	)
+	host := mustParseURL(t, gh.URL).Hostname()
+	client := NewClient(
+		WithGitHubHosts(GitHubHost{Host: host, APIURL: gh.URL + "/api/v3"}),
+		WithCredentials(Credential{Host: host, Token: "ghes-token"}),
+	)
+
+	t.Run("one API call per release", func(t *testing.T) {
+		g, ctx := errgroup.WithContext(context.Background())
+		var resolved atomic.Int32
+		for i := range 20 {
+			g.Go(func() error {
+				rawURL := fmt.Sprintf("%s/acme/tool/releases/download/v1.2.3/tool_%d.tar.gz", gh.URL, i)
+				// Each source gets its own copy, as in pin
+				result, err := client.WithProgressFactory(nil).GetChecksumWithHeaders(ctx, rawURL)
+				if err != nil {
+					return err
+				}
+				if want := fmt.Sprintf("sha256:%064d", i); result.Checksum != want {
+					return fmt.Errorf("%s: checksum %s, want %s", rawURL, result.Checksum, want)
+				}
+				resolved.Add(1)
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if n := gh.count("/api/v3/repos/acme/tool/releases/tags/v1.2.3"); n != 1 {
+			t.Errorf("release API called %d times for %d assets, want 1", n, resolved.Load())
+		}
+	})
+
+	t.Run("asset without digest is downloaded by ID", func(t *testing.T) {
+		result, err := client.GetChecksumWithHeaders(context.Background(), gh.URL+"/acme/tool/releases/download/v1.2.3/legacy.tar.gz")
+		if err != nil {
+			t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+		}
+		if want := "sha256:" + sha256Hex([]byte("legacy asset")); result.Checksum != want {
+			t.Errorf("Checksum = %s, want %s", result.Checksum, want)
+		}
+		if len(result.Headers) != 0 {
+			t.Errorf("Headers = %v, want none (the API request headers are not part of the source)", result.Headers)
+		}
+	})
+
+	t.Run("latest is resolved and flagged as mutable", func(t *testing.T) {
+		result, err := client.GetChecksumWithHeaders(context.Background(), gh.URL+"/acme/tool/releases/latest/download/tool_3.tar.gz")
+		if err != nil {
+			t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+		}
+		if want := fmt.Sprintf("sha256:%064d", 3); result.Checksum != want {
+			t.Errorf("Checksum = %s, want %s", result.Checksum, want)
+		}
+		if !strings.Contains(result.MutableReason, "v1.2.3") {
+			t.Errorf("MutableReason = %q, want it to name the release latest resolved to", result.MutableReason)
+		}
+		if want := gh.URL + "/acme/tool/releases/download/v1.2.3/tool_3.tar.gz"; result.StableURL != want {
+			t.Errorf("StableURL = %s, want %s", result.StableURL, want)
+		}
+	})
+
+	t.Run("tagged release is not mutable", func(t *testing.T) {
+		result, err := client.GetChecksumWithHeaders(context.Background(), gh.URL+"/acme/tool/releases/download/v1.2.3/tool_0.tar.gz")
+		if err != nil {
+			t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+		}
+		if result.MutableReason != "" {
+			t.Errorf("MutableReason = %q, want empty", result.MutableReason)
+		}
+	})
+}
+
+func TestReleaseCache(t *testing.T) {
+	cache := &releaseCache{}
+	release := &GitHubRelease{TagName: "v1.0.0"}
+	outcomes := map[string][]error{
+		"ok":           {nil},
+		"missing":      {fmt.Errorf("GitHub API request failed: %w", errGitHubReleaseNotFound)},
+		"rate-limited": {&AuthError{StatusCode: http.StatusForbidden}, nil},
+		"flaky":        {errors.New("connection reset"), nil},
+	}
+	calls := make(map[string]int)
+
+	for key, results := range outcomes {
+		for attempt := range 3 {
+			got, err := cache.get(key, func() (*GitHubRelease, error) {
+				err := results[min(calls[key], len(results)-1)]
+				calls[key]++
+				if err != nil {
+					return nil, err
+				}
+				return release, nil
+			})
+			if want := results[min(attempt, len(results)-1)]; (err == nil) != (want == nil) {
+				t.Errorf("%s attempt %d: get() = %v, %v, want error %v", key, attempt, got, err, want)
+			}
+		}
+	}
+
+	// Successes and 404s are fetched once; other errors are retried until a lookup succeeds
+	want := map[string]int{"ok": 1, "missing": 1, "rate-limited": 2, "flaky": 2}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("fetch calls = %v, want %v", calls, want)
+	}
+}
+
+func TestGitHubToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiURL string
+		envAPI string
+		creds  []Credential
+		want   string
+	}{
+		{name: "github.com", apiURL: defaultGitHubAPIURL, want: "env-token"},
+		{name: "GHES of the Actions job", apiURL: "https://ghe.example.com/api/v3", envAPI: "https://ghe.example.com/api/v3", want: "env-token"},
+		{name: "other GHES", apiURL: "https://ghe.example.com/api/v3"},
+		{
+			name:   "configured credentials",
+			apiURL: "https://ghe.example.com/api/v3",
+			creds:  []Credential{{Host: "ghe.example.com", Token: "ghes-token"}},
+			want:   "ghes-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_TOKEN", "env-token")
+			t.Setenv("GITHUB_API_URL", tt.envAPI)
+			if got := NewClient(WithCredentials(tt.creds...)).gitHubToken(tt.apiURL); got != tt.want {
+				t.Errorf("gitHubToken(%s) = %q, want %q", tt.apiURL, got, tt.want)
+			}
+		})
+	}
+}
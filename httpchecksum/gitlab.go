@@ -0,0 +1,285 @@
+package httpchecksum
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/wharflab/container-source-policy/internal/version"
+)
+
+const defaultGitLabAPIURL = "https://gitlab.com/api/v4"
+
+// GitLabHost maps a GitLab web host to its REST API
+type GitLabHost struct {
+	// Host is the hostname release and package downloads are served from (e.g., gitlab.example.com)
+	Host string
+	// APIURL is the REST API root; empty means https://<Host>/api/v4
+	APIURL string
+}
+
+// WithGitLabHosts registers self-managed GitLab hosts whose generic packages and release links are looked up
+// through their API. gitlab.com and, in GitLab CI, the instance of CI_API_V4_URL are registered by default.
+func WithGitLabHosts(hosts ...GitLabHost) Option {
+	return func(c *Client) {
+		if c.gitlabHosts == nil {
+			c.gitlabHosts = make(map[string]GitLabHost)
+		}
+		for _, host := range hosts {
+			host.APIURL = strings.TrimSuffix(cmp.Or(host.APIURL, "https://"+host.Host+"/api/v4"), "/")
+			c.gitlabHosts[strings.ToLower(host.Host)] = host
+		}
+	}
+}
+
+// defaultGitLabHosts returns gitlab.com and the instance a GitLab CI job runs on
+func defaultGitLabHosts() []GitLabHost {
+	hosts := []GitLabHost{{Host: "gitlab.com", APIURL: defaultGitLabAPIURL}}
+	apiURL := os.Getenv("CI_API_V4_URL")
+	if apiURL == "" {
+		return hosts
+	}
+	parsed, err := url.Parse(apiURL)
+	if err != nil || parsed.Hostname() == "" {
+		return hosts
+	}
+	return append(hosts, GitLabHost{Host: cmp.Or(os.Getenv("CI_SERVER_HOST"), parsed.Hostname()), APIURL: apiURL})
+}
+
+// gitLabAPIURL returns the API root for a GitLab host
+func (c *Client) gitLabAPIURL(host string) (string, bool) {
+	gl, ok := c.gitlabHosts[strings.ToLower(host)]
+	return gl.APIURL, ok
+}
+
+// setGitLabToken authenticates an API request with the configured credentials of the API host,
+// GITLAB_TOKEN (a personal, project or group access token) for gitlab.com, or CI_JOB_TOKEN for the
+// instance the GitLab CI job runs on
+func (c *Client) setGitLabToken(req *http.Request) {
+	host := strings.ToLower(req.URL.Hostname())
+	if cred, ok := c.credentials[host]; ok && cred.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cred.Token)
+	} else if token := os.Getenv("GITLAB_TOKEN"); token != "" && host == "gitlab.com" {
+		req.Header.Set("Private-Token", token)
+	} else if token := os.Getenv("CI_JOB_TOKEN"); token != "" && isCIServerHost(host) {
+		req.Header.Set("Job-Token", token)
+	}
+}
+
+// isCIServerHost reports whether host is the GitLab instance of the CI job (CI_SERVER_HOST or the CI_API_V4_URL host)
+func isCIServerHost(host string) bool {
+	if serverHost := os.Getenv("CI_SERVER_HOST"); serverHost != "" && strings.EqualFold(serverHost, host) {
+		return true
+	}
+	apiURL, err := url.Parse(os.Getenv("CI_API_V4_URL"))
+	return err == nil && apiURL.Hostname() != "" && strings.EqualFold(apiURL.Hostname(), host)
+}
+
+// gitLabPackageFile is a generic package download:
+// <api>/projects/:id/packages/generic/:package_name/:package_version/:file_name
+type gitLabPackageFile struct {
+	Project string // project ID or URL-encoded path, as it appears in API URLs
+	Name    string
+	Version string
+	File    string
+}
+
+// parseGitLabPackageURL recognises a generic package download under apiURL
+func parseGitLabPackageURL(u *url.URL, apiURL string) (gitLabPackageFile, bool) {
+	api, err := url.Parse(apiURL)
+	if err != nil || !strings.EqualFold(u.Hostname(), api.Hostname()) {
+		return gitLabPackageFile{}, false
+	}
+	rest, ok := strings.CutPrefix(u.EscapedPath(), strings.TrimSuffix(api.EscapedPath(), "/")+"/projects/")
+	if !ok {
+		return gitLabPackageFile{}, false
+	}
+	parts := strings.SplitN(rest, "/", 6)
+	if len(parts) != 6 || parts[1] != "packages" || parts[2] != "generic" {
+		return gitLabPackageFile{}, false
+	}
+
+	unescaped := make([]string, 0, 3)
+	for _, part := range parts[3:] {
+		value, err := url.PathUnescape(part)
+		if err != nil || value == "" {
+			return gitLabPackageFile{}, false
+		}
+		unescaped = append(unescaped, value)
+	}
+	return gitLabPackageFile{Project: parts[0], Name: unescaped[0], Version: unescaped[1], File: unescaped[2]}, true
+}
+
+// gitLabReleaseAsset is a release asset link: /<project path>/-/releases/:tag/downloads/:filepath
+type gitLabReleaseAsset struct {
+	Project string // URL-encoded project path
+	Tag     string // URL-encoded tag
+}
+
+// parseGitLabReleaseURL recognises a release asset link
+func parseGitLabReleaseURL(u *url.URL) (gitLabReleaseAsset, bool) {
+	projectPath, rest, ok := strings.Cut(u.EscapedPath(), "/-/releases/")
+	if !ok {
+		return gitLabReleaseAsset{}, false
+	}
+	tag, filepath, ok := strings.Cut(rest, "/downloads/")
+	project, err := url.PathUnescape(strings.Trim(projectPath, "/"))
+	if !ok || err != nil || project == "" || tag == "" || filepath == "" {
+		return gitLabReleaseAsset{}, false
+	}
+	return gitLabReleaseAsset{Project: url.PathEscape(project), Tag: tag}, true
+}
+
+// isGitLabDownload reports whether a URL on a GitLab host is a generic package or release asset download
+func isGitLabDownload(u *url.URL, apiURL string) bool {
+	if _, ok := parseGitLabPackageURL(u, apiURL); ok {
+		return true
+	}
+	_, ok := parseGitLabReleaseURL(u)
+	return ok
+}
+
+// gitLabPackage is an entry of the packages API
+type gitLabPackage struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// gitLabPackageFileEntry is an entry of the package files API
+type gitLabPackageFileEntry struct {
+	ID         int64  `json:"id"`
+	FileName   string `json:"file_name"`
+	FileSHA256 string `json:"file_sha256"`
+}
+
+// gitLabRelease is the part of the releases API response that lists asset links
+type gitLabRelease struct {
+	Assets struct {
+		Links []struct {
+			Name           string `json:"name"`
+			URL            string `json:"url"`
+			DirectAssetURL string `json:"direct_asset_url"`
+		} `json:"links"`
+	} `json:"assets"`
+}
+
+// getChecksumFromGitLab looks up the file_sha256 GitLab stores for generic package files.
+// Release asset links are followed to the generic package they point to.
+func (c *Client) getChecksumFromGitLab(ctx context.Context, parsedURL *url.URL, apiURL string) (string, error) {
+	if pkg, ok := parseGitLabPackageURL(parsedURL, apiURL); ok {
+		return c.getGitLabPackageChecksum(ctx, apiURL, pkg)
+	}
+
+	asset, ok := parseGitLabReleaseURL(parsedURL)
+	if !ok {
+		return "", errors.New("invalid GitLab download URL format")
+	}
+	var release gitLabRelease
+	endpoint := fmt.Sprintf("%s/projects/%s/releases/%s", apiURL, asset.Project, asset.Tag)
+	if err := c.getGitLabJSON(ctx, endpoint, &release); err != nil {
+		return "", err
+	}
+
+	for _, link := range release.Assets.Links {
+		direct, err := url.Parse(link.DirectAssetURL)
+		if err != nil || direct.Path != parsedURL.Path {
+			continue
+		}
+		target, err := url.Parse(link.URL)
+		if err != nil {
+			return "", fmt.Errorf("invalid URL for release link %s: %w", link.Name, err)
+		}
+		targetAPI, ok := c.gitLabAPIURL(target.Hostname())
+		if !ok {
+			return "", fmt.Errorf("release link %s points outside GitLab (%s)", link.Name, target.Host)
+		}
+		pkg, ok := parseGitLabPackageURL(target, targetAPI)
+		if !ok {
+			return "", fmt.Errorf("release link %s does not point to a generic package", link.Name)
+		}
+		return c.getGitLabPackageChecksum(ctx, targetAPI, pkg)
+	}
+	return "", fmt.Errorf("release %s has no asset link for %s", asset.Tag, parsedURL.Path)
+}
+
+// getGitLabPackageChecksum returns the file_sha256 of the most recent upload of a generic package file,
+// which is the one GitLab serves
+func (c *Client) getGitLabPackageChecksum(ctx context.Context, apiURL string, pkg gitLabPackageFile) (string, error) {
+	query := url.Values{
+		"package_type":    {"generic"},
+		"package_name":    {pkg.Name},
+		"package_version": {pkg.Version},
+		"per_page":        {"100"},
+	}
+	var packages []gitLabPackage
+	endpoint := fmt.Sprintf("%s/projects/%s/packages?%s", apiURL, pkg.Project, query.Encode())
+	if err := c.getGitLabJSON(ctx, endpoint, &packages); err != nil {
+		return "", err
+	}
+
+	for _, candidate := range packages {
+		// package_name is a fuzzy filter
+		if candidate.Name != pkg.Name || candidate.Version != pkg.Version {
+			continue
+		}
+		var files []gitLabPackageFileEntry
+		endpoint := fmt.Sprintf("%s/projects/%s/packages/%d/package_files?per_page=100", apiURL, pkg.Project, candidate.ID)
+		if err := c.getGitLabJSON(ctx, endpoint, &files); err != nil {
+			return "", err
+		}
+		var latest *gitLabPackageFileEntry
+		for i := range files {
+			if files[i].FileName == pkg.File && (latest == nil || files[i].ID > latest.ID) {
+				latest = &files[i]
+			}
+		}
+		if latest == nil {
+			break
+		}
+		sum := strings.ToLower(latest.FileSHA256)
+		if len(sum) != 64 || !isHexString(sum) {
+			return "", fmt.Errorf("package file %s has no SHA256", pkg.File)
+		}
+		return "sha256:" + sum, nil
+	}
+	return "", fmt.Errorf("package file %s/%s/%s not found", pkg.Name, pkg.Version, pkg.File)
+}
+
+// getGitLabJSON sends an authenticated API request and decodes its JSON response into v
+func (c *Client) getGitLabJSON(ctx context.Context, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Accept", "application/json")
+	c.setGitLabToken(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// The API may need more access than the download (e.g., a public release of a project whose packages
+	// API is restricted), so a refusal only means the download is checksummed another way; whether the
+	// download itself needs credentials is decided when it is fetched
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: GitLab API request refused: %s", ErrNotApplicable, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitLab API request failed: %s", resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxMetadataSize)).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode GitLab API response: %w", err)
+	}
+	return nil
+}
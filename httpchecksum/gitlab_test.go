@@ -0,0 +1,266 @@
+package httpchecksum
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseGitLabURLs(t *testing.T) {
+	const apiURL = "https://gitlab.example.com/api/v4"
+
+	packageTests := []struct {
+		rawURL string
+		want   gitLabPackageFile
+		wantOK bool
+	}{
+		{
+			rawURL: "https://gitlab.example.com/api/v4/projects/42/packages/generic/tool/1.2.3/tool-linux-amd64.tar.gz",
+			want:   gitLabPackageFile{Project: "42", Name: "tool", Version: "1.2.3", File: "tool-linux-amd64.tar.gz"},
+			wantOK: true,
+		},
+		{
+			rawURL: "https://gitlab.example.com/api/v4/projects/group%2Fsub%2Fproject/packages/generic/tool/1.0/bin%20file",
+			want:   gitLabPackageFile{Project: "group%2Fsub%2Fproject", Name: "tool", Version: "1.0", File: "bin file"},
+			wantOK: true,
+		},
+		{rawURL: "https://gitlab.example.com/api/v4/projects/42/packages/npm/tool/1.0/tool.tgz"},
+		{rawURL: "https://other.example.com/api/v4/projects/42/packages/generic/tool/1.0/tool"},
+	}
+	for _, tt := range packageTests {
+		got, ok := parseGitLabPackageURL(mustParseURL(t, tt.rawURL), apiURL)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("parseGitLabPackageURL(%s) = %+v, %v, want %+v, %v", tt.rawURL, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	releaseTests := []struct {
+		rawURL string
+		want   gitLabReleaseAsset
+		wantOK bool
+	}{
+		{
+			rawURL: "https://gitlab.example.com/group/sub/project/-/releases/v1.0.0/downloads/bin/tool",
+			want:   gitLabReleaseAsset{Project: "group%2Fsub%2Fproject", Tag: "v1.0.0"},
+			wantOK: true,
+		},
+		{rawURL: "https://gitlab.example.com/group/project/-/releases/v1.0.0"},
+		{rawURL: "https://gitlab.example.com/group/project/-/archive/v1.0.0/project-v1.0.0.tar.gz"},
+	}
+	for _, tt := range releaseTests {
+		got, ok := parseGitLabReleaseURL(mustParseURL(t, tt.rawURL))
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("parseGitLabReleaseURL(%s) = %+v, %v, want %+v, %v", tt.rawURL, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// gitLabServer stands in for a self-managed GitLab instance with one project holding a generic package
+type gitLabServer struct {
+	*httptest.Server
+	mu               sync.Mutex
+	downloads        int
+	privateDownloads bool // downloads need the job token too
+}
+
+func newGitLabServer(t *testing.T, jobToken string) *gitLabServer {
+	t.Helper()
+	gl := &gitLabServer{}
+	mux := http.NewServeMux()
+	api := func(pattern, body string) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Job-Token") != jobToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(body))
+		})
+	}
+
+	api("GET /api/v4/projects/group%2Fproject/packages", `[
+		{"id": 7, "name": "tool-extras", "version": "1.2.3"},
+		{"id": 8, "name": "tool", "version": "1.2.3"}
+	]`)
+	api("GET /api/v4/projects/group%2Fproject/packages/8/package_files", `[
+		{"id": 100, "file_name": "tool.tar.gz", "file_sha256": "`+strings.Repeat("1", 64)+`"},
+		{"id": 101, "file_name": "tool.tar.gz", "file_sha256": "`+strings.Repeat("2", 64)+`"},
+		{"id": 102, "file_name": "legacy.tar.gz", "file_sha256": null}
+	]`)
+	mux.HandleFunc("GET /api/v4/projects/group%2Fproject/releases/v1.2.3", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Job-Token") != jobToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"assets": {"links": [{
+			"name": "tool.tar.gz",
+			"url": "` + gl.URL + `/api/v4/projects/group%2Fproject/packages/generic/tool/1.2.3/tool.tar.gz",
+			"direct_asset_url": "` + gl.URL + `/group/project/-/releases/v1.2.3/downloads/tool.tar.gz"
+		}]}}`))
+	})
+	mux.HandleFunc("GET /api/v4/projects/group%2Fproject/packages/generic/", func(w http.ResponseWriter, r *http.Request) {
+		gl.mu.Lock()
+		gl.downloads++
+		private := gl.privateDownloads
+		gl.mu.Unlock()
+		if private && r.Header.Get("Job-Token") != jobToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("legacy content"))
+	})
+
+	gl.Server = httptest.NewServer(mux)
+	t.Cleanup(gl.Close)
+	return gl
+}
+
+func TestGetChecksum_GitLab(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "")
+	t.Setenv("CI_JOB_TOKEN", "job-token")
+	gl := newGitLabServer(t, "job-token")
+	t.Setenv("CI_API_V4_URL", gl.URL+"/api/v4")
+	client := NewClient(WithGitLabHosts(GitLabHost{Host: mustParseURL(t, gl.URL).Hostname(), APIURL: gl.URL + "/api/v4"}))
+
+	tests := []struct {
+		name         string
+		path         string
+		wantChecksum string
+		wantDownload bool
+	}{
+		{
+			name:         "generic package uses the latest upload",
+			path:         "/api/v4/projects/group%2Fproject/packages/generic/tool/1.2.3/tool.tar.gz",
+			wantChecksum: "sha256:" + strings.Repeat("2", 64),
+		},
+		{
+			name:         "release link to a generic package",
+			path:         "/group/project/-/releases/v1.2.3/downloads/tool.tar.gz",
+			wantChecksum: "sha256:" + strings.Repeat("2", 64),
+		},
+		{
+			name:         "file without SHA256 is downloaded",
+			path:         "/api/v4/projects/group%2Fproject/packages/generic/tool/1.2.3/legacy.tar.gz",
+			wantChecksum: "sha256:" + sha256Hex([]byte("legacy content")),
+			wantDownload: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gl.mu.Lock()
+			gl.downloads = 0
+			gl.mu.Unlock()
+
+			result, err := client.GetChecksumWithHeaders(context.Background(), gl.URL+tt.path)
+			if err != nil {
+				t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+			}
+			if result.Checksum != tt.wantChecksum {
+				t.Errorf("Checksum = %s, want %s", result.Checksum, tt.wantChecksum)
+			}
+			gl.mu.Lock()
+			defer gl.mu.Unlock()
+			if (gl.downloads > 0) != tt.wantDownload {
+				t.Errorf("downloads = %d, want download %v", gl.downloads, tt.wantDownload)
+			}
+		})
+	}
+}
+
+func TestGetChecksum_GitLabUnauthorized(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "")
+	t.Setenv("CI_JOB_TOKEN", "")
+	gl := newGitLabServer(t, "job-token")
+	client := NewClient(WithGitLabHosts(GitLabHost{Host: mustParseURL(t, gl.URL).Hostname(), APIURL: gl.URL + "/api/v4"}))
+	downloadURL := gl.URL + "/api/v4/projects/group%2Fproject/packages/generic/tool/1.2.3/tool.tar.gz"
+
+	// A refused API request falls through to downloading the file
+	result, err := client.GetChecksumWithHeaders(context.Background(), downloadURL)
+	if err != nil {
+		t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+	}
+	if want := "sha256:" + sha256Hex([]byte("legacy content")); result.Checksum != want {
+		t.Errorf("Checksum = %s, want %s", result.Checksum, want)
+	}
+
+	// Only a refused download means the source needs credentials
+	gl.mu.Lock()
+	gl.privateDownloads = true
+	gl.mu.Unlock()
+	if _, err := client.GetChecksumWithHeaders(context.Background(), downloadURL); !IsAuthError(err) {
+		t.Fatalf("GetChecksumWithHeaders() error = %v, want AuthError", err)
+	}
+}
+
+func TestSetGitLabToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		gitlab     string
+		jobToken   string
+		serverHost string
+		apiURL     string
+		wantHeader string
+		wantValue  string
+	}{
+		{
+			name:       "GITLAB_TOKEN on gitlab.com",
+			url:        "https://gitlab.com/api/v4/projects",
+			gitlab:     "pat",
+			wantHeader: "Private-Token",
+			wantValue:  "pat",
+		},
+		{name: "GITLAB_TOKEN not sent elsewhere", url: "https://gitlab.example.com/api/v4/projects", gitlab: "pat"},
+		{
+			name:       "job token on the CI server",
+			url:        "https://gitlab.example.com/api/v4/projects",
+			jobToken:   "job",
+			serverHost: "gitlab.example.com",
+			wantHeader: "Job-Token",
+			wantValue:  "job",
+		},
+		{
+			name:       "job token on the CI API host",
+			url:        "https://gitlab-api.example.com/api/v4/projects",
+			jobToken:   "job",
+			apiURL:     "https://gitlab-api.example.com/api/v4",
+			wantHeader: "Job-Token",
+			wantValue:  "job",
+		},
+		{
+			name:       "job token not sent to other instances",
+			url:        "https://gitlab.com/api/v4/projects",
+			jobToken:   "job",
+			serverHost: "gitlab.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITLAB_TOKEN", tt.gitlab)
+			t.Setenv("CI_JOB_TOKEN", tt.jobToken)
+			t.Setenv("CI_SERVER_HOST", tt.serverHost)
+			t.Setenv("CI_API_V4_URL", tt.apiURL)
+			// No configured credentials, so the environment is used
+			client := &Client{}
+			req, err := http.NewRequest(http.MethodGet, tt.url, http.NoBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.setGitLabToken(req)
+			for _, header := range []string{"Authorization", "Private-Token", "Job-Token"} {
+				want := ""
+				if header == tt.wantHeader {
+					want = tt.wantValue
+				}
+				if got := req.Header.Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package httpchecksum
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+
+	"github.com/wharflab/container-source-policy/internal/version"
+)
+
+// goModuleZip splits a module proxy zip path /<module>/@v/<version>.zip (case-encoded with "!")
+func goModuleZip(parsedURL *url.URL) (modPath, modVersion string, ok bool) {
+	escapedPath, file, ok := strings.Cut(strings.TrimPrefix(parsedURL.Path, "/"), "/@v/")
+	if !ok || !strings.HasSuffix(file, ".zip") {
+		return "", "", false
+	}
+	modPath, err := module.UnescapePath(escapedPath)
+	if err != nil {
+		return "", "", false
+	}
+	modVersion, err = module.UnescapeVersion(strings.TrimSuffix(file, ".zip"))
+	if err != nil {
+		return "", "", false
+	}
+	return modPath, modVersion, true
+}
+
+// getChecksumFromGoProxy looks up the module's h1: hash in the checksum database. The h1: hash covers
+// the files in the zip rather than the zip itself, so the zip is downloaded to compute its SHA-256
+// and verified against the hash.
+func (c *Client) getChecksumFromGoProxy(ctx context.Context, parsedURL *url.URL, rawURL, sumdbURL string) (*ChecksumResult, error) {
+	modPath, modVersion, ok := goModuleZip(parsedURL)
+	if !ok {
+		return nil, fmt.Errorf("not a module proxy zip URL: %s", parsedURL.Path)
+	}
+
+	want, err := c.lookupGoSum(ctx, sumdbURL, modPath, modVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "container-source-policy-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	result, err := c.download(ctx, rawURL, tmp)
+	if err != nil {
+		return nil, err
+	}
+	got, err := dirhash.HashZip(tmp.Name(), dirhash.Hash1)
+	if err != nil {
+		return nil, &IntegrityError{URL: rawURL, Reason: err.Error()}
+	}
+	if got != want {
+		return nil, &IntegrityError{
+			URL:    rawURL,
+			Reason: fmt.Sprintf("module zip hashes to %s, checksum database has %s", got, want),
+		}
+	}
+	return result, nil
+}
+
+// lookupGoSum returns the h1: hash of a module version, verified against the checksum database's signed tree
+func (c *Client) lookupGoSum(ctx context.Context, sumdbURL, modPath, modVersion string) (string, error) {
+	ops := &sumdbOps{ctx: ctx, client: c.httpClient, baseURL: strings.TrimSuffix(sumdbURL, "/"), key: c.goSumDBKey}
+	lines, err := sumdb.NewClient(ops).Lookup(modPath, modVersion)
+	if err != nil {
+		return "", fmt.Errorf("checksum database lookup of %s@%s failed: %w", modPath, modVersion, err)
+	}
+	prefix := modPath + " " + modVersion + " "
+	for _, line := range lines {
+		if hash, ok := strings.CutPrefix(line, prefix); ok {
+			return hash, nil
+		}
+	}
+	return "", fmt.Errorf("checksum database has no hash for %s@%s", modPath, modVersion)
+}
+
+// sumdbOps implements sumdb.ClientOps for a single lookup, without a persistent cache
+type sumdbOps struct {
+	ctx     context.Context
+	client  *http.Client
+	baseURL string
+	key     string
+
+	mu     sync.Mutex
+	latest []byte
+}
+
+func (o *sumdbOps) ReadRemote(path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(o.ctx, http.MethodGet, o.baseURL+path, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, &AuthError{URL: o.baseURL + path, StatusCode: resp.StatusCode}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+}
+
+func (o *sumdbOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.key), nil
+	}
+	if strings.HasSuffix(file, "/latest") {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		return o.latest, nil
+	}
+	return nil, fmt.Errorf("unknown config %s", file)
+}
+
+func (o *sumdbOps) WriteConfig(_ string, old, newData []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !bytes.Equal(old, o.latest) {
+		return sumdb.ErrWriteConflict
+	}
+	o.latest = newData
+	return nil
+}
+
+func (o *sumdbOps) ReadCache(string) ([]byte, error) {
+	return nil, errors.New("no cache")
+}
+
+func (o *sumdbOps) WriteCache(string, []byte) {}
+
+func (o *sumdbOps) Log(string) {}
+
+// SecurityError is reported as a Lookup error as well, which is where we surface it
+func (o *sumdbOps) SecurityError(string) {}
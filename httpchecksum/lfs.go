@@ -0,0 +1,188 @@
+package httpchecksum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/wharflab/container-source-policy/internal/version"
+)
+
+// Git LFS pointer files are tiny text files; anything larger is real content
+const maxLFSPointerSize = 1024
+
+// huggingFaceHosts serve /resolve/<revision>/<file> URLs that redirect LFS files to a CDN
+var huggingFaceHosts = map[string]bool{
+	"huggingface.co": true,
+	"hf.co":          true,
+}
+
+// huggingFaceFile is a parsed https://huggingface.co/<repo>/resolve/<revision>/<file> URL
+type huggingFaceFile struct {
+	// Repo is the repository path, including the datasets/ or spaces/ prefix
+	Repo     string
+	Revision string
+	Path     string
+}
+
+// parseHuggingFaceURL parses Hub file URLs: /<repo>/resolve/<revision>/<file>, where <repo> is
+// <owner>/<name>, a legacy single <name>, or either prefixed with datasets/ or spaces/
+func parseHuggingFaceURL(u *url.URL) (huggingFaceFile, bool) {
+	if !huggingFaceHosts[u.Hostname()] {
+		return huggingFaceFile{}, false
+	}
+	// Revisions like refs/pr/1 are written escaped (refs%2Fpr%2F1), keep them as one segment
+	segments := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		if segment != "resolve" || i == 0 || i+2 >= len(segments) {
+			continue
+		}
+		revision, err := url.PathUnescape(segments[i+1])
+		if err != nil {
+			return huggingFaceFile{}, false
+		}
+		return huggingFaceFile{
+			Repo:     strings.Join(segments[:i], "/"),
+			Revision: revision,
+			Path:     strings.Join(segments[i+2:], "/"),
+		}, true
+	}
+	return huggingFaceFile{}, false
+}
+
+// mutableReason explains why the file may change, or returns "" for URLs pinned to a commit
+func (f huggingFaceFile) mutableReason() string {
+	if len(f.Revision) == 40 && isHexString(f.Revision) {
+		return ""
+	}
+	return fmt.Sprintf("Hugging Face revision %q is not a commit; branches such as main move when the repository is updated", f.Revision)
+}
+
+// getChecksumFromHuggingFace reads the LFS SHA256 the Hub advertises in X-Linked-Etag on the redirect
+// it returns for LFS files, without following the redirect to the CDN
+func (c *Client) getChecksumFromHuggingFace(ctx context.Context, rawURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	noRedirect := *c.httpClient
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", &AuthError{URL: rawURL, StatusCode: resp.StatusCode}
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("HEAD request failed: %s", resp.Status)
+	}
+
+	// Only LFS files carry X-Linked-Etag (the SHA256 of the content) and X-Linked-Size;
+	// small files stored in git have a SHA-1 ETag and need to be downloaded
+	linked := strings.TrimPrefix(resp.Header.Get("X-Linked-Etag"), "W/")
+	linked = strings.ToLower(strings.Trim(linked, `"`))
+	if !isSHA256Hex(linked) {
+		return "", errors.New("no X-Linked-Etag header (not an LFS file)")
+	}
+	if size := resp.Header.Get("X-Linked-Size"); size != "" {
+		if _, err := strconv.ParseInt(size, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid X-Linked-Size %q", size)
+		}
+	}
+	return "sha256:" + linked, nil
+}
+
+// lfsPointerURL returns where the Git LFS pointer of an LFS-served file can be read.
+// GitHub serves LFS content from media.githubusercontent.com/media/<owner>/<repo>/<ref>/<path>
+// and the pointer file itself from raw.githubusercontent.com/<owner>/<repo>/<ref>/<path>.
+func lfsPointerURL(u *url.URL) (string, bool) {
+	if u.Host != "media.githubusercontent.com" {
+		return "", false
+	}
+	path, ok := strings.CutPrefix(u.EscapedPath(), "/media/")
+	if !ok {
+		return "", false
+	}
+	return "https://raw.githubusercontent.com/" + path, true
+}
+
+// getChecksumFromLFSPointer reads the oid of the Git LFS pointer committed in place of the file
+func (c *Client) getChecksumFromLFSPointer(ctx context.Context, pointerURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pointerURL, http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", &AuthError{URL: pointerURL, StatusCode: resp.StatusCode}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("LFS pointer request failed: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxLFSPointerSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxLFSPointerSize {
+		return "", errors.New("not a Git LFS pointer")
+	}
+	oid, _, err := parseLFSPointer(data)
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + oid, nil
+}
+
+// parseLFSPointer parses a Git LFS pointer file and returns its sha256 oid and size:
+//
+//	version https://git-lfs.github.com/spec/v1
+//	oid sha256:<hex>
+//	size <bytes>
+func parseLFSPointer(data []byte) (oid string, size int64, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "version https://git-lfs.github.com/spec/") {
+		return "", 0, errors.New("not a Git LFS pointer")
+	}
+	size = -1
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "oid":
+			hash, ok := strings.CutPrefix(value, "sha256:")
+			if !ok || !isSHA256Hex(hash) {
+				return "", 0, fmt.Errorf("unsupported LFS oid %q", value)
+			}
+			oid = strings.ToLower(hash)
+		case "size":
+			if size, err = strconv.ParseInt(value, 10, 64); err != nil || size < 0 {
+				return "", 0, fmt.Errorf("invalid LFS size %q", value)
+			}
+		}
+	}
+	if oid == "" || size < 0 {
+		return "", 0, errors.New("LFS pointer is missing oid or size")
+	}
+	return oid, size, nil
+}
@@ -0,0 +1,224 @@
+package httpchecksum
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseHuggingFaceURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawURL  string
+		want    huggingFaceFile
+		wantOK  bool
+		mutable bool
+	}{
+		{
+			name:    "model on main",
+			rawURL:  "https://huggingface.co/org/model/resolve/main/model.safetensors",
+			want:    huggingFaceFile{Repo: "org/model", Revision: "main", Path: "model.safetensors"},
+			wantOK:  true,
+			mutable: true,
+		},
+		{
+			name:   "model at commit",
+			rawURL: "https://huggingface.co/org/model/resolve/0123456789abcdef0123456789abcdef01234567/onnx/model.onnx?download=true",
+			want: huggingFaceFile{
+				Repo:     "org/model",
+				Revision: "0123456789abcdef0123456789abcdef01234567",
+				Path:     "onnx/model.onnx",
+			},
+			wantOK: true,
+		},
+		{
+			name:    "dataset with escaped PR revision",
+			rawURL:  "https://huggingface.co/datasets/org/data/resolve/refs%2Fpr%2F1/train.parquet",
+			want:    huggingFaceFile{Repo: "datasets/org/data", Revision: "refs/pr/1", Path: "train.parquet"},
+			wantOK:  true,
+			mutable: true,
+		},
+		{
+			name:    "legacy model name on hf.co",
+			rawURL:  "https://hf.co/gpt2/resolve/main/config.json",
+			want:    huggingFaceFile{Repo: "gpt2", Revision: "main", Path: "config.json"},
+			wantOK:  true,
+			mutable: true,
+		},
+		{
+			name:   "blob page is not a file URL",
+			rawURL: "https://huggingface.co/org/model/blob/main/model.safetensors",
+		},
+		{
+			name:   "other host",
+			rawURL: "https://example.com/org/model/resolve/main/model.safetensors",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := parseHuggingFaceURL(u)
+			if ok != tt.wantOK {
+				t.Fatalf("parseHuggingFaceURL() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("parseHuggingFaceURL() = %+v, want %+v", got, tt.want)
+			}
+			if ok && (got.mutableReason() != "") != tt.mutable {
+				t.Errorf("mutableReason() = %q, want mutable %v", got.mutableReason(), tt.mutable)
+			}
+		})
+	}
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	const oid = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	tests := []struct {
+		name     string
+		data     string
+		wantSize int64
+		wantErr  bool
+	}{
+		{
+			name:     "valid pointer",
+			data:     "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 1234\n",
+			wantSize: 1234,
+		},
+		{
+			name:    "regular file",
+			data:    "hello world\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing size",
+			data:    "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported oid",
+			data:    "version https://git-lfs.github.com/spec/v1\noid sha1:a94a8fe5ccb19ba61c4c0873d391e987982fbbd3\nsize 1\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOID, gotSize, err := parseLFSPointer([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLFSPointer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if gotOID != oid || gotSize != tt.wantSize {
+				t.Errorf("parseLFSPointer() = %s, %d, want %s, %d", gotOID, gotSize, oid, tt.wantSize)
+			}
+		})
+	}
+}
+
+// lfsTransport serves fake Hugging Face and GitHub LFS responses and records requests
+type lfsTransport struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (l *lfsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l.mu.Lock()
+	l.requests = append(l.requests, req.Method+" "+req.URL.Host+req.URL.Path)
+	l.mu.Unlock()
+
+	header := make(http.Header)
+	status := http.StatusOK
+	body := ""
+	switch req.URL.Host + req.URL.Path {
+	case "huggingface.co/org/model/resolve/main/model.safetensors":
+		status = http.StatusFound
+		header.Set("Location", "https://cdn-lfs.hf.co/repos/aa/bb/model.safetensors")
+		header.Set("X-Linked-Etag", `"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"`)
+		header.Set("X-Linked-Size", "3")
+	case "huggingface.co/org/model/resolve/main/config.json":
+		// Small files live in git: SHA-1 ETag, no X-Linked-* headers
+		header.Set("ETag", `"a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"`)
+		body = "{}\n"
+	case "raw.githubusercontent.com/org/repo/v1.0.0/weights.bin":
+		body = "version https://git-lfs.github.com/spec/v1\n" +
+			"oid sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae\nsize 3\n"
+	default:
+		status = http.StatusNotFound
+	}
+	if req.Method == http.MethodHead {
+		body = ""
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func TestGetChecksum_LFS(t *testing.T) {
+	tests := []struct {
+		name         string
+		rawURL       string
+		wantChecksum string
+		wantMutable  bool
+		wantRequests []string
+	}{
+		{
+			name:         "Hugging Face LFS file",
+			rawURL:       "https://huggingface.co/org/model/resolve/main/model.safetensors",
+			wantChecksum: "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+			wantMutable:  true,
+			wantRequests: []string{"HEAD huggingface.co/org/model/resolve/main/model.safetensors"},
+		},
+		{
+			name:         "Hugging Face file stored in git is downloaded",
+			rawURL:       "https://huggingface.co/org/model/resolve/main/config.json",
+			wantChecksum: "sha256:ca3d163bab055381827226140568f3bef7eaac187cebd76878e0b63e9e442356",
+			wantMutable:  true,
+			wantRequests: []string{
+				"HEAD huggingface.co/org/model/resolve/main/config.json",
+				"HEAD huggingface.co/org/model/resolve/main/config.json",
+				"GET huggingface.co/org/model/resolve/main/config.json",
+			},
+		},
+		{
+			name:         "GitHub LFS media URL uses the pointer",
+			rawURL:       "https://media.githubusercontent.com/media/org/repo/v1.0.0/weights.bin",
+			wantChecksum: "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+			wantRequests: []string{"GET raw.githubusercontent.com/org/repo/v1.0.0/weights.bin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &lfsTransport{}
+			client := &Client{httpClient: &http.Client{Transport: transport}}
+
+			result, err := client.GetChecksumWithHeaders(context.Background(), tt.rawURL)
+			if err != nil {
+				t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+			}
+			if result.Checksum != tt.wantChecksum {
+				t.Errorf("Checksum = %s, want %s", result.Checksum, tt.wantChecksum)
+			}
+			if (result.MutableReason != "") != tt.wantMutable {
+				t.Errorf("MutableReason = %q, want mutable %v", result.MutableReason, tt.wantMutable)
+			}
+			if strings.Join(transport.requests, "\n") != strings.Join(tt.wantRequests, "\n") {
+				t.Errorf("requests = %q, want %q", transport.requests, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package httpchecksum
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// DownloadLimitError indicates a download was stopped because the content is larger than the
+// maximum download size or the download budget is used up
+type DownloadLimitError struct {
+	URL    string
+	Reason string
+}
+
+func (e *DownloadLimitError) Error() string {
+	return fmt.Sprintf("download of %s stopped (%s)", e.URL, e.Reason)
+}
+
+// IsDownloadLimitError checks if an error is a download stopped by a size limit
+func IsDownloadLimitError(err error) bool {
+	var limitErr *DownloadLimitError
+	return errors.As(err, &limitErr)
+}
+
+// WithMaxDownloadSize stops downloads of content larger than size bytes with a DownloadLimitError
+// (0 means no limit). Checksums found without downloading are not affected.
+func WithMaxDownloadSize(size int64) Option {
+	return func(c *Client) {
+		c.maxDownloadSize = size
+	}
+}
+
+// WithDownloadBudget caps the bytes downloaded by the client and its WithProgressFactory copies, across all
+// lookups (0 means no limit); downloads that would go over it stop with a DownloadLimitError
+func WithDownloadBudget(total int64) Option {
+	return func(c *Client) {
+		c.budget = nil
+		if total > 0 {
+			c.budget = &downloadBudget{total: total}
+			c.budget.remaining.Store(total)
+		}
+	}
+}
+
+// WithTimeout bounds each request, including reading the response body (default 5 minutes)
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.httpClient.Timeout = timeout
+		}
+	}
+}
+
+// downloadBudget is the number of bytes left to download in a run
+type downloadBudget struct {
+	total     int64
+	remaining atomic.Int64
+}
+
+// reserve sets aside n bytes of the budget, failing when fewer are left
+func (b *downloadBudget) reserve(n int64) bool {
+	for {
+		remaining := b.remaining.Load()
+		if n > remaining {
+			return false
+		}
+		if b.remaining.CompareAndSwap(remaining, remaining-n) {
+			return true
+		}
+	}
+}
+
+// exceeded returns the error for a download that does not fit in the budget
+func (b *downloadBudget) exceeded(rawURL string) error {
+	return &DownloadLimitError{URL: rawURL, Reason: "download budget of " + humanize.Bytes(uint64(b.total)) + " used up"}
+}
+
+// downloadReservation is the part of the budget set aside for one download, so that concurrent downloads
+// cannot together go over the budget after each was checked against it
+type downloadReservation struct {
+	budget   *downloadBudget
+	mu       sync.Mutex
+	reserved int64 // set aside and not read yet
+}
+
+// charge accounts for n bytes read, from the reservation first and then from the rest of the budget.
+// It reports whether the budget still holds.
+func (r *downloadReservation) charge(n int64) bool {
+	if r == nil {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	covered := min(n, r.reserved)
+	r.reserved -= covered
+	if n == covered {
+		return true
+	}
+	return r.budget.remaining.Add(covered-n) >= 0
+}
+
+// release returns the unread part of the reservation to the budget
+func (r *downloadReservation) release() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.budget.remaining.Add(r.reserved)
+	r.reserved = 0
+}
+
+// checkDownloadSize rejects a download up front when its declared length is over the maximum download size
+func (c *Client) checkDownloadSize(rawURL string, contentLength int64) error {
+	if c.maxDownloadSize > 0 && contentLength > c.maxDownloadSize {
+		return &DownloadLimitError{URL: rawURL, Reason: fmt.Sprintf("%s is over the maximum download size of %s",
+			humanize.Bytes(uint64(contentLength)), humanize.Bytes(uint64(c.maxDownloadSize)))}
+	}
+	return nil
+}
+
+// reserveDownload sets aside the budget a download needs before it starts: its declared length or, without
+// one, the maximum download size (or what is left of the budget, if less). Downloads of unknown length
+// without a maximum size are charged as they are read. The caller releases the reservation when done.
+func (c *Client) reserveDownload(rawURL string, contentLength int64) (*downloadReservation, error) {
+	if c.budget == nil {
+		return nil, nil
+	}
+	size := contentLength
+	if size < 0 {
+		size = 0
+		if c.maxDownloadSize > 0 {
+			size = min(c.maxDownloadSize, c.budget.remaining.Load())
+		}
+	}
+	if !c.budget.reserve(size) {
+		return nil, c.budget.exceeded(rawURL)
+	}
+	return &downloadReservation{budget: c.budget, reserved: size}, nil
+}
+
+// limitDownload wraps a response body so reading stops at the maximum download size and the budget,
+// also for responses without Content-Length
+func (c *Client) limitDownload(rawURL string, body io.Reader, reservation *downloadReservation) io.Reader {
+	if c.maxDownloadSize <= 0 && reservation == nil {
+		return body
+	}
+	return &limitedDownload{client: c, url: rawURL, body: body, reservation: reservation}
+}
+
+// limitedDownload counts the bytes read from a download against the client's limits
+type limitedDownload struct {
+	client      *Client
+	url         string
+	body        io.Reader
+	reservation *downloadReservation
+	read        int64
+}
+
+func (d *limitedDownload) Read(p []byte) (int, error) {
+	n, err := d.body.Read(p)
+	d.read += int64(n)
+	if limit := d.client.maxDownloadSize; limit > 0 && d.read > limit {
+		reason := "content is over the maximum download size of " + humanize.Bytes(uint64(limit))
+		return n, &DownloadLimitError{URL: d.url, Reason: reason}
+	}
+	if !d.reservation.charge(int64(n)) {
+		return n, d.reservation.budget.exceeded(d.url)
+	}
+	return n, err
+}
@@ -0,0 +1,146 @@
+package httpchecksum
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSizedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("s", 10)))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("l", 100)))
+	})
+	mux.HandleFunc("/large-chunked", func(w http.ResponseWriter, r *http.Request) {
+		// Flushing before the body is written drops Content-Length
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(strings.Repeat("l", 100)))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetChecksum_MaxDownloadSize(t *testing.T) {
+	server := newSizedServer(t)
+	client := NewClient(WithMaxDownloadSize(50))
+
+	tests := []struct {
+		path      string
+		wantLimit bool
+	}{
+		{path: "/small"},
+		{path: "/large", wantLimit: true},
+		{path: "/large-chunked", wantLimit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := client.GetChecksumWithHeaders(context.Background(), server.URL+tt.path)
+			if tt.wantLimit {
+				if !IsDownloadLimitError(err) {
+					t.Errorf("GetChecksumWithHeaders() error = %v, want DownloadLimitError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("GetChecksumWithHeaders() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestGetChecksum_DownloadBudget(t *testing.T) {
+	server := newSizedServer(t)
+	client := NewClient(WithDownloadBudget(25))
+
+	for i := range 2 {
+		// Copies share the budget, as in pin
+		if _, err := client.WithProgressFactory(nil).GetChecksumWithHeaders(context.Background(), server.URL+"/small"); err != nil {
+			t.Fatalf("download %d: GetChecksumWithHeaders() error = %v", i+1, err)
+		}
+	}
+	_, err := client.GetChecksumWithHeaders(context.Background(), server.URL+"/small")
+	if !IsDownloadLimitError(err) {
+		t.Errorf("GetChecksumWithHeaders() error = %v, want DownloadLimitError once the budget is used up", err)
+	}
+}
+
+func TestGetChecksum_DownloadBudgetConcurrent(t *testing.T) {
+	body := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Headers go out first; the body only once the test lets it
+		w.Header().Set("Content-Length", "10")
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.(http.Flusher).Flush()
+		select {
+		case <-body:
+			_, _ = w.Write([]byte(strings.Repeat("s", 10)))
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	var once sync.Once
+	sendBodies := func() { once.Do(func() { close(body) }) }
+	t.Cleanup(sendBodies)
+	client := NewClient(WithDownloadBudget(25))
+
+	const downloads = 5
+	errs := make(chan error, downloads)
+	for i := range downloads {
+		go func() {
+			rawURL := fmt.Sprintf("%s/%d", server.URL, i)
+			_, err := client.WithProgressFactory(nil).GetChecksumWithHeaders(context.Background(), rawURL)
+			errs <- err
+		}()
+	}
+
+	// Downloads that do not fit are refused from their Content-Length, before any body arrives
+	timeout := time.After(5 * time.Second)
+	for range downloads - 2 {
+		select {
+		case err := <-errs:
+			if !IsDownloadLimitError(err) {
+				t.Fatalf("GetChecksumWithHeaders() error = %v, want DownloadLimitError", err)
+			}
+		case <-timeout:
+			t.Fatal("downloads over the budget were not refused up front")
+		}
+	}
+	sendBodies()
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Errorf("GetChecksumWithHeaders() error = %v, want the two downloads that fit to succeed", err)
+		}
+	}
+}
+
+func TestGetChecksum_Timeout(t *testing.T) {
+	server := newSizedServer(t)
+	client := NewClient(WithTimeout(50 * time.Millisecond))
+
+	start := time.Now()
+	if _, err := client.GetChecksumWithHeaders(context.Background(), server.URL+"/slow"); err == nil {
+		t.Fatal("GetChecksumWithHeaders() succeeded, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("GetChecksumWithHeaders() took %v, want it to stop at the timeout", elapsed)
+	}
+}
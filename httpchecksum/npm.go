@@ -0,0 +1,143 @@
+package httpchecksum
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1" //nolint:gosec // only to verify legacy npm shasum values
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wharflab/container-source-policy/internal/version"
+)
+
+// npmVersion is the part of an npm version document (GET /<package>/<version>) we use
+type npmVersion struct {
+	Dist struct {
+		// Integrity is a Subresource Integrity string, usually sha512-<base64>
+		Integrity string `json:"integrity"`
+		// Shasum is the hex SHA-1 of the tarball, the only digest of old packages
+		Shasum string `json:"shasum"`
+	} `json:"dist"`
+}
+
+// npmTarball splits a tarball path /<package>/-/<name>-<version>.tgz, where <package>
+// may be scoped (@scope/name, or @scope%2fname)
+func npmTarball(parsedURL *url.URL) (pkg, ver string, ok bool) {
+	pkgPath, file, ok := strings.Cut(strings.TrimPrefix(parsedURL.EscapedPath(), "/"), "/-/")
+	if !ok || strings.Contains(file, "/") || !strings.HasSuffix(file, ".tgz") {
+		return "", "", false
+	}
+	pkg, err := url.PathUnescape(pkgPath)
+	if err != nil {
+		return "", "", false
+	}
+	name := pkg[strings.LastIndex(pkg, "/")+1:]
+	ver, ok = strings.CutPrefix(strings.TrimSuffix(file, ".tgz"), name+"-")
+	if !ok || ver == "" {
+		return "", "", false
+	}
+	return pkg, ver, true
+}
+
+// getChecksumFromNPM looks up the tarball's dist.integrity. npm publishes SHA-512 rather than SHA-256,
+// so the tarball is downloaded and the published digest verified while computing the SHA-256.
+func (c *Client) getChecksumFromNPM(ctx context.Context, parsedURL *url.URL, rawURL, registryURL string) (*ChecksumResult, error) {
+	pkg, ver, ok := npmTarball(parsedURL)
+	if !ok {
+		return nil, fmt.Errorf("not an npm tarball URL: %s", parsedURL.Path)
+	}
+	// Scoped packages are addressed as @scope%2fname
+	metadataURL := strings.TrimSuffix(registryURL, "/") + "/" + strings.Replace(pkg, "/", "%2f", 1) + "/" + url.PathEscape(ver)
+
+	dist, err := c.fetchNPMVersion(ctx, metadataURL)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, want, newHash, err := npmDigest(dist)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == "sha256" {
+		return &ChecksumResult{Checksum: "sha256:" + hex.EncodeToString(want), Headers: make(map[string]string)}, nil
+	}
+
+	verifier := newHash()
+	result, err := c.download(ctx, rawURL, verifier)
+	if err != nil {
+		return nil, err
+	}
+	if got := verifier.Sum(nil); !bytes.Equal(got, want) {
+		return nil, &IntegrityError{
+			URL:    rawURL,
+			Reason: fmt.Sprintf("%s %x does not match the npm registry's %x", algorithm, got, want),
+		}
+	}
+	return result, nil
+}
+
+func (c *Client) fetchNPMVersion(ctx context.Context, metadataURL string) (*npmVersion, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Like the PyPI simple index: the download decides whether credentials are needed
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: npm registry request refused: %s", ErrNotApplicable, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("npm registry request failed: %s", resp.Status)
+	}
+
+	var doc npmVersion
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxMetadataSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse npm registry response: %w", err)
+	}
+	return &doc, nil
+}
+
+// npmDigest picks the digest to check a version against: a published sha256 (which saves the download),
+// then the strongest SRI integrity value, then the legacy hex shasum (SHA-1)
+func npmDigest(doc *npmVersion) (algorithm string, digest []byte, newHash func() hash.Hash, err error) {
+	integrity := make(map[string][]byte)
+	for entry := range strings.FieldsSeq(doc.Dist.Integrity) {
+		alg, value, _ := strings.Cut(entry, "-")
+		if decoded, decodeErr := base64.StdEncoding.DecodeString(value); decodeErr == nil {
+			integrity[alg] = decoded
+		}
+	}
+	for _, candidate := range []struct {
+		algorithm string
+		newHash   func() hash.Hash
+	}{
+		{"sha256", sha256.New},
+		{"sha512", sha512.New},
+		{"sha384", sha512.New384},
+	} {
+		if decoded, ok := integrity[candidate.algorithm]; ok && len(decoded) == candidate.newHash().Size() {
+			return candidate.algorithm, decoded, candidate.newHash, nil
+		}
+	}
+	if shasum, decodeErr := hex.DecodeString(doc.Dist.Shasum); decodeErr == nil && len(shasum) == sha1.Size {
+		return "sha1", shasum, sha1.New, nil
+	}
+	return "", nil, nil, fmt.Errorf("npm registry publishes no usable digest (integrity %q)", doc.Dist.Integrity)
+}
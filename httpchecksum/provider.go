@@ -0,0 +1,347 @@
+package httpchecksum
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/wharflab/container-source-policy/internal/version"
+)
+
+// ErrNotApplicable is returned by a Provider that does not handle a URL
+var ErrNotApplicable = errors.New("provider does not apply")
+
+// Provider obtains the checksum of a URL, typically without downloading it.
+//
+// Checksum returns ErrNotApplicable when the provider does not handle the URL (or the HEAD
+// response). Other errors also move on to the next provider, except AuthError,
+// VolatileContentError, SidecarSignatureError and IntegrityError, which stop the lookup:
+// those mean the URL must not be pinned at all.
+type Provider interface {
+	Checksum(ctx context.Context, lookup *Lookup) (*ChecksumResult, error)
+}
+
+// Priorities of the built-in providers. Providers run from the highest priority to the lowest;
+// a custom provider registered with the same priority as a built-in one runs first.
+const (
+	PriorityGitHubRelease     = 1000
+	PriorityGitLab            = 950
+	PriorityHuggingFace       = 900
+	PriorityRegistry          = 800
+	PriorityLFSPointer        = 700
+	PriorityDigestFields      = 600
+	PriorityS3                = 500
+	PriorityRepositoryManager = 400
+	PriorityETag              = 300
+	PrioritySidecar           = 200
+	// PriorityDownload is the fallback that downloads and hashes the content; it always applies
+	PriorityDownload = 0
+)
+
+// Lookup is the URL being checksummed, shared by the providers tried for it
+type Lookup struct {
+	// URL is the parsed URL
+	URL *url.URL
+	// RawURL is the URL as given to the Client
+	RawURL string
+
+	client *Client
+
+	headOnce sync.Once
+	headReq  *http.Request
+	headResp *http.Response
+	headErr  error
+}
+
+// HTTPClient returns the HTTP client providers should use for their own requests
+func (l *Lookup) HTTPClient() *http.Client {
+	return l.client.httpClient
+}
+
+// Head returns the response to a HEAD request for the URL, made once and shared by all providers.
+// The response body is closed. The request asks for S3 checksums and RFC 9530 digest fields.
+func (l *Lookup) Head(ctx context.Context) (*http.Response, error) {
+	l.headOnce.Do(func() {
+		l.headResp, l.headErr = l.head(ctx)
+	})
+	return l.headResp, l.headErr
+}
+
+func (l *Lookup) head(ctx context.Context) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, l.RawURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set User-Agent to identify the tool making requests
+	// Matches BuildKit's convention: "buildkit/{version}"
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	// Request S3 checksums if available (this header is ignored by non-S3 servers)
+	req.Header.Set("X-Amz-Checksum-Mode", "ENABLED")
+	// Ask standards-compliant servers for a SHA-256 digest field (RFC 9530 and legacy RFC 3230)
+	req.Header.Set("Want-Repr-Digest", "sha-256=10")
+	req.Header.Set("Want-Digest", "sha-256")
+	l.headReq = req
+
+	resp, err := l.client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+
+	// Handle authentication errors gracefully
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, &AuthError{URL: l.RawURL, StatusCode: resp.StatusCode}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HEAD request failed: %s", resp.Status)
+	}
+
+	// Check cacheability before processing - volatile content should not be pinned
+	if err := checkCacheability(l.RawURL, resp.Header); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// complete fills in the Vary-derived headers of a result obtained from the HEAD response
+func (l *Lookup) complete(result *ChecksumResult) *ChecksumResult {
+	if result.Headers != nil {
+		return result
+	}
+	if l.headResp != nil {
+		result.Headers = extractVaryHeaders(l.headReq.Header, l.headResp.Header)
+	} else {
+		result.Headers = make(map[string]string)
+	}
+	return result
+}
+
+// WithProvider registers a custom checksum provider, tried in priority order
+// along with the built-in ones (see the Priority constants)
+func WithProvider(provider Provider, priority int) Option {
+	return func(c *Client) {
+		c.providers = append(c.providers, prioritizedProvider{Provider: provider, priority: priority})
+	}
+}
+
+type prioritizedProvider struct {
+	Provider
+	priority int
+}
+
+// clientProvider adapts a built-in strategy to Provider. It runs against the Client the
+// lookup was started from, which may be a WithProgressFactory copy.
+type clientProvider func(c *Client, ctx context.Context, lookup *Lookup) (*ChecksumResult, error)
+
+func (f clientProvider) Checksum(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	return f(lookup.client, ctx, lookup)
+}
+
+// builtinProviders are the strategies every Client starts with
+var builtinProviders = []prioritizedProvider{
+	{clientProvider((*Client).gitHubReleaseProvider), PriorityGitHubRelease},
+	{clientProvider((*Client).gitLabProvider), PriorityGitLab},
+	{clientProvider((*Client).huggingFaceProvider), PriorityHuggingFace},
+	{clientProvider((*Client).registryProvider), PriorityRegistry},
+	{clientProvider((*Client).lfsPointerProvider), PriorityLFSPointer},
+	{clientProvider((*Client).digestFieldsProvider), PriorityDigestFields},
+	{clientProvider((*Client).s3Provider), PriorityS3},
+	{clientProvider((*Client).repositoryManagerProvider), PriorityRepositoryManager},
+	{clientProvider((*Client).etagProvider), PriorityETag},
+	{clientProvider((*Client).sidecarProvider), PrioritySidecar},
+	{clientProvider((*Client).downloadProvider), PriorityDownload},
+}
+
+// headerProviders are the built-in providers that only read the HEAD response
+var headerProviders = []Provider{
+	clientProvider((*Client).digestFieldsProvider),
+	clientProvider((*Client).s3Provider),
+	clientProvider((*Client).repositoryManagerProvider),
+	clientProvider((*Client).etagProvider),
+}
+
+// orderedProviders returns the custom and built-in providers, highest priority first
+func (c *Client) orderedProviders() []Provider {
+	all := slices.Concat(c.providers, builtinProviders)
+	slices.SortStableFunc(all, func(a, b prioritizedProvider) int {
+		return cmp.Compare(b.priority, a.priority)
+	})
+	providers := make([]Provider, len(all))
+	for i, p := range all {
+		providers[i] = p.Provider
+	}
+	return providers
+}
+
+// runProviders returns the first checksum a provider finds. When none does, it returns
+// the last error other than ErrNotApplicable.
+func (c *Client) runProviders(ctx context.Context, lookup *Lookup, providers []Provider) (*ChecksumResult, error) {
+	lastErr := fmt.Errorf("no usable checksum found for %s", lookup.RawURL)
+	for _, provider := range providers {
+		result, err := provider.Checksum(ctx, lookup)
+		if err == nil && result != nil && result.Checksum != "" {
+			return lookup.complete(result), nil
+		}
+		if err == nil || errors.Is(err, ErrNotApplicable) {
+			continue
+		}
+		if stopsLookup(err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// stopsLookup reports errors that mean the URL must not be pinned, rather than that a provider failed
+func stopsLookup(err error) bool {
+	return IsAuthError(err) || IsVolatileContentError(err) || IsSidecarSignatureError(err) || IsIntegrityError(err) ||
+		IsRedirectError(err) || IsDownloadLimitError(err)
+}
+
+// checksumResult wraps a checksum that does not depend on request headers
+func checksumResult(checksum string) *ChecksumResult {
+	return &ChecksumResult{Checksum: checksum, Headers: make(map[string]string)}
+}
+
+// GitHub releases require a separate API call (can't detect from headers)
+func (c *Client) gitHubReleaseProvider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	if _, ok := c.gitHubAPIURL(lookup.URL.Hostname()); !ok || !isGitHubReleaseDownload(lookup.URL) {
+		return nil, ErrNotApplicable
+	}
+	return c.getGitHubReleaseChecksum(ctx, lookup.URL)
+}
+
+// GitLab stores the SHA256 of generic package files, which release asset links usually point to
+func (c *Client) gitLabProvider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	apiURL, ok := c.gitLabAPIURL(lookup.URL.Hostname())
+	if !ok || !isGitLabDownload(lookup.URL, apiURL) {
+		return nil, ErrNotApplicable
+	}
+	checksum, err := c.getChecksumFromGitLab(ctx, lookup.URL, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	return checksumResult(checksum), nil
+}
+
+// Hugging Face Hub advertises the LFS SHA256 on the redirect to its CDN
+func (c *Client) huggingFaceProvider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	if _, ok := parseHuggingFaceURL(lookup.URL); !ok {
+		return nil, ErrNotApplicable
+	}
+	checksum, err := c.getChecksumFromHuggingFace(ctx, lookup.RawURL)
+	if err != nil {
+		return nil, err
+	}
+	return checksumResult(checksum), nil
+}
+
+// Package registries (PyPI, npm, Maven, Go module proxy) publish digests in their metadata
+func (c *Client) registryProvider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	if _, ok := c.registries[strings.ToLower(lookup.URL.Hostname())]; !ok {
+		return nil, ErrNotApplicable
+	}
+	return c.getChecksumFromRegistry(ctx, lookup.URL, lookup.RawURL)
+}
+
+// Other LFS-backed hosts publish the pointer file next to the content
+func (c *Client) lfsPointerProvider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	pointerURL, ok := lfsPointerURL(lookup.URL)
+	if !ok {
+		return nil, ErrNotApplicable
+	}
+	checksum, err := c.getChecksumFromLFSPointer(ctx, pointerURL)
+	if err != nil {
+		return nil, err
+	}
+	return checksumResult(checksum), nil
+}
+
+// RFC 9530 Repr-Digest and the legacy Digest header of a HEAD response
+func (c *Client) digestFieldsProvider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	resp, err := lookup.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	digest, ok := extractDigestFieldChecksum(resp.Header)
+	if !ok {
+		return nil, ErrNotApplicable
+	}
+	return &ChecksumResult{Checksum: "sha256:" + digest}, nil
+}
+
+// S3 is detected from the Server header (more reliable than URL pattern matching)
+func (c *Client) s3Provider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	resp, err := lookup.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.Get("Server") != amazonS3Server {
+		return nil, ErrNotApplicable
+	}
+	checksum, err := c.extractS3Checksum(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &ChecksumResult{Checksum: checksum}, nil
+}
+
+// Artifactory and Nexus are detected from their response headers
+func (c *Client) repositoryManagerProvider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	resp, err := lookup.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !isRepositoryManager(resp.Header) {
+		return nil, ErrNotApplicable
+	}
+	checksum, err := c.extractRepositoryManagerChecksum(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &ChecksumResult{Checksum: checksum}, nil
+}
+
+// raw.githubusercontent.com and similar servers use the SHA256 of the content as ETag
+func (c *Client) etagProvider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	resp, err := lookup.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// S3 and repository manager ETags are MD5/SHA-1 and handled above
+	if resp.Header.Get("Server") == amazonS3Server || isRepositoryManager(resp.Header) {
+		return nil, ErrNotApplicable
+	}
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if len(etag) != 64 || !isHexString(etag) {
+		return nil, errors.New("no usable checksum found in headers")
+	}
+	return &ChecksumResult{Checksum: "sha256:" + etag}, nil
+}
+
+// Published checksum files (<file>.sha256, SHA256SUMS) on hosts that opted in
+func (c *Client) sidecarProvider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	if _, ok := c.sidecars[strings.ToLower(lookup.URL.Hostname())]; !ok {
+		return nil, ErrNotApplicable
+	}
+	checksum, err := c.getChecksumFromSidecar(ctx, lookup.URL)
+	if err != nil {
+		return nil, err
+	}
+	return checksumResult(checksum), nil
+}
+
+// Fallback: download and compute SHA256
+func (c *Client) downloadProvider(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	return c.computeChecksumWithHeaders(ctx, lookup.RawURL)
+}
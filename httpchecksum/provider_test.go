@@ -0,0 +1,145 @@
+package httpchecksum
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wharflab/container-source-policy/internal/version"
+)
+
+// funcProvider adapts a function to Provider
+type funcProvider func(ctx context.Context, lookup *Lookup) (*ChecksumResult, error)
+
+func (f funcProvider) Checksum(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+	return f(ctx, lookup)
+}
+
+func TestCustomProviders(t *testing.T) {
+	const content = "artifact content"
+	const contentChecksum = "sha256:42bd420cc2f99e68e60005fa7c28fc2f60e4e04ee160d9dd3b98e72fc2954f98"
+	const customChecksum = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	fromArtifactServer := funcProvider(func(_ context.Context, lookup *Lookup) (*ChecksumResult, error) {
+		if !strings.HasSuffix(lookup.URL.Path, ".bin") {
+			return nil, ErrNotApplicable
+		}
+		return &ChecksumResult{Checksum: customChecksum}, nil
+	})
+	fromHeader := funcProvider(func(ctx context.Context, lookup *Lookup) (*ChecksumResult, error) {
+		resp, err := lookup.Head(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if sum := resp.Header.Get("X-Internal-Sha256"); sum != "" {
+			return &ChecksumResult{Checksum: "sha256:" + sum}, nil
+		}
+		return nil, ErrNotApplicable
+	})
+	denied := funcProvider(func(_ context.Context, lookup *Lookup) (*ChecksumResult, error) {
+		return nil, &AuthError{URL: lookup.RawURL, StatusCode: http.StatusForbidden}
+	})
+	broken := funcProvider(func(context.Context, *Lookup) (*ChecksumResult, error) {
+		return nil, errors.New("artifact server unavailable")
+	})
+
+	tests := []struct {
+		name         string
+		path         string
+		opts         []Option
+		wantChecksum string
+		wantHeaders  map[string]string
+		wantAuthErr  bool
+		wantHEAD     int32
+		wantGET      int32
+	}{
+		{
+			name:         "custom provider before built-ins",
+			path:         "/file.bin",
+			opts:         []Option{WithProvider(fromArtifactServer, PriorityGitHubRelease+1)},
+			wantChecksum: customChecksum,
+		},
+		{
+			name:         "not applicable falls through to download",
+			path:         "/file.txt",
+			opts:         []Option{WithProvider(fromArtifactServer, PriorityGitHubRelease+1)},
+			wantChecksum: contentChecksum,
+			wantHEAD:     1,
+			wantGET:      1,
+		},
+		{
+			name:         "custom provider shares the HEAD response and its Vary headers",
+			path:         "/file.txt",
+			opts:         []Option{WithProvider(fromHeader, PriorityETag)},
+			wantChecksum: "sha256:2222222222222222222222222222222222222222222222222222222222222222",
+			wantHeaders:  map[string]string{"user-agent": version.UserAgent()},
+			wantHEAD:     1,
+		},
+		{
+			name:         "failing provider falls through",
+			path:         "/file.bin",
+			opts:         []Option{WithProvider(broken, PriorityGitHubRelease+1)},
+			wantChecksum: contentChecksum,
+			wantHEAD:     1,
+			wantGET:      1,
+		},
+		{
+			name:        "auth error stops the lookup",
+			path:        "/file.bin",
+			opts:        []Option{WithProvider(denied, PriorityGitHubRelease+1)},
+			wantAuthErr: true,
+		},
+		{
+			name: "higher priority wins",
+			path: "/file.bin",
+			opts: []Option{
+				WithProvider(denied, PrioritySidecar),
+				WithProvider(fromArtifactServer, PriorityRegistry),
+			},
+			wantChecksum: customChecksum,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var heads, gets atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Vary", "User-Agent")
+				w.Header().Set("X-Internal-Sha256", strings.Repeat("2", 64))
+				if r.Method == http.MethodHead {
+					heads.Add(1)
+					return
+				}
+				gets.Add(1)
+				_, _ = w.Write([]byte(content))
+			}))
+			defer server.Close()
+
+			result, err := NewClient(tt.opts...).GetChecksumWithHeaders(context.Background(), server.URL+tt.path)
+			if tt.wantAuthErr {
+				if !IsAuthError(err) {
+					t.Fatalf("GetChecksumWithHeaders() error = %v, want AuthError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+			}
+			if result.Checksum != tt.wantChecksum {
+				t.Errorf("Checksum = %s, want %s", result.Checksum, tt.wantChecksum)
+			}
+			for k, want := range tt.wantHeaders {
+				if result.Headers[k] != want {
+					t.Errorf("Headers[%s] = %q, want %q", k, result.Headers[k], want)
+				}
+			}
+			if heads.Load() != tt.wantHEAD || gets.Load() != tt.wantGET {
+				t.Errorf("server saw %d HEAD / %d GET requests, want %d / %d", heads.Load(), gets.Load(), tt.wantHEAD, tt.wantGET)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package httpchecksum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/wharflab/container-source-policy/internal/version"
+)
+
+// maxMetadataSize bounds how much of a registry metadata document is read
+const maxMetadataSize = 32 << 20
+
+// pypiNameSeparators are collapsed to "-" when normalizing project names (PEP 503)
+var pypiNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// simpleIndexHref matches the file links of a PEP 503 HTML simple index page
+var simpleIndexHref = regexp.MustCompile(`(?i)<a\s[^>]*href="([^"]+)"`)
+
+// pypiSimpleProject is the PEP 691 JSON simple index project page
+type pypiSimpleProject struct {
+	Files []struct {
+		Filename string            `json:"filename"`
+		Hashes   map[string]string `json:"hashes"`
+	} `json:"files"`
+}
+
+// pypiProjectName returns the normalized project name of a wheel or sdist file name
+// (e.g., python_dateutil-2.9.0-py2.py3-none-any.whl or python-dateutil-2.9.0.tar.gz -> python-dateutil)
+func pypiProjectName(fileName string) (string, bool) {
+	var name string
+	if strings.HasSuffix(fileName, ".whl") || strings.HasSuffix(fileName, ".egg") {
+		// {name}-{version}(-{build})?-{python}-{abi}-{platform}.whl, names use "_" for "-"
+		name, _, _ = strings.Cut(fileName, "-")
+	} else {
+		// {name}-{version}.tar.gz: the version starts at the first "-" followed by a digit
+		for i := 0; i+1 < len(fileName); i++ {
+			if fileName[i] == '-' && fileName[i+1] >= '0' && fileName[i+1] <= '9' {
+				name = fileName[:i]
+				break
+			}
+		}
+	}
+	if name == "" || name == fileName {
+		return "", false
+	}
+	return strings.ToLower(pypiNameSeparators.ReplaceAllString(name, "-")), true
+}
+
+// getChecksumFromPyPI looks up the file's sha256 in the project page of a simple index
+func (c *Client) getChecksumFromPyPI(ctx context.Context, parsedURL *url.URL, indexURL string) (string, error) {
+	fileName, err := url.PathUnescape(path.Base(parsedURL.Path))
+	if err != nil {
+		return "", fmt.Errorf("invalid file name encoding: %w", err)
+	}
+	project, ok := pypiProjectName(fileName)
+	if !ok {
+		return "", fmt.Errorf("cannot tell the project of %s", fileName)
+	}
+	projectURL := strings.TrimSuffix(indexURL, "/") + "/" + project + "/"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, projectURL, http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	// PEP 691: prefer JSON, but older indexes (devpi, Artifactory) may only serve HTML
+	req.Header.Set("Accept", "application/vnd.pypi.simple.v1+json, text/html;q=0.1")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Indexes may restrict browsing while serving files publicly; the download decides whether credentials are needed
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", fmt.Errorf("%w: simple index request refused: %s", ErrNotApplicable, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("simple index request failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return "", err
+	}
+
+	var hexDigest string
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); strings.HasSuffix(mediaType, "+json") {
+		hexDigest, err = findSimpleJSONDigest(data, fileName)
+	} else {
+		hexDigest, err = findSimpleHTMLDigest(data, projectURL, fileName)
+	}
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hexDigest, nil
+}
+
+// findSimpleJSONDigest finds fileName's sha256 in a PEP 691 JSON project page
+func findSimpleJSONDigest(data []byte, fileName string) (string, error) {
+	var page pypiSimpleProject
+	if err := json.Unmarshal(data, &page); err != nil {
+		return "", fmt.Errorf("failed to parse simple index: %w", err)
+	}
+	for _, file := range page.Files {
+		if file.Filename != fileName {
+			continue
+		}
+		if digest := strings.ToLower(file.Hashes["sha256"]); isSHA256Hex(digest) {
+			return digest, nil
+		}
+		return "", fmt.Errorf("simple index has no sha256 for %s", fileName)
+	}
+	return "", fmt.Errorf("simple index does not list %s", fileName)
+}
+
+// findSimpleHTMLDigest finds fileName's sha256 in the #sha256=<hex> fragment of a PEP 503 HTML link
+func findSimpleHTMLDigest(data []byte, pageURL, fileName string) (string, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+	for _, match := range simpleIndexHref.FindAllSubmatch(data, -1) {
+		link, err := base.Parse(html.UnescapeString(string(match[1])))
+		if err != nil {
+			continue
+		}
+		if name, err := url.PathUnescape(path.Base(link.Path)); err != nil || name != fileName {
+			continue
+		}
+		algorithm, digest, _ := strings.Cut(link.Fragment, "=")
+		if digest = strings.ToLower(digest); algorithm == "sha256" && isSHA256Hex(digest) {
+			return digest, nil
+		}
+		return "", fmt.Errorf("simple index has no sha256 for %s", fileName)
+	}
+	return "", errors.New("simple index does not list " + fileName)
+}
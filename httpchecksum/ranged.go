@@ -0,0 +1,186 @@
+package httpchecksum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// defaultParallelDownloads is the number of connections a large download is split across
+	defaultParallelDownloads = 4
+	// defaultSegmentSize is the size of each range request
+	defaultSegmentSize = 8 << 20
+	// defaultRangedThreshold is the smallest download split into ranges
+	defaultRangedThreshold = 64 << 20
+)
+
+// WithParallelDownloads sets how many connections large downloads from servers that accept range requests
+// are split across (default 4; 1 downloads over a single connection)
+func WithParallelDownloads(connections int) Option {
+	return func(c *Client) {
+		if connections > 0 {
+			c.parallelDownloads = connections
+		}
+	}
+}
+
+// rangeValidator returns the If-Range value that makes range requests fail if the content changed:
+// a strong ETag or, failing that, Last-Modified
+func rangeValidator(headers http.Header) string {
+	if etag := headers.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return headers.Get("Last-Modified")
+}
+
+// canDownloadRanges reports whether a GET response is worth continuing with parallel range requests
+func (c *Client) canDownloadRanges(resp *http.Response) bool {
+	return c.parallelDownloads > 1 &&
+		resp.ContentLength >= c.rangedThreshold &&
+		strings.EqualFold(strings.TrimSpace(resp.Header.Get("Accept-Ranges")), "bytes") &&
+		resp.Header.Get("Content-Encoding") == "" &&
+		rangeValidator(resp.Header) != ""
+}
+
+// downloadRanges writes the content of resp to dst in order: the first segment is read from resp itself
+// while the following ones are fetched with parallel range requests. At most twice as many segments as
+// there are connections are held in memory waiting for their turn.
+func (c *Client) downloadRanges(
+	ctx context.Context, resp *http.Response, rawURL string, dst io.Writer, reservation *downloadReservation,
+) (int64, error) {
+	total := resp.ContentLength
+	size := c.segmentSize
+	count := int((total + size - 1) / size)
+
+	// Not resp.Request's context: with a client timeout, it ends when the first body is closed
+	ctx, cancel := context.WithCancelCause(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel(nil)
+
+	segments := make([]chan []byte, count)
+	for i := range segments {
+		segments[i] = make(chan []byte, 1)
+	}
+	connections := make(chan struct{}, c.parallelDownloads)
+	window := make(chan struct{}, 2*c.parallelDownloads)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i < count; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				select {
+				case connections <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-connections }()
+				start := int64(i) * size
+				data, err := c.fetchRange(ctx, resp, rawURL, start, min(start+size, total)-1, reservation)
+				if err != nil {
+					cancel(err)
+					return
+				}
+				segments[i] <- data
+			}()
+		}
+	}()
+
+	// A failed range request also stops reading the first segment
+	stop := context.AfterFunc(ctx, func() { _ = resp.Body.Close() })
+	defer stop()
+	written, err := io.CopyN(dst, c.limitDownload(rawURL, resp.Body, reservation), min(size, total))
+	if err != nil {
+		if ctx.Err() != nil {
+			return written, context.Cause(ctx)
+		}
+		return written, err
+	}
+	// The rest of the body is fetched by range; closing drops the connection instead of draining it
+	_ = resp.Body.Close()
+
+	for i := 1; i < count; i++ {
+		select {
+		case data := <-segments[i]:
+			n, err := dst.Write(data)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			<-window
+		case <-ctx.Done():
+			return written, context.Cause(ctx)
+		}
+	}
+	return written, nil
+}
+
+// fetchRange downloads bytes start-end (inclusive) of the content first was the response for
+func (c *Client) fetchRange(
+	ctx context.Context, first *http.Response, rawURL string, start, end int64, reservation *downloadReservation,
+) ([]byte, error) {
+	// The request that produced first, after redirects and with the headers actually sent
+	req := first.Request.Clone(ctx)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	req.Header.Set("If-Range", rangeValidator(first.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// 200 means the server ignored the range, or the content changed since the first response
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("range request for bytes %d-%d failed: %s", start, end, resp.Status)
+	}
+	want := fmt.Sprintf("bytes %d-%d/%d", start, end, first.ContentLength)
+	if got := resp.Header.Get("Content-Range"); got != want {
+		return nil, fmt.Errorf("range request for bytes %d-%d returned Content-Range %q", start, end, got)
+	}
+
+	data := make([]byte, end-start+1)
+	if _, err := io.ReadFull(c.limitDownload(rawURL, resp.Body, reservation), data); err != nil {
+		return nil, fmt.Errorf("failed to read bytes %d-%d: %w", start, end, err)
+	}
+	return data, nil
+}
+
+// downloadRest fetches the content of first again with a plain GET and writes what follows its first written
+// bytes to dst, which already holds them. The content must still have the validator first had.
+func (c *Client) downloadRest(
+	req *http.Request, first *http.Response, rawURL string, dst io.Writer, reservation *downloadReservation, written int64,
+) (int64, error) {
+	resp, err := c.httpClient.Do(req.Clone(req.Context()))
+	if err != nil {
+		return written, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return written, fmt.Errorf("GET request failed: %s", resp.Status)
+	}
+	if resp.ContentLength != first.ContentLength || rangeValidator(resp.Header) != rangeValidator(first.Header) {
+		return written, errors.New("content changed during the download")
+	}
+
+	body := c.limitDownload(rawURL, resp.Body, reservation)
+	if _, err := io.CopyN(io.Discard, body, written); err != nil {
+		return written, err
+	}
+	n, err := io.Copy(dst, body)
+	return written + n, err
+}
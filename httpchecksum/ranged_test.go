@@ -0,0 +1,182 @@
+package httpchecksum
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rangeServer serves content with ServeContent (which handles Range and If-Range) and counts range requests
+type rangeServer struct {
+	*httptest.Server
+	content []byte
+	mu      sync.Mutex
+	ranges  int
+	etag    func(r *http.Request) string
+	// failRange, when set, may answer the nth range request (from 1) itself instead of serving the range
+	failRange func(w http.ResponseWriter, r *http.Request, n int) bool
+}
+
+func newRangeServer(t *testing.T, size int) *rangeServer {
+	t.Helper()
+	content := make([]byte, size)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range content {
+		content[i] = byte(rng.Uint32())
+	}
+	rs := &rangeServer{content: content, etag: func(*http.Request) string { return `"v1"` }}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.mu.Lock()
+		n := 0
+		if r.Header.Get("Range") != "" {
+			rs.ranges++
+			n = rs.ranges
+		}
+		rs.mu.Unlock()
+		w.Header().Set("ETag", rs.etag(r))
+		if n > 0 && rs.failRange != nil && rs.failRange(w, r, n) {
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(rs.content))
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func (rs *rangeServer) rangeRequests() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.ranges
+}
+
+// newRangedClient returns a client that splits downloads of 64 KiB or more into 16 KiB ranges
+func newRangedClient(opts ...Option) *Client {
+	client := NewClient(opts...)
+	client.segmentSize = 16 << 10
+	client.rangedThreshold = 64 << 10
+	return client
+}
+
+func TestGetChecksum_RangedDownload(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		opts       []Option
+		wantRanges bool
+	}{
+		{name: "large file is split into ranges", size: 200<<10 + 123, wantRanges: true},
+		{name: "exact multiple of the segment size", size: 128 << 10, wantRanges: true},
+		{name: "small file is downloaded at once", size: 32 << 10},
+		{name: "one connection", size: 200 << 10, opts: []Option{WithParallelDownloads(1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newRangeServer(t, tt.size)
+			var progress bytes.Buffer
+			var total int64
+			client := newRangedClient(tt.opts...).WithProgressFactory(func(contentLength int64) io.Writer {
+				total = contentLength
+				return &progress
+			})
+
+			result, err := client.GetChecksumWithHeaders(context.Background(), rs.URL+"/sdk.tar.gz")
+			if err != nil {
+				t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+			}
+			if want := "sha256:" + sha256Hex(rs.content); result.Checksum != want {
+				t.Errorf("Checksum = %s, want %s", result.Checksum, want)
+			}
+			if (rs.rangeRequests() > 0) != tt.wantRanges {
+				t.Errorf("range requests = %d, want ranges %v", rs.rangeRequests(), tt.wantRanges)
+			}
+			if total != int64(tt.size) || !bytes.Equal(progress.Bytes(), rs.content) {
+				t.Errorf("progress got %d of %d bytes, want the content in order", progress.Len(), total)
+			}
+		})
+	}
+}
+
+func TestGetChecksum_RangedDownloadFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		failRange func(w http.ResponseWriter, r *http.Request, n int) bool
+	}{
+		{
+			name: "200 instead of 206",
+			failRange: func(_ http.ResponseWriter, r *http.Request, n int) bool {
+				if n == 3 {
+					r.Header.Del("Range")
+				}
+				return false
+			},
+		},
+		{
+			name: "connection reset",
+			failRange: func(w http.ResponseWriter, _ *http.Request, n int) bool {
+				if n != 3 {
+					return false
+				}
+				conn, _, err := http.NewResponseController(w).Hijack()
+				if err == nil {
+					_ = conn.Close()
+				}
+				return true
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newRangeServer(t, 200<<10)
+			rs.failRange = tt.failRange
+			var progress bytes.Buffer
+			client := newRangedClient().WithProgressFactory(func(int64) io.Writer { return &progress })
+
+			result, err := client.GetChecksumWithHeaders(context.Background(), rs.URL+"/sdk.tar.gz")
+			if err != nil {
+				t.Fatalf("GetChecksumWithHeaders() error = %v, want the download to finish over one connection", err)
+			}
+			if want := "sha256:" + sha256Hex(rs.content); result.Checksum != want {
+				t.Errorf("Checksum = %s, want %s", result.Checksum, want)
+			}
+			if !bytes.Equal(progress.Bytes(), rs.content) {
+				t.Errorf("progress got %d of %d bytes, want the content in order", progress.Len(), len(rs.content))
+			}
+		})
+	}
+}
+
+func TestGetChecksum_RangedDownloadContentChanged(t *testing.T) {
+	rs := newRangeServer(t, 200<<10)
+	// Every GET after the first sees a new version of the file, so If-Range makes the server send
+	// all of it and the fallback download no longer matches
+	var gets atomic.Int32
+	rs.etag = func(r *http.Request) string {
+		if r.Method == http.MethodGet && gets.Add(1) > 1 {
+			return `"v2"`
+		}
+		return `"v1"`
+	}
+
+	_, err := newRangedClient().GetChecksumWithHeaders(context.Background(), rs.URL+"/sdk.tar.gz")
+	if err == nil {
+		t.Fatal("GetChecksumWithHeaders() succeeded, want an error for content that changed during the download")
+	}
+}
+
+func TestGetChecksum_RangedDownloadBudget(t *testing.T) {
+	rs := newRangeServer(t, 200<<10)
+
+	_, err := newRangedClient(WithDownloadBudget(150<<10)).GetChecksumWithHeaders(context.Background(), rs.URL+"/sdk.tar.gz")
+	if !IsDownloadLimitError(err) {
+		t.Errorf("GetChecksumWithHeaders() error = %v, want DownloadLimitError", err)
+	}
+}
@@ -0,0 +1,139 @@
+package httpchecksum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// defaultMaxRedirects is the longest redirect chain followed by default, as in net/http
+const defaultMaxRedirects = 10
+
+// versionPattern matches dotted version numbers in URL paths (e.g., 3.2.1, v1.20)
+var versionPattern = regexp.MustCompile(`v?\d+(?:\.\d+)+`)
+
+// RedirectPolicy decides which redirects the client follows
+type RedirectPolicy struct {
+	// MaxRedirects is the longest redirect chain followed; 0 means 10, as in net/http
+	MaxRedirects int
+	// SameHostOnly refuses redirects to another host, except to AllowedHosts
+	SameHostOnly bool
+	// AllowedHosts are the other hosts redirects may lead to when SameHostOnly is set (e.g., a CDN)
+	AllowedHosts []string
+}
+
+// WithRedirectPolicy limits the redirects the client follows. By default it follows up to 10
+// redirects to any host; a refused redirect fails the lookup with a RedirectError.
+func WithRedirectPolicy(policy RedirectPolicy) Option {
+	return func(c *Client) {
+		c.redirectPolicy = policy
+	}
+}
+
+// RedirectError indicates a redirect refused by the client's RedirectPolicy
+type RedirectError struct {
+	URL      string
+	Location string
+	Reason   string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirect from %s to %s refused (%s)", e.URL, e.Location, e.Reason)
+}
+
+// IsRedirectError checks if an error is a refused redirect
+func IsRedirectError(err error) bool {
+	var redirectErr *RedirectError
+	return errors.As(err, &redirectErr)
+}
+
+// checkRedirect enforces the redirect policy and records the redirects followed for the source being looked up
+func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	policy := c.redirectPolicy
+	maxRedirects := policy.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	origin := via[0].URL
+	if len(via) > maxRedirects {
+		return &RedirectError{
+			URL:      origin.String(),
+			Location: req.URL.String(),
+			Reason:   fmt.Sprintf("more than %d redirects", maxRedirects),
+		}
+	}
+	host := strings.ToLower(req.URL.Hostname())
+	if policy.SameHostOnly && host != strings.ToLower(origin.Hostname()) &&
+		!slices.ContainsFunc(policy.AllowedHosts, func(allowed string) bool { return strings.EqualFold(allowed, host) }) {
+		return &RedirectError{URL: origin.String(), Location: req.URL.String(), Reason: "redirects to other hosts are disabled"}
+	}
+
+	if tracker, ok := req.Context().Value(redirectTrackerKey{}).(*redirectTracker); ok {
+		tracker.record(via, req.URL)
+	}
+	return nil
+}
+
+// redirectTrackerKey is the context key of the per-lookup redirectTracker
+type redirectTrackerKey struct{}
+
+// redirectTracker records the redirects followed by requests for the source URL
+// (requests for API endpoints, sidecar files and the like are ignored)
+type redirectTracker struct {
+	source string
+	mu     sync.Mutex
+	chain  []string
+}
+
+// withRedirectTracker returns a context that records the redirects followed for source
+func withRedirectTracker(ctx context.Context, source *url.URL) (context.Context, *redirectTracker) {
+	tracker := &redirectTracker{source: source.String()}
+	return context.WithValue(ctx, redirectTrackerKey{}, tracker), tracker
+}
+
+// record keeps the longest chain seen; every hop of a request calls it with the chain so far
+func (t *redirectTracker) record(via []*http.Request, location *url.URL) {
+	if via[0].URL.String() != t.source {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(via) < len(t.chain) {
+		return
+	}
+	t.chain = t.chain[:0]
+	for _, hop := range via[1:] {
+		t.chain = append(t.chain, hop.URL.String())
+	}
+	t.chain = append(t.chain, location.String())
+}
+
+// redirects returns the locations the source redirected to, in order
+func (t *redirectTracker) redirects() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.chain)
+}
+
+// versionedRedirect returns the first redirect location whose path names a version the source URL
+// does not (e.g., /download/latest/tool.tar.gz -> /download/v3.2.1/tool.tar.gz) along with that version
+func versionedRedirect(source *url.URL, redirects []string) (location, version string) {
+	for _, redirect := range redirects {
+		target, err := url.Parse(redirect)
+		if err != nil {
+			continue
+		}
+		for _, candidate := range versionPattern.FindAllString(target.Path, -1) {
+			if !strings.Contains(source.Path, strings.TrimPrefix(candidate, "v")) {
+				return redirect, candidate
+			}
+		}
+	}
+	return "", ""
+}
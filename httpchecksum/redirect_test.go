@@ -0,0 +1,139 @@
+package httpchecksum
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVersionedRedirect(t *testing.T) {
+	tests := []struct {
+		source       string
+		redirects    []string
+		wantLocation string
+		wantVersion  string
+	}{
+		{
+			source:       "https://example.com/download/latest/tool.tar.gz",
+			redirects:    []string{"https://example.com/download/v3.2.1/tool.tar.gz", "https://cdn.example.net/blob/abc?sig=1.2"},
+			wantLocation: "https://example.com/download/v3.2.1/tool.tar.gz",
+			wantVersion:  "v3.2.1",
+		},
+		{
+			source:       "https://example.com/tool-stable-linux.tar.gz",
+			redirects:    []string{"https://example.com/releases/tool-1.20.3-linux.tar.gz"},
+			wantLocation: "https://example.com/releases/tool-1.20.3-linux.tar.gz",
+			wantVersion:  "1.20.3",
+		},
+		{
+			// The version is already in the source URL
+			source:    "https://example.com/download/v3.2.1/tool.tar.gz",
+			redirects: []string{"https://mirror.example.net/tool/3.2.1/tool.tar.gz"},
+		},
+		{
+			source:    "https://example.com/tool.tar.gz",
+			redirects: []string{"https://cdn.example.net/5f3a9c/tool.tar.gz"},
+		},
+		{source: "https://example.com/download/latest/tool.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			location, version := versionedRedirect(mustParseURL(t, tt.source), tt.redirects)
+			if location != tt.wantLocation || version != tt.wantVersion {
+				t.Errorf("versionedRedirect() = %q, %q, want %q, %q", location, version, tt.wantLocation, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func newRedirectServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/download/latest/tool.tar.gz", http.RedirectHandler("/download/v3.2.1/tool.tar.gz", http.StatusFound))
+	mux.HandleFunc("/download/v3.2.1/tool.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tool 3.2.1"))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop?n="+r.URL.Query().Get("n")+"x", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetChecksum_VersionedRedirect(t *testing.T) {
+	server := newRedirectServer(t)
+	client := NewClient()
+
+	result, err := client.GetChecksumWithHeaders(context.Background(), server.URL+"/download/latest/tool.tar.gz")
+	if err != nil {
+		t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+	}
+	if want := "sha256:" + sha256Hex([]byte("tool 3.2.1")); result.Checksum != want {
+		t.Errorf("Checksum = %s, want %s", result.Checksum, want)
+	}
+	stable := server.URL + "/download/v3.2.1/tool.tar.gz"
+	if !slices.Equal(result.Redirects, []string{stable}) {
+		t.Errorf("Redirects = %v, want [%s]", result.Redirects, stable)
+	}
+	if result.StableURL != stable {
+		t.Errorf("StableURL = %s, want %s", result.StableURL, stable)
+	}
+	if !strings.Contains(result.MutableReason, "v3.2.1") {
+		t.Errorf("MutableReason = %q, want it to name the version", result.MutableReason)
+	}
+
+	result, err = client.GetChecksumWithHeaders(context.Background(), stable)
+	if err != nil {
+		t.Fatalf("GetChecksumWithHeaders() error = %v", err)
+	}
+	if len(result.Redirects) != 0 || result.MutableReason != "" || result.StableURL != "" {
+		t.Errorf("got %+v, want no redirects for the versioned URL", result)
+	}
+}
+
+func TestGetChecksum_RedirectPolicy(t *testing.T) {
+	server := newRedirectServer(t)
+	// The same server under another hostname
+	other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	crossHost := httptest.NewServer(http.RedirectHandler(other+"/download/v3.2.1/tool.tar.gz", http.StatusFound))
+	t.Cleanup(crossHost.Close)
+
+	tests := []struct {
+		name    string
+		policy  RedirectPolicy
+		url     string
+		wantErr bool
+	}{
+		{name: "default limit", url: server.URL + "/loop", wantErr: true},
+		{name: "lower limit", policy: RedirectPolicy{MaxRedirects: 1}, url: server.URL + "/download/latest/tool.tar.gz"},
+		{name: "cross-host allowed by default", url: crossHost.URL},
+		{name: "cross-host refused", policy: RedirectPolicy{SameHostOnly: true}, url: crossHost.URL, wantErr: true},
+		{
+			name:   "cross-host to an allowed host",
+			policy: RedirectPolicy{SameHostOnly: true, AllowedHosts: []string{"LOCALHOST"}},
+			url:    crossHost.URL,
+		},
+		{name: "same host", policy: RedirectPolicy{SameHostOnly: true}, url: server.URL + "/download/latest/tool.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(WithRedirectPolicy(tt.policy))
+			_, err := client.GetChecksumWithHeaders(context.Background(), tt.url)
+			if tt.wantErr {
+				if !IsRedirectError(err) {
+					t.Errorf("GetChecksumWithHeaders() error = %v, want RedirectError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("GetChecksumWithHeaders() error = %v", err)
+			}
+		})
+	}
+}
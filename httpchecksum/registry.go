@@ -0,0 +1,129 @@
+package httpchecksum
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Package registries whose download hosts have published digests
+const (
+	// RegistryPyPI looks up sha256 hashes in a PEP 503/691 simple index (pypi.org, devpi, ...)
+	RegistryPyPI = "pypi"
+	// RegistryNPM downloads tarballs and verifies them against dist.integrity (registry.npmjs.org, Verdaccio, ...)
+	RegistryNPM = "npm"
+	// RegistryMaven reads the <file>.sha256 published next to each artifact in a Maven repository
+	RegistryMaven = "maven"
+	// RegistryGoProxy downloads module zips and verifies them against the Go checksum database
+	RegistryGoProxy = "goproxy"
+)
+
+// Public metadata endpoints used when a RegistryHost has no MetadataURL
+const (
+	defaultPyPIIndex   = "https://pypi.org/simple/"
+	defaultNPMRegistry = "https://registry.npmjs.org/"
+	defaultGoSumDB     = "https://sum.golang.org"
+	// goSumDBKey is the verifier key of sum.golang.org (see GOSUMDB in the go command documentation)
+	goSumDBKey = "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ko0Bntb/OLhuVMjhO5W"
+)
+
+// RegistryHost marks Host as serving files of a package registry
+type RegistryHost struct {
+	// Host is the download hostname (e.g., files.pythonhosted.org or an internal mirror)
+	Host string
+	// Kind is one of RegistryPyPI, RegistryNPM, RegistryMaven or RegistryGoProxy
+	Kind string
+	// MetadataURL is where digests are looked up: the PyPI simple index, the npm registry,
+	// or a Go checksum database proxy (e.g., https://goproxy.internal/sumdb/sum.golang.org).
+	// Empty uses the public service; Maven repositories publish checksums on Host itself.
+	MetadataURL string
+}
+
+// defaultRegistryHosts are the public package registry download hosts
+var defaultRegistryHosts = []RegistryHost{
+	{Host: "files.pythonhosted.org", Kind: RegistryPyPI},
+	{Host: "registry.npmjs.org", Kind: RegistryNPM},
+	{Host: "repo1.maven.org", Kind: RegistryMaven},
+	{Host: "repo.maven.apache.org", Kind: RegistryMaven},
+	{Host: "proxy.golang.org", Kind: RegistryGoProxy},
+}
+
+// IntegrityError indicates downloaded content that does not match the digest published by its registry
+type IntegrityError struct {
+	URL    string
+	Reason string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("integrity check failed for %s: %s", e.URL, e.Reason)
+}
+
+// IsIntegrityError checks if an error is an IntegrityError
+func IsIntegrityError(err error) bool {
+	var integrityErr *IntegrityError
+	return errors.As(err, &integrityErr)
+}
+
+// WithRegistryHosts adds package registry hosts (e.g., devpi or Verdaccio mirrors),
+// or overrides the metadata URL of the public ones
+func WithRegistryHosts(hosts ...RegistryHost) Option {
+	return func(c *Client) {
+		if c.registries == nil {
+			c.registries = make(map[string]RegistryHost)
+		}
+		for _, host := range hosts {
+			c.registries[strings.ToLower(host.Host)] = host
+		}
+	}
+}
+
+// getChecksumFromRegistry looks up the digest a package registry publishes for the URL's file
+func (c *Client) getChecksumFromRegistry(ctx context.Context, parsedURL *url.URL, rawURL string) (*ChecksumResult, error) {
+	host, ok := c.registries[strings.ToLower(parsedURL.Hostname())]
+	if !ok {
+		return nil, errors.New("not a package registry host")
+	}
+
+	var checksum string
+	var err error
+	switch host.Kind {
+	case RegistryPyPI:
+		checksum, err = c.getChecksumFromPyPI(ctx, parsedURL, cmp.Or(host.MetadataURL, defaultPyPIIndex))
+	case RegistryNPM:
+		return c.getChecksumFromNPM(ctx, parsedURL, rawURL, cmp.Or(host.MetadataURL, defaultNPMRegistry))
+	case RegistryMaven:
+		checksum, err = c.getChecksumFromMaven(ctx, parsedURL)
+	case RegistryGoProxy:
+		return c.getChecksumFromGoProxy(ctx, parsedURL, rawURL, cmp.Or(host.MetadataURL, defaultGoSumDB))
+	default:
+		return nil, fmt.Errorf("unknown registry kind %q for %s", host.Kind, host.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ChecksumResult{Checksum: checksum, Headers: make(map[string]string)}, nil
+}
+
+// getChecksumFromMaven reads the <file>.sha256 Maven repositories publish next to each artifact
+func (c *Client) getChecksumFromMaven(ctx context.Context, parsedURL *url.URL) (string, error) {
+	fileName, err := url.PathUnescape(path.Base(parsedURL.Path))
+	if err != nil {
+		return "", fmt.Errorf("invalid file name encoding: %w", err)
+	}
+	checksumURL := *parsedURL
+	checksumURL.RawQuery, checksumURL.Fragment = "", ""
+
+	data, err := c.fetchSidecar(ctx, checksumURL.String()+".sha256")
+	if err != nil {
+		return "", err
+	}
+	hexDigest, ok := parseChecksumFile(data, fileName, true)
+	if !ok {
+		return "", errors.New("no usable checksum in " + fileName + ".sha256")
+	}
+	return "sha256:" + strings.ToLower(hexDigest), nil
+}
@@ -0,0 +1,365 @@
+package httpchecksum
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // legacy npm shasum fixture
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestPyPIProjectName(t *testing.T) {
+	tests := []struct {
+		fileName string
+		want     string
+		wantOK   bool
+	}{
+		{"python_dateutil-2.9.0.post0-py2.py3-none-any.whl", "python-dateutil", true},
+		{"python-dateutil-2.9.0.post0.tar.gz", "python-dateutil", true},
+		{"Django-5.0.tar.gz", "django", true},
+		{"zope.interface-6.1-cp312-cp312-manylinux_2_17_x86_64.whl", "zope-interface", true},
+		{"README", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			got, ok := pypiProjectName(tt.fileName)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("pypiProjectName() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNPMTarball(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantPkg string
+		wantVer string
+		wantOK  bool
+	}{
+		{"/left-pad/-/left-pad-1.3.0.tgz", "left-pad", "1.3.0", true},
+		{"/@types/node/-/node-20.11.5.tgz", "@types/node", "20.11.5", true},
+		{"/@types%2fnode/-/node-20.11.5.tgz", "@types/node", "20.11.5", true},
+		{"/left-pad", "", "", false},
+		{"/left-pad/-/other-1.0.0.tgz", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			u, err := url.Parse("https://registry.npmjs.org" + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkg, ver, ok := npmTarball(u)
+			if pkg != tt.wantPkg || ver != tt.wantVer || ok != tt.wantOK {
+				t.Errorf("npmTarball() = %q, %q, %v, want %q, %q, %v", pkg, ver, ok, tt.wantPkg, tt.wantVer, tt.wantOK)
+			}
+		})
+	}
+}
+
+// registryServer is a local stand-in for a package registry that records requests
+type registryServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+func newRegistryServer(t *testing.T, mux *http.ServeMux) *registryServer {
+	t.Helper()
+	rs := &registryServer{}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.mu.Lock()
+		rs.requests = append(rs.requests, r.Method+" "+r.URL.EscapedPath())
+		rs.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func (rs *registryServer) downloaded(path string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return slices.Contains(rs.requests, "GET "+path)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestGetChecksum_PyPI(t *testing.T) {
+	content := []byte("wheel content")
+	const fileName = "demo_pkg-1.0.0-py3-none-any.whl"
+
+	tests := []struct {
+		name         string
+		index        func(w http.ResponseWriter, r *http.Request)
+		wantDownload bool
+	}{
+		{
+			name: "PEP 691 JSON index",
+			index: func(w http.ResponseWriter, r *http.Request) {
+				if !strings.Contains(r.Header.Get("Accept"), "application/vnd.pypi.simple.v1+json") {
+					t.Errorf("expected PEP 691 Accept header, got %q", r.Header.Get("Accept"))
+				}
+				w.Header().Set("Content-Type", "application/vnd.pypi.simple.v1+json")
+				_, _ = fmt.Fprintf(w, `{"meta":{"api-version":"1.1"},"name":"demo-pkg","files":[`+
+					`{"filename":"demo_pkg-0.9.0-py3-none-any.whl","url":"x","hashes":{"sha256":"%s"}},`+
+					`{"filename":%q,"url":"x","hashes":{"sha256":"%s"}}]}`,
+					strings.Repeat("0", 64), fileName, sha256Hex(content))
+			},
+		},
+		{
+			name: "PEP 503 HTML index (devpi)",
+			index: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				_, _ = fmt.Fprintf(w, `<html><body>
+<a href="../../+f/aaa/demo_pkg-0.9.0-py3-none-any.whl#sha256=%s">demo_pkg-0.9.0-py3-none-any.whl</a>
+<a href="../../+f/bbb/%s#sha256=%s" data-requires-python="&gt;=3.8">%s</a>
+</body></html>`, strings.Repeat("0", 64), fileName, sha256Hex(content), fileName)
+			},
+		},
+		{
+			name: "index refusing credentials falls through to the download",
+			index: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			wantDownload: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/root/pypi/+simple/demo-pkg/", tt.index)
+			mux.HandleFunc("/root/pypi/+f/bbb/"+fileName, func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write(content)
+			})
+			server := newRegistryServer(t, mux)
+
+			client := NewClient(WithRegistryHosts(RegistryHost{
+				Host:        "127.0.0.1",
+				Kind:        RegistryPyPI,
+				MetadataURL: server.URL + "/root/pypi/+simple/",
+			}))
+			fileURL := server.URL + "/root/pypi/+f/bbb/" + fileName
+			checksum, err := client.GetChecksum(context.Background(), fileURL)
+			if err != nil {
+				t.Fatalf("GetChecksum() error = %v", err)
+			}
+			if want := "sha256:" + sha256Hex(content); checksum != want {
+				t.Errorf("GetChecksum() = %s, want %s", checksum, want)
+			}
+			if got := server.downloaded("/root/pypi/+f/bbb/" + fileName); got != tt.wantDownload {
+				t.Errorf("downloaded = %v, want %v", got, tt.wantDownload)
+			}
+		})
+	}
+}
+
+func TestGetChecksum_NPM(t *testing.T) {
+	content := []byte("tarball content")
+	sha512Sum := sha512.Sum512(content)
+	sha1Sum := sha1.Sum(content) //nolint:gosec // legacy npm shasum fixture
+	tampered := sha512.Sum512([]byte("something else"))
+
+	tests := []struct {
+		name          string
+		dist          string
+		refused       bool // the registry refuses the metadata request
+		wantIntegrity bool
+	}{
+		{
+			name: "sha512 integrity",
+			dist: `{"integrity":"sha512-` + base64.StdEncoding.EncodeToString(sha512Sum[:]) + `"}`,
+		},
+		{
+			name: "legacy shasum",
+			dist: `{"shasum":"` + hex.EncodeToString(sha1Sum[:]) + `"}`,
+		},
+		{
+			name:          "integrity mismatch",
+			dist:          `{"integrity":"sha512-` + base64.StdEncoding.EncodeToString(tampered[:]) + `"}`,
+			wantIntegrity: true,
+		},
+		{
+			name:    "metadata refusing credentials falls through to the download",
+			refused: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			// Verdaccio addresses scoped packages as @scope%2fname
+			mux.HandleFunc("/@acme%2fwidget/1.2.3", func(w http.ResponseWriter, _ *http.Request) {
+				if tt.refused {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				_, _ = fmt.Fprintf(w, `{"name":"@acme/widget","version":"1.2.3","dist":%s}`, tt.dist)
+			})
+			mux.HandleFunc("/@acme/widget/-/widget-1.2.3.tgz", func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write(content)
+			})
+			server := newRegistryServer(t, mux)
+
+			client := NewClient(WithRegistryHosts(RegistryHost{Host: "127.0.0.1", Kind: RegistryNPM, MetadataURL: server.URL}))
+			checksum, err := client.GetChecksum(context.Background(), server.URL+"/@acme/widget/-/widget-1.2.3.tgz")
+			if tt.wantIntegrity {
+				if !IsIntegrityError(err) {
+					t.Fatalf("GetChecksum() error = %v, want IntegrityError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetChecksum() error = %v", err)
+			}
+			if want := "sha256:" + sha256Hex(content); checksum != want {
+				t.Errorf("GetChecksum() = %s, want %s", checksum, want)
+			}
+		})
+	}
+}
+
+func TestGetChecksum_Maven(t *testing.T) {
+	content := []byte("jar content")
+	const artifact = "/maven2/com/example/lib/1.0/lib-1.0.jar"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(artifact, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(content)
+	})
+	mux.HandleFunc(artifact+".sha256", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(sha256Hex(content)))
+	})
+	server := newRegistryServer(t, mux)
+
+	client := NewClient(WithRegistryHosts(RegistryHost{Host: "127.0.0.1", Kind: RegistryMaven}))
+	checksum, err := client.GetChecksum(context.Background(), server.URL+artifact)
+	if err != nil {
+		t.Fatalf("GetChecksum() error = %v", err)
+	}
+	if want := "sha256:" + sha256Hex(content); checksum != want {
+		t.Errorf("GetChecksum() = %s, want %s", checksum, want)
+	}
+	if server.downloaded(artifact) {
+		t.Error("expected the digest to come from the .sha256 file, but the artifact was downloaded")
+	}
+}
+
+func TestGetChecksum_GoProxy(t *testing.T) {
+	zipData := goModuleZipFixture(t, "example.com/Mod@v1.0.0", map[string]string{
+		"go.mod":  "module example.com/Mod\n",
+		"main.go": "package mod\n",
+	})
+	h1 := hashZipBytes(t, zipData)
+
+	tests := []struct {
+		name          string
+		sumdbHash     string
+		wantIntegrity bool
+	}{
+		{name: "matching checksum database entry", sumdbHash: h1},
+		{name: "tampered zip", sumdbHash: "h1:" + base64.StdEncoding.EncodeToString(make([]byte, 32)), wantIntegrity: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skey, vkey, err := note.GenerateKey(rand.Reader, "sum.example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gosum := func(path, vers string) ([]byte, error) {
+				if path != "example.com/Mod" || vers != "v1.0.0" {
+					return nil, os.ErrNotExist
+				}
+				return fmt.Appendf(nil, "%s %s %s\n%s %s/go.mod h1:%s\n",
+					path, vers, tt.sumdbHash, path, vers, base64.StdEncoding.EncodeToString(make([]byte, 32))), nil
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle("/sumdb/sum.example/", http.StripPrefix("/sumdb/sum.example", sumdb.NewServer(sumdb.NewTestServer(skey, gosum))))
+			// Module paths are case-encoded in proxy URLs
+			mux.HandleFunc("/example.com/!mod/@v/v1.0.0.zip", func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write(zipData)
+			})
+			server := newRegistryServer(t, mux)
+
+			client := NewClient(WithRegistryHosts(RegistryHost{
+				Host:        "127.0.0.1",
+				Kind:        RegistryGoProxy,
+				MetadataURL: server.URL + "/sumdb/sum.example",
+			}))
+			client.goSumDBKey = vkey
+
+			checksum, err := client.GetChecksum(context.Background(), server.URL+"/example.com/!mod/@v/v1.0.0.zip")
+			if tt.wantIntegrity {
+				if !IsIntegrityError(err) {
+					t.Fatalf("GetChecksum() error = %v, want IntegrityError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetChecksum() error = %v", err)
+			}
+			if want := "sha256:" + sha256Hex(zipData); checksum != want {
+				t.Errorf("GetChecksum() = %s, want %s", checksum, want)
+			}
+		})
+	}
+}
+
+// goModuleZipFixture builds a module zip whose files live under prefix/ (module@version)
+func goModuleZipFixture(t *testing.T, prefix string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(prefix + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func hashZipBytes(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mod.zip")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dirhash.HashZip(path, dirhash.Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h1
+}
@@ -0,0 +1,222 @@
+package httpchecksum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/wharflab/container-source-policy/internal/version"
+)
+
+// maxSidecarSize bounds how much of a checksum file is read
+const maxSidecarSize = 1 << 20
+
+// SidecarConfig enables checksum sidecar files for one host.
+// Sidecars are only trusted for hosts that opt in: a checksum file is only as
+// trustworthy as the server publishing it.
+type SidecarConfig struct {
+	// Host is the hostname the config applies to (e.g., releases.hashicorp.com)
+	Host string
+	// Keyring is an optional armored OpenPGP public keyring. When set, a checksum
+	// file is only used if its detached signature (<file>.sig or <file>.asc) verifies.
+	Keyring string
+}
+
+// SidecarSignatureError indicates a checksum file whose detached signature is
+// missing or does not verify against the configured keyring
+type SidecarSignatureError struct {
+	URL    string
+	Reason string
+}
+
+func (e *SidecarSignatureError) Error() string {
+	return fmt.Sprintf("untrusted checksum file %s: %s", e.URL, e.Reason)
+}
+
+// IsSidecarSignatureError checks if an error is a SidecarSignatureError
+func IsSidecarSignatureError(err error) bool {
+	var sigErr *SidecarSignatureError
+	return errors.As(err, &sigErr)
+}
+
+// WithSidecars enables looking up published checksum files (<file>.sha256, SHA256SUMS, ...)
+// next to downloads on the given hosts
+func WithSidecars(configs ...SidecarConfig) Option {
+	return func(c *Client) {
+		if c.sidecars == nil {
+			c.sidecars = make(map[string]SidecarConfig)
+		}
+		for _, cfg := range configs {
+			c.sidecars[strings.ToLower(cfg.Host)] = cfg
+		}
+	}
+}
+
+// perFileSidecars is the number of sidecarCandidates, listed first, that hold the checksum of a single file
+const perFileSidecars = 2
+
+// sidecarCandidates lists the checksum files commonly published next to fileURL, most specific first:
+//   - <file>.sha256, <file>.sha256sum (Go, Kubernetes)
+//   - <name>_<version>_SHA256SUMS (HashiCorp)
+//   - SHA256SUMS, SHASUMS256.txt (Node.js), sha256sums.txt
+func sidecarCandidates(fileURL *url.URL) []string {
+	base := *fileURL
+	base.RawQuery, base.Fragment = "", ""
+
+	candidates := []string{base.String() + ".sha256", base.String() + ".sha256sum"}
+
+	dir, file := path.Split(base.Path)
+	sibling := func(name string) string {
+		u := base
+		u.Path, u.RawPath = dir+name, ""
+		return u.String()
+	}
+	if parts := strings.SplitN(file, "_", 3); len(parts) == 3 {
+		candidates = append(candidates, sibling(parts[0]+"_"+parts[1]+"_SHA256SUMS"))
+	}
+	return append(candidates, sibling("SHA256SUMS"), sibling("SHASUMS256.txt"), sibling("sha256sums.txt"))
+}
+
+// getChecksumFromSidecar looks for a published checksum file listing the URL's file.
+// Returns an error when the host did not opt in or no sidecar lists the file.
+func (c *Client) getChecksumFromSidecar(ctx context.Context, parsedURL *url.URL) (string, error) {
+	cfg, ok := c.sidecars[strings.ToLower(parsedURL.Hostname())]
+	if !ok {
+		return "", errors.New("sidecars not enabled for host")
+	}
+	fileName, err := url.PathUnescape(path.Base(parsedURL.Path))
+	if err != nil {
+		return "", fmt.Errorf("invalid file name encoding: %w", err)
+	}
+
+	for i, candidate := range sidecarCandidates(parsedURL) {
+		data, err := c.fetchSidecar(ctx, candidate)
+		if err != nil {
+			if IsAuthError(err) {
+				return "", err
+			}
+			continue
+		}
+		hexDigest, ok := parseChecksumFile(data, fileName, i < perFileSidecars)
+		if !ok {
+			continue
+		}
+		if cfg.Keyring != "" {
+			if err := c.verifySidecarSignature(ctx, candidate, data, cfg.Keyring); err != nil {
+				return "", err
+			}
+		}
+		return "sha256:" + strings.ToLower(hexDigest), nil
+	}
+
+	return "", errors.New("no checksum file lists " + fileName)
+}
+
+// fetchSidecar downloads a small checksum or signature file
+func (c *Client) fetchSidecar(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, &AuthError{URL: rawURL, StatusCode: resp.StatusCode}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET request failed: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSidecarSize))
+}
+
+// parseChecksumFile finds the SHA256 for fileName in a checksum file. Supported formats:
+//   - bare hex digest, only in per-file sidecars such as <file>.sha256; a shared SHA256SUMS holding a
+//     single bare digest does not say which file it belongs to
+//   - GNU coreutils: "<hex>  <file>" or "<hex> *<file>"
+//   - BSD: "SHA256 (<file>) = <hex>"
+func parseChecksumFile(data []byte, fileName string, perFile bool) (string, bool) {
+	if trimmed := strings.TrimSpace(string(data)); perFile && isSHA256Hex(trimmed) {
+		return trimmed, true
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if rest, ok := strings.CutPrefix(line, "SHA256 ("); ok {
+			name, digest, ok := strings.Cut(rest, ") = ")
+			if ok && matchesFileName(name, fileName) && isSHA256Hex(digest) {
+				return digest, true
+			}
+			continue
+		}
+
+		digest, name, ok := strings.Cut(line, " ")
+		if !ok || !isSHA256Hex(digest) {
+			continue
+		}
+		name = strings.TrimPrefix(strings.TrimLeft(name, " "), "*")
+		if matchesFileName(name, fileName) {
+			return digest, true
+		}
+	}
+	return "", false
+}
+
+// matchesFileName compares a checksum file entry with the downloaded file's name,
+// allowing a directory prefix (e.g., ./file or dist/file)
+func matchesFileName(entry, fileName string) bool {
+	return entry == fileName || strings.HasSuffix(entry, "/"+fileName)
+}
+
+func isSHA256Hex(s string) bool {
+	return len(s) == 64 && isHexString(s)
+}
+
+// verifySidecarSignature checks the detached OpenPGP signature of a checksum file,
+// published as <file>.sig (binary) or <file>.asc (armored)
+func (c *Client) verifySidecarSignature(ctx context.Context, sidecarURL string, data []byte, keyringPath string) error {
+	keyringData, err := os.ReadFile(keyringPath)
+	if err != nil {
+		return fmt.Errorf("failed to read keyring: %w", err)
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyringData))
+	if err != nil {
+		return fmt.Errorf("failed to parse keyring %s: %w", keyringPath, err)
+	}
+
+	reasons := []string{}
+	for _, ext := range []string{".sig", ".asc"} {
+		sig, err := c.fetchSidecar(ctx, sidecarURL+ext)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %v", ext, err))
+			continue
+		}
+		if ext == ".asc" {
+			_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(sig), nil)
+		} else {
+			_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(sig), nil)
+		}
+		if err == nil {
+			return nil
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %v", ext, err))
+	}
+	return &SidecarSignatureError{URL: sidecarURL, Reason: strings.Join(reasons, "; ")}
+}
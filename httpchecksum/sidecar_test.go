@@ -0,0 +1,227 @@
+package httpchecksum
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+const testDigest = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+func TestParseChecksumFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		file   string
+		shared bool
+		want   string
+		wantOK bool
+	}{
+		{name: "bare hex", data: testDigest + "\n", file: "app.tar.gz", want: testDigest, wantOK: true},
+		{name: "bare hex in shared file", data: testDigest + "\n", file: "app.tar.gz", shared: true},
+		{
+			name: "named entry in shared file", data: testDigest + "  app.tar.gz\n", file: "app.tar.gz", shared: true,
+			want: testDigest, wantOK: true,
+		},
+		{name: "GNU text mode", data: "0000000000000000000000000000000000000000000000000000000000000000  other.zip\n" + testDigest + "  app.tar.gz\n", file: "app.tar.gz", want: testDigest, wantOK: true},
+		{name: "GNU binary mode", data: testDigest + " *app.tar.gz\n", file: "app.tar.gz", want: testDigest, wantOK: true},
+		{name: "directory prefix", data: testDigest + "  ./dist/app.tar.gz\n", file: "app.tar.gz", want: testDigest, wantOK: true},
+		{name: "BSD", data: "SHA256 (app.tar.gz) = " + testDigest + "\n", file: "app.tar.gz", want: testDigest, wantOK: true},
+		{name: "no matching entry", data: testDigest + "  other.zip\n", file: "app.tar.gz"},
+		{name: "suffix is not a match", data: testDigest + "  myapp.tar.gz\n", file: "app.tar.gz"},
+		{name: "SHA512 is ignored", data: "SHA512 (app.tar.gz) = " + testDigest + testDigest + "\n", file: "app.tar.gz"},
+		{name: "HTML error page", data: "<html><body>Not Found</body></html>", file: "app.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseChecksumFile([]byte(tt.data), tt.file, !tt.shared)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseChecksumFile() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSidecarCandidates(t *testing.T) {
+	u, err := url.Parse("https://releases.hashicorp.com/terraform/1.5.0/terraform_1.5.0_linux_amd64.zip?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"https://releases.hashicorp.com/terraform/1.5.0/terraform_1.5.0_linux_amd64.zip.sha256",
+		"https://releases.hashicorp.com/terraform/1.5.0/terraform_1.5.0_linux_amd64.zip.sha256sum",
+		"https://releases.hashicorp.com/terraform/1.5.0/terraform_1.5.0_SHA256SUMS",
+		"https://releases.hashicorp.com/terraform/1.5.0/SHA256SUMS",
+		"https://releases.hashicorp.com/terraform/1.5.0/SHASUMS256.txt",
+		"https://releases.hashicorp.com/terraform/1.5.0/sha256sums.txt",
+	}
+	if got := sidecarCandidates(u); !slices.Equal(got, want) {
+		t.Errorf("sidecarCandidates() = %v, want %v", got, want)
+	}
+}
+
+// sidecarServer serves a large artifact, a SHA256SUMS file and optional signature files
+type sidecarServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	files    map[string][]byte
+	requests []string
+}
+
+func newSidecarServer(t *testing.T, files map[string][]byte) *sidecarServer {
+	t.Helper()
+	s := &sidecarServer{files: files}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+		data, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *sidecarServer) downloaded(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Contains(s.requests, "GET "+path)
+}
+
+func TestGetChecksum_Sidecar(t *testing.T) {
+	artifact := []byte("large artifact content")
+	sum := sha256.Sum256(artifact)
+	digest := hex.EncodeToString(sum[:])
+	sums := []byte(digest + "  app_1.0.0_linux_amd64.tar.gz\n")
+
+	entity, err := openpgp.NewEntity("Release Signing", "", "release@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var goodSig, badSig bytes.Buffer
+	if err := openpgp.DetachSign(&goodSig, entity, bytes.NewReader(sums), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := openpgp.DetachSign(&badSig, entity, strings.NewReader("tampered"), nil); err != nil {
+		t.Fatal(err)
+	}
+	keyring := writeKeyring(t, entity)
+
+	tests := []struct {
+		name         string
+		files        map[string][]byte
+		sidecars     bool
+		keyring      string
+		wantErr      bool
+		wantDownload bool
+	}{
+		{
+			name:     "SHA256SUMS",
+			files:    map[string][]byte{"/SHA256SUMS": sums},
+			sidecars: true,
+		},
+		{
+			name:     "per-file sidecar",
+			files:    map[string][]byte{"/app_1.0.0_linux_amd64.tar.gz.sha256": []byte(digest + "\n")},
+			sidecars: true,
+		},
+		{
+			name:         "host not opted in",
+			files:        map[string][]byte{"/SHA256SUMS": sums},
+			wantDownload: true,
+		},
+		{
+			name:         "no sidecar published",
+			files:        map[string][]byte{},
+			sidecars:     true,
+			wantDownload: true,
+		},
+		{
+			name:     "valid detached signature",
+			files:    map[string][]byte{"/SHA256SUMS": sums, "/SHA256SUMS.sig": goodSig.Bytes()},
+			sidecars: true,
+			keyring:  keyring,
+		},
+		{
+			name:     "bad signature",
+			files:    map[string][]byte{"/SHA256SUMS": sums, "/SHA256SUMS.sig": badSig.Bytes()},
+			sidecars: true,
+			keyring:  keyring,
+			wantErr:  true,
+		},
+		{
+			name:     "missing signature",
+			files:    map[string][]byte{"/SHA256SUMS": sums},
+			sidecars: true,
+			keyring:  keyring,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.files["/app_1.0.0_linux_amd64.tar.gz"] = artifact
+			server := newSidecarServer(t, tt.files)
+			serverURL, _ := url.Parse(server.URL)
+
+			var opts []Option
+			if tt.sidecars {
+				opts = append(opts, WithSidecars(SidecarConfig{Host: serverURL.Hostname(), Keyring: tt.keyring}))
+			}
+			client := NewClient(opts...)
+
+			checksum, err := client.GetChecksum(context.Background(), server.URL+"/app_1.0.0_linux_amd64.tar.gz")
+			if tt.wantErr {
+				if !IsSidecarSignatureError(err) {
+					t.Fatalf("GetChecksum() error = %v, want SidecarSignatureError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetChecksum() error = %v", err)
+			}
+			if checksum != "sha256:"+digest {
+				t.Errorf("GetChecksum() = %v, want sha256:%s", checksum, digest)
+			}
+			if got := server.downloaded("/app_1.0.0_linux_amd64.tar.gz"); got != tt.wantDownload {
+				t.Errorf("artifact downloaded = %v, want %v", got, tt.wantDownload)
+			}
+		})
+	}
+}
+
+func writeKeyring(t *testing.T, entity *openpgp.Entity) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	path := filepath.Join(t.TempDir(), "keyring.asc")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Buildkitd is the part of BuildKit's buildkitd.toml that decides how the builder reaches registries:
+//
+//	[registry."docker.io"]
+//	mirrors = ["mirror.internal:5000", "harbor.internal/proxy.docker.io"]
+//
+//	[registry."mirror.internal:5000"]
+//	http = true
+//	insecure = true
+//	ca = ["/etc/buildkit/mirror-ca.pem"]
+//	[[registry."mirror.internal:5000".keypair]]
+//	key = "/etc/buildkit/client-key.pem"
+//	cert = "/etc/buildkit/client.pem"
+type Buildkitd struct {
+	Registries map[string]BuildkitdRegistry `toml:"registry"`
+}
+
+// BuildkitdRegistry is a [registry."host"] section of buildkitd.toml
+type BuildkitdRegistry struct {
+	// Mirrors are tried in order before the registry itself, each a host optionally followed by a path prefix
+	Mirrors   []string           `toml:"mirrors"`
+	PlainHTTP bool               `toml:"http"`
+	Insecure  bool               `toml:"insecure"`
+	RootCAs   []string           `toml:"ca"`
+	KeyPairs  []BuildkitdKeyPair `toml:"keypair"`
+}
+
+// BuildkitdKeyPair is a client certificate of a registry section
+type BuildkitdKeyPair struct {
+	Key  string `toml:"key"`
+	Cert string `toml:"cert"`
+}
+
+// LoadBuildkitd reads the registry settings of a buildkitd.toml; everything else in the file is ignored.
+// Relative paths are resolved against the file's directory.
+func LoadBuildkitd(path string) (*Buildkitd, error) {
+	var cfg Buildkitd
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to read buildkitd config %s: %w", path, err)
+	}
+
+	baseDir := filepath.Dir(path)
+	registries := make(map[string]BuildkitdRegistry, len(cfg.Registries))
+	for host, reg := range cfg.Registries {
+		for i, mirror := range reg.Mirrors {
+			mirror = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(mirror, "https://"), "http://"), "/")
+			if u, err := url.Parse("//" + mirror); err != nil || u.Host == "" {
+				return nil, fmt.Errorf("invalid mirror %q for registry %s in buildkitd config %s", reg.Mirrors[i], host, path)
+			}
+			reg.Mirrors[i] = mirror
+		}
+		for i := range reg.RootCAs {
+			reg.RootCAs[i] = resolvePath(baseDir, reg.RootCAs[i])
+		}
+		for i := range reg.KeyPairs {
+			pair := &reg.KeyPairs[i]
+			if err := validateClientCert("registry "+host, pair.Cert, pair.Key); err != nil {
+				return nil, fmt.Errorf("%w in buildkitd config %s", err, path)
+			}
+			pair.Cert = resolvePath(baseDir, pair.Cert)
+			pair.Key = resolvePath(baseDir, pair.Key)
+		}
+		registries[strings.ToLower(host)] = reg
+	}
+	cfg.Registries = registries
+	return &cfg, nil
+}
+
+// Mirrors returns the mirrors of each registry that has some
+func (b *Buildkitd) Mirrors() map[string][]string {
+	mirrors := make(map[string][]string)
+	for host, reg := range b.Registries {
+		if len(reg.Mirrors) > 0 {
+			mirrors[host] = reg.Mirrors
+		}
+	}
+	return mirrors
+}
+
+// NetworkHosts translates the TLS and plain-HTTP settings of the registry sections into network hosts.
+// Only the first keypair is used.
+func (b *Buildkitd) NetworkHosts() []NetworkHost {
+	var hosts []NetworkHost
+	for _, host := range slices.Sorted(maps.Keys(b.Registries)) {
+		reg := b.Registries[host]
+		if !reg.PlainHTTP && !reg.Insecure && len(reg.RootCAs) == 0 && len(reg.KeyPairs) == 0 {
+			continue
+		}
+		networkHost := NetworkHost{Host: host, Insecure: reg.Insecure, PlainHTTP: reg.PlainHTTP}
+		if len(reg.RootCAs) > 0 {
+			networkHost.CACert = reg.RootCAs[0]
+			networkHost.ExtraCACerts = reg.RootCAs[1:]
+		}
+		if len(reg.KeyPairs) > 0 {
+			networkHost.ClientCert, networkHost.ClientKey = reg.KeyPairs[0].Cert, reg.KeyPairs[0].Key
+		}
+		hosts = append(hosts, networkHost)
+	}
+	return hosts
+}
+
+// MergeHosts adds hosts to the network settings. Settings already configured for a host are kept,
+// and only the ones it leaves unset are taken from hosts.
+func (n *NetworkConfig) MergeHosts(hosts ...NetworkHost) {
+	for _, host := range hosts {
+		i := slices.IndexFunc(n.Hosts, func(h NetworkHost) bool { return strings.EqualFold(h.Host, host.Host) })
+		if i < 0 {
+			n.Hosts = append(n.Hosts, host)
+			continue
+		}
+		existing := &n.Hosts[i]
+		if existing.CACert == "" {
+			existing.CACert = host.CACert
+		} else if host.CACert != "" {
+			existing.ExtraCACerts = append(existing.ExtraCACerts, host.CACert)
+		}
+		existing.ExtraCACerts = append(existing.ExtraCACerts, host.ExtraCACerts...)
+		if existing.ClientCert == "" {
+			existing.ClientCert, existing.ClientKey = host.ClientCert, host.ClientKey
+		}
+		existing.Insecure = existing.Insecure || host.Insecure
+		existing.PlainHTTP = existing.PlainHTTP || host.PlainHTTP
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadBuildkitd(t *testing.T) {
+	path := writeConfig(t, `
+debug = true
+
+[worker.oci]
+enabled = true
+
+[registry."docker.io"]
+mirrors = ["mirror.internal:5000", "https://harbor.internal/proxy.docker.io/"]
+
+[registry."Mirror.Internal:5000"]
+http = true
+insecure = true
+ca = ["certs/mirror-ca.pem", "/etc/buildkit/extra-ca.pem"]
+
+[[registry."Mirror.Internal:5000".keypair]]
+key = "certs/client-key.pem"
+cert = "certs/client.pem"
+
+[[registry."Mirror.Internal:5000".keypair]]
+key = "/etc/buildkit/other-key.pem"
+cert = "/etc/buildkit/other.pem"
+
+[registry."ghcr.io"]
+mirrors = []
+`)
+	dir := filepath.Dir(path)
+
+	buildkitd, err := LoadBuildkitd(path)
+	if err != nil {
+		t.Fatalf("LoadBuildkitd() error = %v", err)
+	}
+
+	wantMirrors := map[string][]string{"docker.io": {"mirror.internal:5000", "harbor.internal/proxy.docker.io"}}
+	if got := buildkitd.Mirrors(); !reflect.DeepEqual(got, wantMirrors) {
+		t.Errorf("Mirrors() = %v, want %v", got, wantMirrors)
+	}
+
+	wantHosts := []NetworkHost{{
+		Host:         "mirror.internal:5000",
+		CACert:       filepath.Join(dir, "certs", "mirror-ca.pem"),
+		ExtraCACerts: []string{"/etc/buildkit/extra-ca.pem"},
+		ClientCert:   filepath.Join(dir, "certs", "client.pem"),
+		ClientKey:    filepath.Join(dir, "certs", "client-key.pem"),
+		Insecure:     true,
+		PlainHTTP:    true,
+	}}
+	if got := buildkitd.NetworkHosts(); !reflect.DeepEqual(got, wantHosts) {
+		t.Errorf("NetworkHosts() = %+v, want %+v", got, wantHosts)
+	}
+}
+
+func TestLoadBuildkitd_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "invalid toml", content: `[registry."docker.io"`, wantErr: "failed to read buildkitd config"},
+		{
+			name:    "empty mirror",
+			content: "[registry.\"docker.io\"]\nmirrors = [\"https://\"]",
+			wantErr: `invalid mirror "https://" for registry docker.io`,
+		},
+		{
+			name:    "key without cert",
+			content: "[[registry.\"r.internal\".keypair]]\nkey = \"key.pem\"",
+			wantErr: "client-cert and client-key for registry r.internal must be set together",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadBuildkitd(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadBuildkitd() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNetworkConfig_MergeHosts(t *testing.T) {
+	network := NetworkConfig{Hosts: []NetworkHost{
+		{Host: "registry.internal", CACert: "/config/ca.pem", ClientCert: "/config/client.pem", ClientKey: "/config/key.pem"},
+	}}
+
+	network.MergeHosts(
+		NetworkHost{
+			Host:       "REGISTRY.internal",
+			CACert:     "/buildkit/ca.pem",
+			ClientCert: "/buildkit/client.pem",
+			ClientKey:  "/buildkit/key.pem",
+			PlainHTTP:  true,
+		},
+		NetworkHost{Host: "mirror.internal", Insecure: true},
+	)
+
+	want := []NetworkHost{
+		{
+			Host:         "registry.internal",
+			CACert:       "/config/ca.pem",
+			ExtraCACerts: []string{"/buildkit/ca.pem"},
+			ClientCert:   "/config/client.pem",
+			ClientKey:    "/config/key.pem",
+			PlainHTTP:    true,
+		},
+		{Host: "mirror.internal", Insecure: true},
+	}
+	if !reflect.DeepEqual(network.Hosts, want) {
+		t.Errorf("MergeHosts() = %+v, want %+v", network.Hosts, want)
+	}
+}
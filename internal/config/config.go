@@ -0,0 +1,337 @@
+// Package config loads the optional container-source-policy configuration file (TOML).
+//
+// Example:
+//
+//	[[git.remote]]
+//	url = "https://github.com/moby/"
+//	keyring = "keys/moby.asc"
+//	on-failure = "warn"
+//
+//	[[git.remote]]
+//	url = "git@github.com:myorg/"
+//	allowed-signers = "allowed_signers"
+//
+//	[http]
+//	max-redirects = 5
+//	same-host-redirects = true
+//	redirect-hosts = ["objects.githubusercontent.com"]
+//
+//	[[http.host]]
+//	host = "releases.hashicorp.com"
+//	sidecars = true
+//	sidecar-keyring = "keys/hashicorp.asc"
+//
+//	[[http.host]]
+//	host = "devpi.internal"
+//	registry = "pypi"
+//	registry-url = "https://devpi.internal/root/pypi/+simple/"
+//
+//	[[http.host]]
+//	host = "artifacts.internal"
+//	token-env = "ARTIFACTS_TOKEN"
+//
+//	[[http.host]]
+//	host = "github.example.com"
+//	github = true
+//
+//	[[http.host]]
+//	host = "gitlab.example.com"
+//	gitlab = true
+//
+//	[network]
+//	cacert = "certs/internal-ca.pem"
+//	proxy = "http://proxy.internal:3128"
+//	no-proxy = [".internal"]
+//
+//	[[network.host]]
+//	host = "registry.internal:5000"
+//	client-cert = "certs/ci.pem"
+//	client-key = "certs/ci-key.pem"
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// OnFailure values decide what happens when a check fails for a source
+const (
+	// OnFailureError refuses to pin the source (the default)
+	OnFailureError = "error"
+	// OnFailureWarn pins the source anyway and emits a warning
+	OnFailureWarn = "warn"
+)
+
+// Config is the top-level configuration file
+type Config struct {
+	Git     GitConfig     `toml:"git"`
+	HTTP    HTTPConfig    `toml:"http"`
+	Network NetworkConfig `toml:"network"`
+}
+
+// GitConfig holds settings for git sources
+type GitConfig struct {
+	Remotes []GitRemote `toml:"remote"`
+}
+
+// GitRemote holds settings for the git remotes whose URL starts with URL.
+// When several entries match, the longest URL wins.
+type GitRemote struct {
+	// URL is the remote URL prefix (e.g., https://github.com/moby/ or git@github.com:myorg/)
+	URL string `toml:"url"`
+	// Keyring is an armored OpenPGP public keyring trusted to sign tags and commits
+	Keyring string `toml:"keyring"`
+	// AllowedSigners is an ssh allowed signers file (see ssh-keygen(1)) trusted to sign tags and commits
+	AllowedSigners string `toml:"allowed-signers"`
+	// OnFailure is "error" (default) or "warn" for missing or untrusted signatures
+	OnFailure string `toml:"on-failure"`
+}
+
+// HTTPConfig holds settings for HTTP sources
+type HTTPConfig struct {
+	// MaxRedirects is the longest redirect chain followed; 0 means 10
+	MaxRedirects int `toml:"max-redirects"`
+	// SameHostRedirects refuses redirects to another host, except to RedirectHosts
+	SameHostRedirects bool `toml:"same-host-redirects"`
+	// RedirectHosts are the other hosts redirects may lead to (e.g., a CDN) when SameHostRedirects is set
+	RedirectHosts []string `toml:"redirect-hosts"`
+
+	Hosts []HTTPHost `toml:"host"`
+}
+
+// HTTPHost holds settings for one HTTP host
+type HTTPHost struct {
+	// Host is the hostname (exact match, e.g., releases.hashicorp.com)
+	Host string `toml:"host"`
+	// Sidecars trusts checksum files published next to downloads (<file>.sha256, SHA256SUMS)
+	Sidecars bool `toml:"sidecars"`
+	// SidecarKeyring is an armored OpenPGP public keyring; when set, checksum files must carry a valid detached signature
+	SidecarKeyring string `toml:"sidecar-keyring"`
+	// Registry marks the host as a package registry mirror: pypi, npm, maven or goproxy
+	Registry string `toml:"registry"`
+	// RegistryURL is where the registry's digests are looked up (PyPI simple index, npm registry,
+	// Go checksum database proxy); empty uses the public service
+	RegistryURL string `toml:"registry-url"`
+	// GitHub marks the host as a GitHub Enterprise Server whose release downloads are looked up through its API
+	GitHub bool `toml:"github"`
+	// GitHubAPIURL is the server's REST API root; empty means https://<host>/api/v3
+	GitHubAPIURL string `toml:"github-api-url"`
+	// GitLab marks the host as a self-managed GitLab whose generic packages and release links are looked up through its API
+	GitLab bool `toml:"gitlab"`
+	// GitLabAPIURL is the instance's REST API root; empty means https://<host>/api/v4
+	GitLabAPIURL string `toml:"gitlab-api-url"`
+	// Token is a bearer token for the host; TokenEnv names the environment variable holding it instead
+	Token    string `toml:"token"`
+	TokenEnv string `toml:"token-env"`
+	// Username and Password (or the environment variable named by PasswordEnv) are sent with basic auth
+	Username    string `toml:"username"`
+	Password    string `toml:"password"`
+	PasswordEnv string `toml:"password-env"`
+}
+
+// NetworkConfig holds the TLS and proxy settings shared by the HTTP, registry and git clients
+type NetworkConfig struct {
+	// CACert is a PEM bundle of certificate authorities trusted in addition to the system roots
+	CACert string `toml:"cacert"`
+	// ClientCert and ClientKey are a PEM client certificate and its key, presented to servers that ask for one
+	ClientCert string `toml:"client-cert"`
+	ClientKey  string `toml:"client-key"`
+	// Proxy is the proxy URL for HTTP(S) connections; empty uses HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+	Proxy string `toml:"proxy"`
+	// NoProxy are the hosts (and, with a leading dot or not, their subdomains) reached without Proxy
+	NoProxy []string `toml:"no-proxy"`
+
+	Hosts []NetworkHost `toml:"host"`
+}
+
+// NetworkHost holds the TLS settings for one host, on top of the NetworkConfig ones
+type NetworkHost struct {
+	// Host is the hostname, optionally with a port (e.g., registry.internal:5000)
+	Host string `toml:"host"`
+	// CACert is trusted for this host in addition to the system roots and NetworkConfig.CACert
+	CACert string `toml:"cacert"`
+	// ExtraCACerts are further CA files trusted for this host, from a buildkitd.toml that lists several
+	ExtraCACerts []string `toml:"-"`
+	// ClientCert and ClientKey replace the NetworkConfig client certificate for this host
+	ClientCert string `toml:"client-cert"`
+	ClientKey  string `toml:"client-key"`
+	// Insecure skips verifying the host's certificate
+	Insecure bool `toml:"insecure"`
+	// PlainHTTP contacts a container registry over HTTP instead of HTTPS
+	PlainHTTP bool `toml:"plain-http"`
+}
+
+// registryKinds are the valid values of HTTPHost.Registry
+var registryKinds = []string{"pypi", "npm", "maven", "goproxy"}
+
+// Load reads a configuration file. Relative paths in it are resolved against the file's directory.
+func Load(path string) (*Config, error) {
+	var cfg Config
+	meta, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown key %q in config %s", undecoded[0].String(), path)
+	}
+
+	baseDir := filepath.Dir(path)
+	for i := range cfg.Git.Remotes {
+		remote := &cfg.Git.Remotes[i]
+		if remote.URL == "" {
+			return nil, fmt.Errorf("git.remote entry %d in config %s has no url", i+1, path)
+		}
+		switch remote.OnFailure {
+		case "":
+			remote.OnFailure = OnFailureError
+		case OnFailureError, OnFailureWarn:
+		default:
+			return nil, fmt.Errorf("invalid on-failure %q for git remote %s (expected error or warn)", remote.OnFailure, remote.URL)
+		}
+		remote.Keyring = resolvePath(baseDir, remote.Keyring)
+		remote.AllowedSigners = resolvePath(baseDir, remote.AllowedSigners)
+	}
+
+	if cfg.HTTP.MaxRedirects < 0 {
+		return nil, fmt.Errorf("invalid http max-redirects %d in config %s", cfg.HTTP.MaxRedirects, path)
+	}
+	if len(cfg.HTTP.RedirectHosts) > 0 && !cfg.HTTP.SameHostRedirects {
+		return nil, fmt.Errorf("http redirect-hosts in config %s requires same-host-redirects = true", path)
+	}
+	for i := range cfg.HTTP.Hosts {
+		host := &cfg.HTTP.Hosts[i]
+		if host.Host == "" {
+			return nil, fmt.Errorf("http.host entry %d in config %s has no host", i+1, path)
+		}
+		if host.SidecarKeyring != "" && !host.Sidecars {
+			return nil, fmt.Errorf("sidecar-keyring for http host %s requires sidecars = true", host.Host)
+		}
+		host.SidecarKeyring = resolvePath(baseDir, host.SidecarKeyring)
+		if host.Registry != "" && !slices.Contains(registryKinds, host.Registry) {
+			return nil, fmt.Errorf("invalid registry %q for http host %s (expected one of %s)",
+				host.Registry, host.Host, strings.Join(registryKinds, ", "))
+		}
+		if host.RegistryURL != "" && host.Registry == "" {
+			return nil, fmt.Errorf("registry-url for http host %s requires registry", host.Host)
+		}
+		if host.GitHubAPIURL != "" && !host.GitHub {
+			return nil, fmt.Errorf("github-api-url for http host %s requires github = true", host.Host)
+		}
+		if host.GitLabAPIURL != "" && !host.GitLab {
+			return nil, fmt.Errorf("gitlab-api-url for http host %s requires gitlab = true", host.Host)
+		}
+		if err := host.validateAuth(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Network.resolve(baseDir); err != nil {
+		return nil, fmt.Errorf("%w in config %s", err, path)
+	}
+
+	return &cfg, nil
+}
+
+// resolve validates the network settings and resolves their paths against baseDir
+func (n *NetworkConfig) resolve(baseDir string) error {
+	if err := validateClientCert("network", n.ClientCert, n.ClientKey); err != nil {
+		return err
+	}
+	if n.Proxy != "" {
+		if u, err := url.Parse(n.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid network proxy %q", n.Proxy)
+		}
+	}
+	n.CACert = resolvePath(baseDir, n.CACert)
+	n.ClientCert = resolvePath(baseDir, n.ClientCert)
+	n.ClientKey = resolvePath(baseDir, n.ClientKey)
+
+	for i := range n.Hosts {
+		host := &n.Hosts[i]
+		if host.Host == "" {
+			return fmt.Errorf("network.host entry %d has no host", i+1)
+		}
+		if err := validateClientCert("network host "+host.Host, host.ClientCert, host.ClientKey); err != nil {
+			return err
+		}
+		host.CACert = resolvePath(baseDir, host.CACert)
+		host.ClientCert = resolvePath(baseDir, host.ClientCert)
+		host.ClientKey = resolvePath(baseDir, host.ClientKey)
+	}
+	return nil
+}
+
+// validateClientCert checks that a client certificate and its key are given together
+func validateClientCert(owner, cert, key string) error {
+	if (cert == "") != (key == "") {
+		return fmt.Errorf("client-cert and client-key for %s must be set together", owner)
+	}
+	return nil
+}
+
+// Remote returns the settings for a git remote, or nil when no entry matches
+func (g *GitConfig) Remote(remote string) *GitRemote {
+	var best *GitRemote
+	for i := range g.Remotes {
+		entry := &g.Remotes[i]
+		if strings.HasPrefix(remote, entry.URL) && (best == nil || len(entry.URL) > len(best.URL)) {
+			best = entry
+		}
+	}
+	return best
+}
+
+// validateAuth checks that at most one way of authenticating is configured
+func (h *HTTPHost) validateAuth() error {
+	hasToken := h.Token != "" || h.TokenEnv != ""
+	hasPassword := h.Password != "" || h.PasswordEnv != ""
+	switch {
+	case h.Token != "" && h.TokenEnv != "":
+		return fmt.Errorf("http host %s sets both token and token-env", h.Host)
+	case h.Password != "" && h.PasswordEnv != "":
+		return fmt.Errorf("http host %s sets both password and password-env", h.Host)
+	case hasToken && (h.Username != "" || hasPassword):
+		return fmt.Errorf("http host %s sets both a token and a username/password", h.Host)
+	case hasPassword && h.Username == "":
+		return fmt.Errorf("password for http host %s requires username", h.Host)
+	}
+	return nil
+}
+
+// Credentials returns the host's token or username and password, reading the environment variables
+// named by token-env and password-env. All three are empty when the host has no credentials configured.
+func (h *HTTPHost) Credentials() (token, username, password string, err error) {
+	token, password = h.Token, h.Password
+	if h.TokenEnv != "" {
+		if token = os.Getenv(h.TokenEnv); token == "" {
+			return "", "", "", fmt.Errorf("environment variable %s for http host %s is not set", h.TokenEnv, h.Host)
+		}
+	}
+	if h.PasswordEnv != "" {
+		if password = os.Getenv(h.PasswordEnv); password == "" {
+			return "", "", "", fmt.Errorf("environment variable %s for http host %s is not set", h.PasswordEnv, h.Host)
+		}
+	}
+	return token, h.Username, password, nil
+}
+
+// LoadOptional loads path, or returns an empty configuration when path is empty
+func LoadOptional(path string) (*Config, error) {
+	if path == "" {
+		return &Config{}, nil
+	}
+	return Load(path)
+}
+
+func resolvePath(baseDir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
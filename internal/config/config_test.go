@@ -0,0 +1,320 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+[[git.remote]]
+url = "https://github.com/"
+keyring = "keys/github.asc"
+on-failure = "warn"
+
+[[git.remote]]
+url = "https://github.com/moby/"
+allowed-signers = "/etc/allowed_signers"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	remote := cfg.Git.Remote("https://github.com/moby/buildkit.git")
+	if remote == nil || remote.URL != "https://github.com/moby/" {
+		t.Fatalf("Remote() = %+v, want the longest matching entry", remote)
+	}
+	if remote.AllowedSigners != "/etc/allowed_signers" {
+		t.Errorf("AllowedSigners = %q, want absolute path kept", remote.AllowedSigners)
+	}
+	if remote.OnFailure != OnFailureError {
+		t.Errorf("OnFailure = %q, want default %q", remote.OnFailure, OnFailureError)
+	}
+
+	remote = cfg.Git.Remote("https://github.com/cli/cli.git")
+	if remote == nil || remote.Keyring != filepath.Join(filepath.Dir(path), "keys", "github.asc") {
+		t.Errorf("Remote() = %+v, want keyring resolved next to the config file", remote)
+	}
+	if remote.OnFailure != OnFailureWarn {
+		t.Errorf("OnFailure = %q, want %q", remote.OnFailure, OnFailureWarn)
+	}
+
+	if remote := cfg.Git.Remote("git@gitlab.com:owner/repo.git"); remote != nil {
+		t.Errorf("Remote() = %+v, want nil for an unconfigured remote", remote)
+	}
+}
+
+func TestLoad_HTTPHosts(t *testing.T) {
+	path := writeConfig(t, `
+[http]
+max-redirects = 3
+same-host-redirects = true
+redirect-hosts = ["cdn.example.com"]
+
+[[http.host]]
+host = "releases.hashicorp.com"
+sidecars = true
+sidecar-keyring = "hashicorp.asc"
+
+[[http.host]]
+host = "verdaccio.internal"
+registry = "npm"
+registry-url = "https://verdaccio.internal/"
+
+[[http.host]]
+host = "ghe.example.com"
+github = true
+
+[[http.host]]
+host = "gitlab.example.com"
+gitlab = true
+gitlab-api-url = "https://gitlab.example.com/gitlab/api/v4"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.HTTP.MaxRedirects != 3 || !cfg.HTTP.SameHostRedirects || len(cfg.HTTP.RedirectHosts) != 1 {
+		t.Errorf("unexpected redirect settings: %+v", cfg.HTTP)
+	}
+	if len(cfg.HTTP.Hosts) != 4 {
+		t.Fatalf("expected 4 http hosts, got %d", len(cfg.HTTP.Hosts))
+	}
+	host := cfg.HTTP.Hosts[0]
+	if !host.Sidecars || host.SidecarKeyring != filepath.Join(filepath.Dir(path), "hashicorp.asc") {
+		t.Errorf("unexpected host settings: %+v", host)
+	}
+	if mirror := cfg.HTTP.Hosts[1]; mirror.Registry != "npm" || mirror.RegistryURL != "https://verdaccio.internal/" {
+		t.Errorf("unexpected registry host settings: %+v", mirror)
+	}
+	if ghes := cfg.HTTP.Hosts[2]; !ghes.GitHub || ghes.GitHubAPIURL != "" {
+		t.Errorf("unexpected github host settings: %+v", ghes)
+	}
+	if gitlab := cfg.HTTP.Hosts[3]; !gitlab.GitLab || gitlab.GitLabAPIURL != "https://gitlab.example.com/gitlab/api/v4" {
+		t.Errorf("unexpected gitlab host settings: %+v", gitlab)
+	}
+}
+
+func TestLoad_Network(t *testing.T) {
+	path := writeConfig(t, `
+[network]
+cacert = "certs/internal-ca.pem"
+proxy = "http://proxy.internal:3128"
+no-proxy = [".internal", "localhost"]
+
+[[network.host]]
+host = "registry.internal:5000"
+client-cert = "/etc/ci/client.pem"
+client-key = "/etc/ci/client-key.pem"
+
+[[network.host]]
+host = "legacy.internal"
+plain-http = true
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	network := cfg.Network
+	if network.CACert != filepath.Join(filepath.Dir(path), "certs", "internal-ca.pem") {
+		t.Errorf("CACert = %q, want it resolved next to the config file", network.CACert)
+	}
+	if network.Proxy != "http://proxy.internal:3128" || len(network.NoProxy) != 2 {
+		t.Errorf("unexpected proxy settings: %+v", network)
+	}
+	if len(network.Hosts) != 2 {
+		t.Fatalf("expected 2 network hosts, got %d", len(network.Hosts))
+	}
+	if host := network.Hosts[0]; host.ClientCert != "/etc/ci/client.pem" || host.ClientKey != "/etc/ci/client-key.pem" {
+		t.Errorf("unexpected host settings: %+v", host)
+	}
+	if host := network.Hosts[1]; !host.PlainHTTP || host.Insecure {
+		t.Errorf("unexpected host settings: %+v", host)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown key",
+			content: "[[git.remote]]\nurl = \"https://github.com/\"\nkeyrign = \"typo.asc\"\n",
+			wantErr: "unknown key",
+		},
+		{
+			name:    "missing url",
+			content: "[[git.remote]]\nkeyring = \"keys.asc\"\n",
+			wantErr: "has no url",
+		},
+		{
+			name:    "invalid on-failure",
+			content: "[[git.remote]]\nurl = \"https://github.com/\"\non-failure = \"ignore\"\n",
+			wantErr: "invalid on-failure",
+		},
+		{
+			name:    "http host without name",
+			content: "[[http.host]]\nsidecars = true\n",
+			wantErr: "has no host",
+		},
+		{
+			name:    "sidecar keyring without sidecars",
+			content: "[[http.host]]\nhost = \"example.com\"\nsidecar-keyring = \"k.asc\"\n",
+			wantErr: "requires sidecars = true",
+		},
+		{
+			name:    "unknown registry",
+			content: "[[http.host]]\nhost = \"example.com\"\nregistry = \"cargo\"\n",
+			wantErr: "invalid registry",
+		},
+		{
+			name:    "registry url without registry",
+			content: "[[http.host]]\nhost = \"example.com\"\nregistry-url = \"https://example.com/simple/\"\n",
+			wantErr: "requires registry",
+		},
+		{
+			name:    "github api url without github",
+			content: "[[http.host]]\nhost = \"ghe.example.com\"\ngithub-api-url = \"https://ghe.example.com/api/v3\"\n",
+			wantErr: "requires github = true",
+		},
+		{
+			name:    "gitlab api url without gitlab",
+			content: "[[http.host]]\nhost = \"gitlab.example.com\"\ngitlab-api-url = \"https://gitlab.example.com/api/v4\"\n",
+			wantErr: "requires gitlab = true",
+		},
+		{
+			name:    "negative max-redirects",
+			content: "[http]\nmax-redirects = -1\n",
+			wantErr: "invalid http max-redirects",
+		},
+		{
+			name:    "redirect hosts without same-host-redirects",
+			content: "[http]\nredirect-hosts = [\"cdn.example.com\"]\n",
+			wantErr: "requires same-host-redirects = true",
+		},
+		{
+			name:    "token and token-env",
+			content: "[[http.host]]\nhost = \"example.com\"\ntoken = \"t\"\ntoken-env = \"TOKEN\"\n",
+			wantErr: "both token and token-env",
+		},
+		{
+			name:    "token and username",
+			content: "[[http.host]]\nhost = \"example.com\"\ntoken = \"t\"\nusername = \"ci\"\n",
+			wantErr: "both a token and a username/password",
+		},
+		{
+			name:    "password without username",
+			content: "[[http.host]]\nhost = \"example.com\"\npassword-env = \"PASSWORD\"\n",
+			wantErr: "requires username",
+		},
+		{
+			name:    "client cert without key",
+			content: "[network]\nclient-cert = \"client.pem\"\n",
+			wantErr: "must be set together",
+		},
+		{
+			name:    "network host client key without cert",
+			content: "[[network.host]]\nhost = \"registry.internal\"\nclient-key = \"key.pem\"\n",
+			wantErr: "must be set together",
+		},
+		{
+			name:    "network host without name",
+			content: "[[network.host]]\ninsecure = true\n",
+			wantErr: "has no host",
+		},
+		{
+			name:    "proxy without scheme",
+			content: "[network]\nproxy = \"proxy.internal:3128\"\n",
+			wantErr: "invalid network proxy",
+		},
+		{
+			name:    "invalid TOML",
+			content: "[[git.remote]\n",
+			wantErr: "failed to read config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPHostCredentials(t *testing.T) {
+	t.Setenv("ARTIFACTS_TOKEN", "s3cr3t")
+	t.Setenv("NEXUS_PASSWORD", "hunter2")
+
+	tests := []struct {
+		name         string
+		host         HTTPHost
+		wantToken    string
+		wantUsername string
+		wantPassword string
+		wantErr      string
+	}{
+		{name: "none", host: HTTPHost{Host: "example.com"}},
+		{name: "inline token", host: HTTPHost{Host: "example.com", Token: "abc"}, wantToken: "abc"},
+		{name: "token from env", host: HTTPHost{Host: "example.com", TokenEnv: "ARTIFACTS_TOKEN"}, wantToken: "s3cr3t"},
+		{
+			name:         "password from env",
+			host:         HTTPHost{Host: "example.com", Username: "ci", PasswordEnv: "NEXUS_PASSWORD"},
+			wantUsername: "ci",
+			wantPassword: "hunter2",
+		},
+		{
+			name:    "unset env",
+			host:    HTTPHost{Host: "example.com", TokenEnv: "CONTAINER_SOURCE_POLICY_UNSET_TOKEN"},
+			wantErr: "CONTAINER_SOURCE_POLICY_UNSET_TOKEN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, username, password, err := tt.host.Credentials()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Credentials() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Credentials() error = %v", err)
+			}
+			if token != tt.wantToken || username != tt.wantUsername || password != tt.wantPassword {
+				t.Errorf("Credentials() = %q, %q, %q, want %q, %q, %q",
+					token, username, password, tt.wantToken, tt.wantUsername, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestLoadOptional_Empty(t *testing.T) {
+	cfg, err := LoadOptional("")
+	if err != nil {
+		t.Fatalf("LoadOptional() error = %v", err)
+	}
+	if cfg.Git.Remote("https://github.com/owner/repo.git") != nil {
+		t.Error("expected no remotes in the default config")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/moby/buildkit/frontend/dockerfile/dfgitutil"
 	"github.com/moby/buildkit/frontend/dockerfile/instructions"
 	"github.com/moby/buildkit/frontend/dockerfile/parser"
 )
@@ -35,8 +36,10 @@ type HTTPSourceRef struct {
 
 // GitSourceRef represents a Git source reference extracted from a Dockerfile ADD instruction.
 // BuildKit supports git URLs in ADD instructions for fetching repositories during build.
+// Note: URLs with an embedded checksum (?checksum= or ?commit=) are excluded (already pinned).
 type GitSourceRef struct {
-	// URL is the Git URL as it appears in the Dockerfile (e.g., https://github.com/owner/repo.git#ref)
+	// URL is the Git URL as it appears in the Dockerfile
+	// (e.g., https://github.com/owner/repo.git#ref or https://github.com/owner/repo.git?ref=v1&subdir=docs)
 	URL string
 	// Line is the line number in the Dockerfile where this reference appears
 	Line int
@@ -230,7 +233,10 @@ func extractAddSources(addCmd *instructions.AddCommand, line int) ([]HTTPSourceR
 		}
 
 		if isGitURL(src) {
-			// Git URLs
+			// Git URLs with an embedded checksum are already pinned, like ADD --checksum
+			if hasGitChecksum(src) {
+				continue
+			}
 			gitRefs = append(gitRefs, GitSourceRef{
 				URL:  src,
 				Line: line,
@@ -356,6 +362,17 @@ func isGitURL(s string) bool {
 	return false
 }
 
+// hasGitChecksum checks if a Git URL already pins its commit via the query-string form
+// (e.g., https://github.com/owner/repo.git?ref=v1.0.0&checksum=<sha>)
+func hasGitChecksum(s string) bool {
+	gitRef, _, err := dfgitutil.ParseGitRef(s)
+	if err != nil {
+		// Leave invalid URLs to the resolver, which reports a proper error
+		return false
+	}
+	return gitRef.Checksum != ""
+}
+
 // isHTTPURL checks if a string is an HTTP or HTTPS URL (non-git)
 func isHTTPURL(s string) bool {
 	u, err := url.Parse(s)
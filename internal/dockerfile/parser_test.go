@@ -361,6 +361,21 @@ func TestParseAll_GitSources(t *testing.T) {
 			wantImageCount: 1,
 			wantGitURLs:    nil,
 		},
+		{
+			name:           "ADD with query-form git URL",
+			dockerfile:     "FROM alpine:3.18\nADD https://github.com/owner/repo.git?ref=v1.2.3&subdir=docs&keep-git-dir=true /app/",
+			wantGitCount:   1,
+			wantImageCount: 1,
+			wantGitURLs:    []string{"https://github.com/owner/repo.git?ref=v1.2.3&subdir=docs&keep-git-dir=true"},
+		},
+		{
+			name: "ADD with query-form git URL and checksum is skipped",
+			dockerfile: "FROM alpine:3.18\n" +
+				"ADD https://github.com/owner/repo.git?ref=v1.2.3&checksum=54d56cab3a0882b43ac794df59924dc3f93bb75c /app/",
+			wantGitCount:   0,
+			wantImageCount: 1,
+			wantGitURLs:    nil,
+		},
 		{
 			name:           "ADD with variable in git URL is skipped",
 			dockerfile:     "FROM alpine:3.18\nARG TAG=v1.0.0\nADD https://github.com/owner/repo.git#${TAG} /app/",
@@ -583,6 +598,7 @@ func TestIsGitURL(t *testing.T) {
 	}{
 		{"https with .git suffix", "https://github.com/owner/repo.git", true},
 		{"https with .git and fragment", "https://github.com/owner/repo.git#main", true},
+		{"https with .git and query", "https://github.com/owner/repo.git?ref=main&subdir=docs", true},
 		{"http with .git suffix", "http://example.com/repo.git", true},
 		{"git protocol", "git://github.com/owner/repo", true},
 		{"ssh protocol", "ssh://git@github.com/owner/repo.git", true},
@@ -0,0 +1,72 @@
+package git
+
+import (
+	"net/url"
+	"strings"
+)
+
+// GitHubArchive is a source archive GitHub generates on the fly from a ref. Its bytes are not
+// guaranteed to be stable (compression changes have altered them before), unlike the commit.
+type GitHubArchive struct {
+	// Remote is the repository URL (e.g., https://github.com/owner/repo.git)
+	Remote string
+	// Ref is the tag, branch or commit the archive is generated from
+	Ref string
+}
+
+// archiveExtensions are the formats served under github.com/<owner>/<repo>/archive/
+var archiveExtensions = []string{".tar.gz", ".zip"}
+
+// codeloadFormats are the first path segment of codeload.github.com URLs
+var codeloadFormats = []string{"tar.gz", "zip", "legacy.tar.gz", "legacy.zip"}
+
+// ParseGitHubArchiveURL recognises GitHub archive downloads:
+//   - https://github.com/owner/repo/archive/refs/tags/v1.0.tar.gz (also refs/heads/, a bare ref, or .zip)
+//   - https://codeload.github.com/owner/repo/tar.gz/refs/tags/v1.0 (also zip, legacy.tar.gz, legacy.zip)
+func ParseGitHubArchiveURL(rawURL string) (*GitHubArchive, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 4)
+	if len(parts) != 4 || parts[0] == "" || parts[1] == "" {
+		return nil, false
+	}
+
+	var ref string
+	switch strings.ToLower(u.Hostname()) {
+	case "github.com", "www.github.com":
+		if parts[2] != "archive" {
+			return nil, false
+		}
+		for _, ext := range archiveExtensions {
+			if name, ok := strings.CutSuffix(parts[3], ext); ok {
+				ref = name
+				break
+			}
+		}
+	case "codeload.github.com":
+		for _, format := range codeloadFormats {
+			if parts[2] == format {
+				ref = parts[3]
+				break
+			}
+		}
+	default:
+		return nil, false
+	}
+
+	// refs/tags/ and refs/heads/ name the ref unambiguously; the short name is what BuildKit users write
+	for _, prefix := range []string{"refs/tags/", "refs/heads/"} {
+		ref = strings.TrimPrefix(ref, prefix)
+	}
+	if ref == "" {
+		return nil, false
+	}
+	return &GitHubArchive{Remote: "https://github.com/" + parts[0] + "/" + strings.TrimSuffix(parts[1], ".git") + ".git", Ref: ref}, true
+}
+
+// URL returns the git source for the archive's repository and ref (e.g., https://github.com/owner/repo.git#v1.0)
+func (a *GitHubArchive) URL() string {
+	return a.Remote + "#" + a.Ref
+}
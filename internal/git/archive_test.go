@@ -0,0 +1,39 @@
+package git
+
+import "testing"
+
+func TestParseGitHubArchiveURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantURL string
+		wantOK  bool
+	}{
+		{url: "https://github.com/o/r/archive/refs/tags/v1.0.tar.gz", wantURL: "https://github.com/o/r.git#v1.0", wantOK: true},
+		{url: "https://github.com/o/r/archive/refs/heads/release/2.x.zip", wantURL: "https://github.com/o/r.git#release/2.x", wantOK: true},
+		{url: "https://github.com/o/r/archive/v1.0.tar.gz", wantURL: "https://github.com/o/r.git#v1.0", wantOK: true},
+		{
+			url:     "https://github.com/o/r/archive/0123456789abcdef0123456789abcdef01234567.tar.gz",
+			wantURL: "https://github.com/o/r.git#0123456789abcdef0123456789abcdef01234567",
+			wantOK:  true,
+		},
+		{url: "https://codeload.github.com/o/r/tar.gz/refs/tags/v1.0", wantURL: "https://github.com/o/r.git#v1.0", wantOK: true},
+		{url: "https://codeload.github.com/o/r/legacy.zip/main", wantURL: "https://github.com/o/r.git#main", wantOK: true},
+		{url: "https://github.com/o/r/releases/download/v1.0/r.tar.gz"},
+		{url: "https://github.com/o/r/archive/refs/tags/v1.0.tar.bz2"},
+		{url: "https://codeload.github.com/o/r/tar.gz/"},
+		{url: "https://gitlab.com/o/r/-/archive/v1.0/r-v1.0.tar.gz"},
+		{url: "https://github.com/o/r.git#v1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			archive, ok := ParseGitHubArchiveURL(tt.url)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseGitHubArchiveURL() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && archive.URL() != tt.wantURL {
+				t.Errorf("URL() = %s, want %s", archive.URL(), tt.wantURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package git
+
+import (
+	"context"
+	"strings"
+
+	"github.com/moby/buildkit/util/gitutil"
+)
+
+// cliLister lists refs with the git binary
+type cliLister struct {
+	args []string // options passed to git
+}
+
+// listRefs runs git ls-remote through BuildKit's GitCLI, which handles:
+// - SSH authentication and known_hosts
+// - HTTP proxy environment variables
+// - Auth tokens and headers
+// - Non-interactive mode (GIT_TERMINAL_PROMPT=0)
+// - Consistent output formatting
+func (l *cliLister) listRefs(ctx context.Context, remote string) ([]remoteRef, error) {
+	git := gitutil.NewGitCLI(gitutil.WithArgs(l.args...))
+
+	output, err := git.Run(ctx, "ls-remote", remote)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLsRemoteOutput(string(output)), nil
+}
+
+// parseLsRemoteOutput parses git ls-remote output lines: <commit-sha>\t<ref-name>
+func parseLsRemoteOutput(output string) []remoteRef {
+	var refs []remoteRef
+	for line := range strings.SplitSeq(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		refs = append(refs, remoteRef{SHA: fields[0], Name: fields[1]})
+	}
+	return refs
+}
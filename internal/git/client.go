@@ -6,20 +6,141 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/http"
+	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/moby/buildkit/util/gitutil"
+	"github.com/moby/buildkit/frontend/dockerfile/dfgitutil"
 )
 
 const defaultRef = "HEAD"
 
+// defaultTimeout bounds each network operation unless WithTimeout is given
+const defaultTimeout = 30 * time.Second
+
+// peeledSuffix marks the commit an annotated tag points at in a ref advertisement
+const peeledSuffix = "^{}"
+
+// Backend selects how refs are listed from a remote
+type Backend string
+
+const (
+	// BackendAuto uses the git CLI when it is on PATH, and the native implementation otherwise
+	BackendAuto Backend = "auto"
+	// BackendCLI runs git ls-remote through BuildKit's gitutil
+	BackendCLI Backend = "cli"
+	// BackendNative speaks the git protocol directly (smart HTTP, SSH, git://) without the git binary
+	BackendNative Backend = "native"
+)
+
+// ParseBackend parses a backend name as accepted by the --git-backend flag
+func ParseBackend(s string) (Backend, error) {
+	switch b := Backend(s); b {
+	case BackendAuto, BackendCLI, BackendNative:
+		return b, nil
+	case "":
+		return BackendAuto, nil
+	default:
+		return "", fmt.Errorf("unknown git backend %q (expected auto, cli, or native)", s)
+	}
+}
+
+// remoteRef is a single entry of a remote's ref advertisement (as printed by git ls-remote)
+type remoteRef struct {
+	SHA  string
+	Name string
+}
+
+// refLister lists every ref a remote advertises, including peeled tags (<tag>^{})
+type refLister interface {
+	listRefs(ctx context.Context, remote string) ([]remoteRef, error)
+}
+
 // Client handles git operations
-type Client struct{}
+type Client struct {
+	backend    Backend
+	lister     refLister
+	httpClient *http.Client // forge API requests
+	githubAPI  string
+	timeout    time.Duration     // bound on each network operation (listing refs, fetching objects, API requests)
+	transport  http.RoundTripper // HTTP transport of API requests and the native backend; nil for the default
+	gitArgs    []string          // options passed to every git command (e.g., -c http.sslCAInfo=...)
+
+	mu             sync.Mutex
+	advertisements map[string]*advertisement
+	stores         map[string]*objectStore
+}
+
+// advertisement caches a remote's refs for the lifetime of a Client
+type advertisement struct {
+	once sync.Once
+	refs []remoteRef
+	err  error
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithBackend selects how refs are listed (default: BackendAuto)
+func WithBackend(backend Backend) Option {
+	return func(c *Client) {
+		c.backend = backend
+	}
+}
+
+// WithTimeout bounds each network operation (default 30 seconds)
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+	}
+}
+
+// WithTransport sets the HTTP transport of forge API requests and the native backend
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// WithGitArgs adds options (such as -c http.proxy=...) to every git command
+func WithGitArgs(args ...string) Option {
+	return func(c *Client) {
+		c.gitArgs = append(c.gitArgs, args...)
+	}
+}
 
 // NewClient creates a new git client
-func NewClient() *Client {
-	return &Client{}
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		backend:        BackendAuto,
+		githubAPI:      defaultGitHubAPI,
+		timeout:        defaultTimeout,
+		advertisements: make(map[string]*advertisement),
+		stores:         make(map[string]*objectStore),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.httpClient = &http.Client{Timeout: c.timeout, Transport: c.transport}
+
+	backend := c.backend
+	if backend == BackendAuto {
+		backend = BackendNative
+		if _, err := exec.LookPath("git"); err == nil {
+			backend = BackendCLI
+		}
+	}
+	if backend == BackendCLI {
+		c.lister = &cliLister{args: c.gitArgs}
+	} else {
+		c.lister = newNativeLister(c.timeout, c.transport)
+	}
+
+	return c
 }
 
 // GitRef represents a parsed git reference
@@ -30,109 +151,214 @@ type GitRef struct {
 	Ref string
 	// Subdir is the optional subdirectory path
 	Subdir string
+	// Checksum is the expected commit SHA given in the URL (?checksum= or ?commit=).
+	// A source with a checksum is already pinned.
+	Checksum string
 }
 
-// ParseGitURL parses a git URL that may contain a fragment with ref and subdir
-// Format: <url>#<ref>[:<subdir>]
-// Examples:
+// ParseGitURL parses a git URL in either of the forms accepted by BuildKit's Dockerfile frontend:
+//
+// Fragment form: <url>#<ref>[:<subdir>]
 //   - https://github.com/owner/repo.git#v1.0.0
 //   - https://github.com/owner/repo.git#main:subdirectory
 //   - git@github.com:owner/repo.git#branch
+//
+// Query-string form: <url>?ref=<ref>&subdir=<subdir>&checksum=<sha>&...
+//   - https://github.com/owner/repo.git?ref=v1.2.3&subdir=docs
+//   - https://github.com/owner/repo.git?tag=v1.2.3&checksum=<sha>&keep-git-dir=true
+//
+// Parsing is delegated to BuildKit's dfgitutil, so URLs are read exactly as the frontend reads them.
 func ParseGitURL(rawURL string) (*GitRef, error) {
-	// Split on # to separate URL from fragment
-	parts := strings.SplitN(rawURL, "#", 2)
-	remote := parts[0]
-
-	ref := defaultRef
-	subdir := ""
-
-	if len(parts) == 2 {
-		// Parse fragment: ref[:subdir]
-		fragment := parts[1]
-		if fragment != "" {
-			refParts := strings.SplitN(fragment, ":", 2)
-			ref = refParts[0]
-			if ref == "" {
-				ref = defaultRef
-			}
-			if len(refParts) == 2 {
-				subdir = refParts[1]
-			}
+	ref, isGit, err := dfgitutil.ParseGitRef(rawURL)
+	if err != nil {
+		if !isGit {
+			return nil, fmt.Errorf("%s is not a git URL: %w", rawURL, err)
 		}
+		return nil, fmt.Errorf("invalid git URL %s: %w", rawURL, err)
+	}
+	if ref.IndistinguishableFromLocal {
+		// github.com/owner/repo is only read as a git URL for build contexts; ADD treats it as a local path
+		return nil, fmt.Errorf("%s is not a git URL", rawURL)
 	}
 
-	return &GitRef{
-		Remote: remote,
-		Ref:    ref,
-		Subdir: subdir,
-	}, nil
+	gitRef := &GitRef{Remote: ref.Remote, Ref: ref.Ref, Subdir: ref.SubDir, Checksum: ref.Checksum}
+	if gitRef.Ref == "" {
+		gitRef.Ref = defaultRef
+	}
+	return gitRef, nil
+}
+
+// RefKind classifies what a git ref points at
+type RefKind string
+
+const (
+	// RefKindBranch is a branch (or HEAD); it moves as commits are pushed
+	RefKindBranch RefKind = "branch"
+	// RefKindLightweightTag is a tag pointing directly at a commit
+	RefKindLightweightTag RefKind = "lightweight-tag"
+	// RefKindAnnotatedTag is a tag object that peels to a commit
+	RefKindAnnotatedTag RefKind = "annotated-tag"
+	// RefKindCommit is a full commit SHA written as the ref
+	RefKindCommit RefKind = "commit"
+	// RefKindOther is any other advertised ref (e.g., refs/pull/1/head)
+	RefKindOther RefKind = "other"
+)
+
+// ResolvedRef is the result of resolving a git URL's ref against its remote
+type ResolvedRef struct {
+	// Remote is the repository URL without ref or subdir
+	Remote string
+	// Ref is the full ref name that matched (e.g., refs/tags/v1.0.0), or the SHA for commits
+	Ref string
+	// Kind classifies the matched ref
+	Kind RefKind
+	// Commit is the 40-character commit SHA the ref points at
+	Commit string
+	// Object is the SHA the ref itself points at: the tag object for annotated tags, otherwise Commit
+	Object string
 }
 
 // GetCommitChecksum resolves a git reference to its commit SHA
-// Uses git ls-remote to fetch the commit without cloning the repository
-// Delegates to BuildKit's gitutil for authentication, SSH, and proxy support
 func (c *Client) GetCommitChecksum(ctx context.Context, rawURL string) (string, error) {
+	resolved, err := c.ResolveRef(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	return resolved.Commit, nil
+}
+
+// ResolveRef resolves a git URL's ref to a commit SHA and classifies the ref.
+// The remote's full ref advertisement (git ls-remote) is fetched once per remote and
+// shared by every URL pointing at it, so pinning many sources from one repository
+// costs a single round trip.
+func (c *Client) ResolveRef(ctx context.Context, rawURL string) (*ResolvedRef, error) {
 	gitRef, err := ParseGitURL(rawURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse git URL: %w", err)
+		return nil, fmt.Errorf("failed to parse git URL: %w", err)
 	}
 
-	// Apply default timeout if context has no deadline
-	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
-		defer cancel()
+	// A full commit SHA needs no lookup (BuildKit fetches it by commit)
+	if isCommitSHA(gitRef.Ref) {
+		commit := strings.ToLower(gitRef.Ref)
+		return &ResolvedRef{Remote: gitRef.Remote, Ref: gitRef.Ref, Kind: RefKindCommit, Commit: commit, Object: commit}, nil
 	}
 
-	// Use BuildKit's GitCLI which handles:
-	// - SSH authentication and known_hosts
-	// - HTTP proxy environment variables
-	// - Auth tokens and headers
-	// - Non-interactive mode (GIT_TERMINAL_PROMPT=0)
-	// - Consistent output formatting
-	git := gitutil.NewGitCLI()
+	refs, err := c.remoteRefs(ctx, gitRef.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("git ls-remote failed: %w", err)
+	}
 
-	// Request both the ref and its dereferenced form (for annotated tags)
-	// BuildKit's approach: source/git/source.go:264
-	output, err := git.Run(ctx, "ls-remote", gitRef.Remote, gitRef.Ref, gitRef.Ref+"^{}")
+	resolved, err := resolveFromRefs(refs, gitRef.Ref)
 	if err != nil {
-		return "", fmt.Errorf("git ls-remote failed: %w", err)
+		return nil, err
 	}
+	resolved.Remote = gitRef.Remote
+	return resolved, nil
+}
 
-	// Parse output: <commit-sha>\t<ref-name>
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	if len(lines) == 0 || lines[0] == "" {
-		return "", fmt.Errorf("no commit found for ref %s", gitRef.Ref)
+// remoteRefs returns the remote's ref advertisement, listing it on first use
+func (c *Client) remoteRefs(ctx context.Context, remote string) ([]remoteRef, error) {
+	c.mu.Lock()
+	entry, ok := c.advertisements[remote]
+	if !ok {
+		entry = &advertisement{}
+		c.advertisements[remote] = entry
 	}
+	c.mu.Unlock()
 
-	// Prefer annotated-tag deref (^{}) if present; otherwise use first entry.
-	// For annotated tags, git ls-remote returns both the tag object and the commit:
-	//   abc123def  refs/tags/v1.0.0
-	//   54d56cab   refs/tags/v1.0.0^{}  ← actual commit (preferred)
-	commitSHA := ""
-	for _, line := range lines {
-		fields := strings.Fields(line)
-		if len(fields) < 2 {
-			continue
+	entry.once.Do(func() {
+		// Apply default timeout if context has no deadline
+		if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.timeout)
+			defer cancel()
 		}
-		sha, refName := fields[0], fields[1]
-		if strings.HasSuffix(refName, "^{}") {
-			commitSHA = sha
+		entry.refs, entry.err = c.lister.listRefs(ctx, remote)
+	})
+
+	return entry.refs, entry.err
+}
+
+// resolveFromRefs picks the advertised ref a name refers to, using git's
+// rev-parse precedence (exact, refs/, refs/tags/, refs/heads/) before falling
+// back to ls-remote's trailing path match.
+func resolveFromRefs(refs []remoteRef, name string) (*ResolvedRef, error) {
+	byName := make(map[string]string, len(refs))
+	for _, ref := range refs {
+		byName[ref.Name] = ref.SHA
+	}
+
+	matched := ""
+	for _, candidate := range []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name} {
+		if _, ok := byName[candidate]; ok {
+			matched = candidate
 			break
 		}
-		if commitSHA == "" {
-			commitSHA = sha
+	}
+	if matched == "" {
+		for _, ref := range refs {
+			if !strings.HasSuffix(ref.Name, peeledSuffix) && matchesPattern(ref.Name, name) {
+				matched = ref.Name
+				break
+			}
 		}
 	}
-	if commitSHA == "" {
-		return "", errors.New("unexpected git ls-remote output format")
+	if matched == "" {
+		return nil, fmt.Errorf("no commit found for ref %s", name)
+	}
+
+	resolved := &ResolvedRef{Ref: matched, Commit: byName[matched], Object: byName[matched]}
+	// For annotated tags, the advertisement holds both the tag object and the commit:
+	//   abc123def  refs/tags/v1.0.0
+	//   54d56cab   refs/tags/v1.0.0^{}  ← actual commit (preferred)
+	// BuildKit's approach: source/git/source.go:264
+	peeled, annotated := byName[matched+peeledSuffix]
+	switch {
+	case matched == defaultRef || strings.HasPrefix(matched, "refs/heads/"):
+		resolved.Kind = RefKindBranch
+	case strings.HasPrefix(matched, "refs/tags/") && annotated:
+		resolved.Kind = RefKindAnnotatedTag
+	case strings.HasPrefix(matched, "refs/tags/"):
+		resolved.Kind = RefKindLightweightTag
+	default:
+		resolved.Kind = RefKindOther
+	}
+	if annotated {
+		resolved.Commit = peeled
+	}
+
+	if err := validateSHA(resolved.Commit); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// isCommitSHA reports whether ref is written as a full 40-character commit SHA
+func isCommitSHA(ref string) bool {
+	if len(ref) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(ref)
+	return err == nil
+}
+
+// validateSHA checks that s is a full 40-character hexadecimal commit SHA
+func validateSHA(s string) error {
+	if s == "" {
+		return errors.New("unexpected git ls-remote output format")
 	}
-	if len(commitSHA) != 40 {
-		return "", fmt.Errorf("invalid commit SHA length: %d", len(commitSHA))
+	if len(s) != 40 {
+		return fmt.Errorf("invalid commit SHA length: %d", len(s))
 	}
-	if _, err := hex.DecodeString(commitSHA); err != nil {
-		return "", errors.New("invalid commit SHA format: not hexadecimal")
+	if _, err := hex.DecodeString(s); err != nil {
+		return errors.New("invalid commit SHA format: not hexadecimal")
 	}
+	return nil
+}
 
-	return commitSHA, nil
+// matchesPattern reports whether a ref name matches an ls-remote pattern.
+// Like git ls-remote, patterns match whole trailing path components:
+// "v1.0.0" matches "refs/tags/v1.0.0" but not "refs/tags/xv1.0.0".
+func matchesPattern(name, pattern string) bool {
+	return name == pattern || strings.HasSuffix(name, "/"+pattern)
 }
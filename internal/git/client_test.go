@@ -7,12 +7,13 @@ import (
 
 func TestParseGitURL(t *testing.T) {
 	tests := []struct {
-		name       string
-		rawURL     string
-		wantRemote string
-		wantRef    string
-		wantSubdir string
-		wantErr    bool
+		name         string
+		rawURL       string
+		wantRemote   string
+		wantRef      string
+		wantSubdir   string
+		wantChecksum string
+		wantErr      bool
 	}{
 		{
 			name:       "https with tag",
@@ -70,6 +71,82 @@ func TestParseGitURL(t *testing.T) {
 			wantRef:    "v2.0.0",
 			wantSubdir: "",
 		},
+		{
+			name:       "query form with ref and subdir",
+			rawURL:     "https://github.com/owner/repo.git?ref=v1.2.3&subdir=docs",
+			wantRemote: "https://github.com/owner/repo.git",
+			wantRef:    "v1.2.3",
+			wantSubdir: "docs",
+		},
+		{
+			name:         "query form with checksum and keep-git-dir",
+			rawURL:       "https://github.com/owner/repo.git?ref=v1.2.3&checksum=54d56cab3a0882b43ac794df59924dc3f93bb75c&keep-git-dir=true",
+			wantRemote:   "https://github.com/owner/repo.git",
+			wantRef:      "v1.2.3",
+			wantChecksum: "54d56cab3a0882b43ac794df59924dc3f93bb75c",
+		},
+		{
+			name:       "query form with tag",
+			rawURL:     "https://github.com/owner/repo.git?tag=v1.2.3",
+			wantRemote: "https://github.com/owner/repo.git",
+			wantRef:    "refs/tags/v1.2.3",
+		},
+		{
+			name:       "query form with branch",
+			rawURL:     "https://github.com/owner/repo.git?branch=main",
+			wantRemote: "https://github.com/owner/repo.git",
+			wantRef:    "refs/heads/main",
+		},
+		{
+			name:       "query form without ref defaults to HEAD",
+			rawURL:     "https://github.com/owner/repo.git?subdir=docs",
+			wantRemote: "https://github.com/owner/repo.git",
+			wantRef:    "HEAD",
+			wantSubdir: "docs",
+		},
+		{
+			name:         "query form with commit alias",
+			rawURL:       "git@github.com:owner/repo.git?commit=54d56cab3a0882b43ac794df59924dc3f93bb75c",
+			wantRemote:   "git@github.com:owner/repo.git",
+			wantRef:      "HEAD",
+			wantChecksum: "54d56cab3a0882b43ac794df59924dc3f93bb75c",
+		},
+		{
+			name:       "fragment and matching query",
+			rawURL:     "https://github.com/owner/repo.git?ref=v1#v1",
+			wantRemote: "https://github.com/owner/repo.git",
+			wantRef:    "v1",
+		},
+		{
+			name:    "fragment and conflicting query ref",
+			rawURL:  "https://github.com/owner/repo.git?ref=v2#v1",
+			wantErr: true,
+		},
+		{
+			name:    "tag conflicts with branch",
+			rawURL:  "https://github.com/owner/repo.git?tag=v1&branch=main",
+			wantErr: true,
+		},
+		{
+			name:    "unknown query key",
+			rawURL:  "https://github.com/owner/repo.git?foo=bar",
+			wantErr: true,
+		},
+		{
+			name:    "empty ref value",
+			rawURL:  "https://github.com/owner/repo.git?ref=",
+			wantErr: true,
+		},
+		{
+			name:    "invalid mtime value",
+			rawURL:  "https://github.com/owner/repo.git?mtime=now",
+			wantErr: true,
+		},
+		{
+			name:    "https without .git suffix",
+			rawURL:  "https://github.com/owner/repo#v1",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -91,6 +168,86 @@ func TestParseGitURL(t *testing.T) {
 			if got.Subdir != tt.wantSubdir {
 				t.Errorf("ParseGitURL().Subdir = %v, want %v", got.Subdir, tt.wantSubdir)
 			}
+			if got.Checksum != tt.wantChecksum {
+				t.Errorf("ParseGitURL().Checksum = %v, want %v", got.Checksum, tt.wantChecksum)
+			}
+		})
+	}
+}
+
+func TestResolveFromRefs(t *testing.T) {
+	refs := []remoteRef{
+		{SHA: "2222222222222222222222222222222222222222", Name: "HEAD"},
+		{SHA: "2222222222222222222222222222222222222222", Name: "refs/heads/main"},
+		{SHA: "4444444444444444444444444444444444444444", Name: "refs/heads/v1.0.0"},
+		{SHA: "5555555555555555555555555555555555555555", Name: "refs/pull/1/head"},
+		{SHA: "1111111111111111111111111111111111111111", Name: "refs/tags/v1.0.0"},
+		{SHA: "54d56cab3a0882b43ac794df59924dc3f93bb75c", Name: "refs/tags/v1.0.0^{}"},
+		{SHA: "3333333333333333333333333333333333333333", Name: "refs/tags/v1.1.0"},
+	}
+
+	tests := []struct {
+		name       string
+		ref        string
+		wantRef    string
+		wantKind   RefKind
+		wantCommit string
+		wantErr    bool
+	}{
+		{
+			name:       "tag wins over branch of the same name",
+			ref:        "v1.0.0",
+			wantRef:    "refs/tags/v1.0.0",
+			wantKind:   RefKindAnnotatedTag,
+			wantCommit: "54d56cab3a0882b43ac794df59924dc3f93bb75c",
+		},
+		{
+			name:       "explicit branch",
+			ref:        "refs/heads/v1.0.0",
+			wantRef:    "refs/heads/v1.0.0",
+			wantKind:   RefKindBranch,
+			wantCommit: "4444444444444444444444444444444444444444",
+		},
+		{
+			name:       "lightweight tag",
+			ref:        "v1.1.0",
+			wantRef:    "refs/tags/v1.1.0",
+			wantKind:   RefKindLightweightTag,
+			wantCommit: "3333333333333333333333333333333333333333",
+		},
+		{
+			name:       "HEAD is a branch",
+			ref:        "HEAD",
+			wantRef:    "HEAD",
+			wantKind:   RefKindBranch,
+			wantCommit: "2222222222222222222222222222222222222222",
+		},
+		{
+			name:       "other ref",
+			ref:        "pull/1/head",
+			wantRef:    "refs/pull/1/head",
+			wantKind:   RefKindOther,
+			wantCommit: "5555555555555555555555555555555555555555",
+		},
+		{
+			name:    "missing ref",
+			ref:     "v2.0.0",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveFromRefs(refs, tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveFromRefs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Ref != tt.wantRef || got.Kind != tt.wantKind || got.Commit != tt.wantCommit {
+				t.Errorf("resolveFromRefs() = %+v, want {Ref:%s Kind:%s Commit:%s}", got, tt.wantRef, tt.wantKind, tt.wantCommit)
+			}
 		})
 	}
 }
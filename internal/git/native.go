@@ -0,0 +1,360 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/wharflab/container-source-policy/internal/version"
+)
+
+const (
+	defaultGitDaemonPort = "9418"
+	defaultSSHPort       = "22"
+	defaultSSHUser       = "git"
+	uploadPackService    = "git-upload-pack"
+)
+
+// nativeLister lists refs by reading the remote's ref advertisement directly,
+// without the git binary. Supports smart (and dumb) HTTP(S), SSH and git://.
+type nativeLister struct {
+	httpClient *http.Client
+}
+
+func newNativeLister(timeout time.Duration, transport http.RoundTripper) *nativeLister {
+	return &nativeLister{httpClient: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+func (l *nativeLister) listRefs(ctx context.Context, remote string) ([]remoteRef, error) {
+	switch {
+	case strings.HasPrefix(remote, "https://"), strings.HasPrefix(remote, "http://"):
+		return l.listHTTP(ctx, remote)
+	case strings.HasPrefix(remote, "git://"):
+		return listGitDaemon(ctx, remote)
+	case strings.HasPrefix(remote, "ssh://"), isSCPLike(remote):
+		return listSSH(ctx, remote)
+	default:
+		return nil, fmt.Errorf("native git backend does not support remote %q", remote)
+	}
+}
+
+// listHTTP fetches info/refs from a smart HTTP server, falling back to the dumb protocol format
+func (l *nativeLister) listHTTP(ctx context.Context, remote string) ([]remoteRef, error) {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote URL: %w", err)
+	}
+	user := u.User
+	u.User = nil
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/info/refs"
+	u.RawQuery = "service=" + uploadPackService
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	// Some hosts only serve the smart protocol to clients identifying as git
+	req.Header.Set("User-Agent", "git/2 "+version.UserAgent())
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+
+	resp, err := l.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch refs: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("authentication required for %s (HTTP %d)", u.Host, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status fetching refs: HTTP %d", resp.StatusCode)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	if resp.Header.Get("Content-Type") != "application/x-"+uploadPackService+"-advertisement" {
+		return parseDumbRefs(r)
+	}
+
+	// Smart HTTP prefixes the advertisement with "# service=git-upload-pack" and a flush packet
+	line, err := readPktLine(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service header: %w", err)
+	}
+	if string(bytes.TrimSuffix(line, []byte("\n"))) != "# service="+uploadPackService {
+		return nil, fmt.Errorf("unexpected service header %q", line)
+	}
+	if line, err = readPktLine(r); err != nil {
+		return nil, fmt.Errorf("failed to read service header: %w", err)
+	} else if line != nil {
+		return nil, errors.New("expected flush packet after service header")
+	}
+
+	return readAdvertisement(r)
+}
+
+// parseDumbRefs parses the dumb HTTP info/refs format: <sha>\t<ref> per line
+func parseDumbRefs(r io.Reader) ([]remoteRef, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refs: %w", err)
+	}
+	return parseLsRemoteOutput(string(data)), nil
+}
+
+// listGitDaemon requests the advertisement from a git:// daemon
+func listGitDaemon(ctx context.Context, remote string) ([]remoteRef, error) {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote URL: %w", err)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), defaultGitDaemonPort)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer func() { _ = conn.Close() }()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	request := uploadPackService + " " + u.Path + "\x00host=" + u.Host + "\x00"
+	if _, err := conn.Write(pktLine(request)); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	refs, err := readAdvertisement(bufio.NewReader(conn))
+	if err != nil {
+		return nil, err
+	}
+	// End the session without negotiating a pack
+	_, _ = conn.Write([]byte("0000"))
+	return refs, nil
+}
+
+// listSSH runs git-upload-pack on the remote over SSH.
+// Authenticates with the SSH agent (SSH_AUTH_SOCK) and unencrypted default keys,
+// and verifies the host key against ~/.ssh/known_hosts.
+func listSSH(ctx context.Context, remote string) ([]remoteRef, error) {
+	user, host, port, path, err := parseSSHRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	config, closeAgent, err := sshClientConfig(user)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+
+	addr := net.JoinHostPort(host, port)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s failed: %w", host, err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer func() { _ = client.Close() }()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ssh session: %w", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.Start(uploadPackService + " " + shellQuote(path)); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", uploadPackService, err)
+	}
+
+	refs, err := readAdvertisement(bufio.NewReader(stdout))
+	if err != nil {
+		return nil, err
+	}
+	_, _ = stdin.Write([]byte("0000"))
+	_ = stdin.Close()
+	return refs, nil
+}
+
+// parseSSHRemote splits ssh://[user@]host[:port]/path and scp-like [user@]host:path remotes
+func parseSSHRemote(remote string) (user, host, port, path string, err error) {
+	user, port = defaultSSHUser, defaultSSHPort
+
+	if strings.HasPrefix(remote, "ssh://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return "", "", "", "", fmt.Errorf("invalid remote URL: %w", err)
+		}
+		if u.User != nil && u.User.Username() != "" {
+			user = u.User.Username()
+		}
+		if u.Port() != "" {
+			port = u.Port()
+		}
+		return user, u.Hostname(), port, u.Path, nil
+	}
+
+	hostPart, path, ok := strings.Cut(remote, ":")
+	if !ok || path == "" {
+		return "", "", "", "", fmt.Errorf("invalid ssh remote %q", remote)
+	}
+	if u, h, ok := strings.Cut(hostPart, "@"); ok {
+		user, hostPart = u, h
+	}
+	return user, hostPart, port, path, nil
+}
+
+// isSCPLike reports whether remote uses the scp-like syntax ([user@]host:path)
+func isSCPLike(remote string) bool {
+	if strings.Contains(remote, "://") {
+		return false
+	}
+	hostPart, _, ok := strings.Cut(remote, ":")
+	return ok && hostPart != "" && !strings.Contains(hostPart, "/")
+}
+
+func sshClientConfig(user string) (*ssh.ClientConfig, func(), error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot locate known_hosts: %w", err)
+	}
+	hostKeyCallback, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot load known_hosts: %w", err)
+	}
+
+	closeAgent := func() {}
+	var signers []ssh.Signer
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			closeAgent = func() { _ = conn.Close() }
+			if agentSigners, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		data, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		// Encrypted keys are skipped: there is no terminal to prompt for a passphrase
+		if signer, err := ssh.ParsePrivateKey(data); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}, closeAgent, nil
+}
+
+// shellQuote single-quotes a path for the remote shell, as git does
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// readAdvertisement reads a protocol v0/v1 ref advertisement up to the flush packet
+func readAdvertisement(r *bufio.Reader) ([]remoteRef, error) {
+	var refs []remoteRef
+	first := true
+	for {
+		line, err := readPktLine(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ref advertisement: %w", err)
+		}
+		if line == nil {
+			return refs, nil
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+
+		if first {
+			first = false
+			if bytes.Equal(line, []byte("version 1")) {
+				continue
+			}
+			if msg, ok := bytes.CutPrefix(line, []byte("ERR ")); ok {
+				return nil, fmt.Errorf("remote error: %s", msg)
+			}
+			// Capabilities follow the first ref after a NUL byte
+			line, _, _ = bytes.Cut(line, []byte{0})
+		}
+
+		sha, name, ok := bytes.Cut(line, []byte(" "))
+		if !ok {
+			return nil, fmt.Errorf("malformed ref advertisement line %q", line)
+		}
+		// An empty repository advertises a single "capabilities^{}" placeholder
+		if string(name) == "capabilities^{}" {
+			continue
+		}
+		refs = append(refs, remoteRef{SHA: string(sha), Name: string(name)})
+	}
+}
+
+// readPktLine reads one pkt-line; a flush packet ("0000") is returned as nil
+func readPktLine(r *bufio.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseUint(string(header[:]), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkt-line length %q", header)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if n < 4 {
+		return nil, fmt.Errorf("unexpected special packet %04x", n)
+	}
+	payload := make([]byte, n-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// pktLine encodes s as a pkt-line
+func pktLine(s string) []byte {
+	return fmt.Appendf(nil, "%04x%s", len(s)+4, s)
+}
@@ -0,0 +1,242 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	testTagObject = "1111111111111111111111111111111111111111"
+	testCommit    = "54d56cab3a0882b43ac794df59924dc3f93bb75c"
+	testMain      = "2222222222222222222222222222222222222222"
+	testRelease   = "3333333333333333333333333333333333333333"
+)
+
+// testAdvertisement is a protocol v0 ref advertisement with an annotated tag
+func testAdvertisement() string {
+	var b strings.Builder
+	b.Write(pktLine(testMain + " HEAD\x00multi_ack symref=HEAD:refs/heads/main agent=git/2.43.0\n"))
+	b.Write(pktLine(testMain + " refs/heads/main\n"))
+	b.Write(pktLine(testCommit + " refs/heads/xv1.0.0\n"))
+	b.Write(pktLine(testTagObject + " refs/tags/v1.0.0\n"))
+	b.Write(pktLine(testCommit + " refs/tags/v1.0.0^{}\n"))
+	b.Write(pktLine(testRelease + " refs/tags/v1.1.0\n"))
+	b.WriteString("0000")
+	return b.String()
+}
+
+func newSmartHTTPServer(t *testing.T, advertisement string) *httptest.Server {
+	t.Helper()
+	server, _ := newCountingSmartHTTPServer(t, advertisement)
+	return server
+}
+
+// newCountingSmartHTTPServer also returns the number of info/refs requests served
+func newCountingSmartHTTPServer(t *testing.T, advertisement string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch {
+		case r.URL.Path == "/private.git/info/refs":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path != "/repo.git/info/refs" || r.URL.Query().Get("service") != "git-upload-pack":
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+			_, _ = w.Write(pktLine("# service=git-upload-pack\n"))
+			_, _ = w.Write([]byte("0000"))
+			_, _ = w.Write([]byte(advertisement))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestNativeBackend_GetCommitChecksum(t *testing.T) {
+	server := newSmartHTTPServer(t, testAdvertisement())
+	client := NewClient(WithBackend(BackendNative))
+
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr string
+	}{
+		{name: "annotated tag is peeled", url: server.URL + "/repo.git#v1.0.0", want: testCommit},
+		{name: "branch", url: server.URL + "/repo.git#main", want: testMain},
+		{name: "full ref name", url: server.URL + "/repo.git?branch=main", want: testMain},
+		{name: "default HEAD", url: server.URL + "/repo.git", want: testMain},
+		{name: "missing ref", url: server.URL + "/repo.git#v2.0.0", wantErr: "no commit found"},
+		{name: "authentication required", url: server.URL + "/private.git#main", wantErr: "authentication required"},
+		{name: "missing repository", url: server.URL + "/missing.git#main", wantErr: "HTTP 404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.GetCommitChecksum(context.Background(), tt.url)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetCommitChecksum() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCommitChecksum() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetCommitChecksum() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRef_OneListingPerRemote(t *testing.T) {
+	server, requests := newCountingSmartHTTPServer(t, testAdvertisement())
+	client := NewClient(WithBackend(BackendNative))
+
+	tests := []struct {
+		fragment string
+		wantRef  string
+		wantKind RefKind
+	}{
+		{"v1.0.0", "refs/tags/v1.0.0", RefKindAnnotatedTag},
+		{"v1.1.0", "refs/tags/v1.1.0", RefKindLightweightTag},
+		{"main", "refs/heads/main", RefKindBranch},
+		{"", "HEAD", RefKindBranch},
+		{testCommit, testCommit, RefKindCommit},
+	}
+
+	var wg sync.WaitGroup
+	for _, tt := range tests {
+		wg.Go(func() {
+			got, err := client.ResolveRef(context.Background(), server.URL+"/repo.git#"+tt.fragment)
+			if err != nil {
+				t.Errorf("ResolveRef(%q) error = %v", tt.fragment, err)
+				return
+			}
+			if got.Ref != tt.wantRef || got.Kind != tt.wantKind {
+				t.Errorf("ResolveRef(%q) = %s (%s), want %s (%s)", tt.fragment, got.Ref, got.Kind, tt.wantRef, tt.wantKind)
+			}
+		})
+	}
+	wg.Wait()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("remote was listed %d times, want 1", n)
+	}
+}
+
+func TestNativeBackend_InvalidSHA(t *testing.T) {
+	server := newSmartHTTPServer(t, string(pktLine("abc123 refs/heads/main\x00agent=git/2\n"))+"0000")
+	client := NewClient(WithBackend(BackendNative))
+
+	_, err := client.GetCommitChecksum(context.Background(), server.URL+"/repo.git#main")
+	if err == nil || !strings.Contains(err.Error(), "invalid commit SHA length") {
+		t.Fatalf("GetCommitChecksum() error = %v, want invalid SHA length", err)
+	}
+}
+
+func TestNativeBackend_GitDaemon(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	requests := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		request, err := readPktLine(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		requests <- string(request)
+		_, _ = conn.Write([]byte(testAdvertisement()))
+	}()
+
+	client := NewClient(WithBackend(BackendNative))
+	got, err := client.GetCommitChecksum(context.Background(), "git://"+listener.Addr().String()+"/repo#v1.0.0")
+	if err != nil {
+		t.Fatalf("GetCommitChecksum() error = %v", err)
+	}
+	if got != testCommit {
+		t.Errorf("GetCommitChecksum() = %v, want %v", got, testCommit)
+	}
+
+	wantRequest := "git-upload-pack /repo\x00host=" + listener.Addr().String() + "\x00"
+	if request := <-requests; request != wantRequest {
+		t.Errorf("daemon request = %q, want %q", request, wantRequest)
+	}
+}
+
+func TestParseSSHRemote(t *testing.T) {
+	tests := []struct {
+		remote   string
+		wantUser string
+		wantHost string
+		wantPort string
+		wantPath string
+	}{
+		{"git@github.com:owner/repo.git", "git", "github.com", "22", "owner/repo.git"},
+		{"github.com:owner/repo.git", "git", "github.com", "22", "owner/repo.git"},
+		{"ssh://deploy@git.example.com:2222/srv/repo.git", "deploy", "git.example.com", "2222", "/srv/repo.git"},
+		{"ssh://git.example.com/srv/repo.git", "git", "git.example.com", "22", "/srv/repo.git"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remote, func(t *testing.T) {
+			user, host, port, path, err := parseSSHRemote(tt.remote)
+			if err != nil {
+				t.Fatalf("parseSSHRemote() error = %v", err)
+			}
+			if user != tt.wantUser || host != tt.wantHost || port != tt.wantPort || path != tt.wantPath {
+				t.Errorf("parseSSHRemote() = %q, %q, %q, %q, want %q, %q, %q, %q",
+					user, host, port, path, tt.wantUser, tt.wantHost, tt.wantPort, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestMatchesPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    bool
+	}{
+		{"refs/tags/v1.0.0", "v1.0.0", true},
+		{"refs/tags/v1.0.0^{}", "v1.0.0^{}", true},
+		{"refs/tags/v1.0.0", "tags/v1.0.0", true},
+		{"refs/heads/xv1.0.0", "v1.0.0", false},
+		{"HEAD", "HEAD", true},
+		{"refs/heads/main", "refs/heads/main", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchesPattern(tt.name, tt.pattern); got != tt.want {
+			t.Errorf("matchesPattern(%q, %q) = %v, want %v", tt.name, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestParseBackend(t *testing.T) {
+	for _, s := range []string{"", "auto", "cli", "native"} {
+		if _, err := ParseBackend(s); err != nil {
+			t.Errorf("ParseBackend(%q) error = %v", s, err)
+		}
+	}
+	if _, err := ParseBackend("libgit2"); err == nil {
+		t.Error("ParseBackend(\"libgit2\") expected error")
+	}
+}
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moby/buildkit/util/gitutil"
+)
+
+// objectStore is a scratch partial clone that tag, commit and tree objects are
+// fetched into for inspection. Blobs are never downloaded.
+type objectStore struct {
+	mu      sync.Mutex // serializes git commands on the repository
+	dir     string
+	git     *gitutil.GitCLI
+	fetched map[string]bool // refs already fetched
+	timeout time.Duration   // bound on each fetch
+}
+
+// objectStore returns the scratch repository for remote, creating it on first use.
+// Fetching objects needs the git binary, whichever backend lists refs.
+func (c *Client) objectStore(ctx context.Context, remote string) (*objectStore, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if store, ok := c.stores[remote]; ok {
+		return store, nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, errors.New("inspecting git objects requires the git binary")
+	}
+
+	dir, err := os.MkdirTemp("", "container-source-policy-git-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scratch repository: %w", err)
+	}
+	store := &objectStore{
+		dir:     dir,
+		git:     gitutil.NewGitCLI(gitutil.WithGitDir(dir), gitutil.WithArgs(c.gitArgs...)),
+		fetched: make(map[string]bool),
+		timeout: c.timeout,
+	}
+
+	// Configure the remote as a promisor so blob-less fetches (and lazy tree fetches) work
+	setup := [][]string{
+		{"init", "--bare", "--quiet"},
+		{"config", "core.repositoryformatversion", "1"},
+		{"config", "extensions.partialClone", "origin"},
+		{"config", "remote.origin.url", remote},
+		{"config", "remote.origin.promisor", "true"},
+		{"config", "remote.origin.partialclonefilter", "blob:none"},
+	}
+	for _, args := range setup {
+		if _, err := store.git.Run(ctx, args...); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to set up scratch repository: %w", err)
+		}
+	}
+
+	c.stores[remote] = store
+	return store, nil
+}
+
+// fetch fetches the object a resolved ref points at, by SHA, at depth 1 and without blobs,
+// so that a ref moved since it was listed cannot change what is inspected.
+// Servers that reject unadvertised SHAs get the ref instead, which must still point at the object.
+// Each object is fetched once; callers must hold s.mu.
+func (s *objectStore) fetch(ctx context.Context, resolved *ResolvedRef) error {
+	sha := resolved.Object
+	if sha == "" {
+		sha = resolved.Commit
+	}
+	if s.fetched[sha] {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	// gitutil retries a rejected SHA without it, so a successful fetch does not mean the object arrived
+	if err := s.fetchRef(ctx, sha); err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", sha, err)
+	}
+	if !s.hasObject(ctx, sha) && resolved.Ref != sha {
+		if err := s.fetchRef(ctx, resolved.Ref); err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", resolved.Ref, err)
+		}
+	}
+	if !s.hasObject(ctx, sha) {
+		return fmt.Errorf("%s no longer points at %s", resolved.Ref, sha)
+	}
+	s.fetched[sha] = true
+	return nil
+}
+
+func (s *objectStore) fetchRef(ctx context.Context, ref string) error {
+	_, err := s.git.Run(ctx, "fetch", "--quiet", "--no-tags", "--no-write-fetch-head", "--depth=1", "--filter=blob:none", "origin", ref)
+	return err
+}
+
+// hasObject checks whether an object is in the scratch repository
+func (s *objectStore) hasObject(ctx context.Context, sha string) bool {
+	_, err := s.git.Run(ctx, "cat-file", "-e", sha)
+	return err == nil
+}
+
+// readObject returns the raw content of an object of the given type (tag, commit, tree)
+func (s *objectStore) readObject(ctx context.Context, objType, sha string) ([]byte, error) {
+	return s.git.Run(ctx, "cat-file", objType, sha)
+}
+
+// treeEntryType returns the type of the entry at path in a commit's tree (tree, blob, commit), or "" if it does not exist
+func (s *objectStore) treeEntryType(ctx context.Context, commit, path string) (string, error) {
+	out, err := s.git.Run(ctx, "ls-tree", commit, "--", path)
+	if err != nil {
+		return "", err
+	}
+	// <mode> SP <type> SP <object> TAB <path>
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 {
+		return "", nil
+	}
+	return fields[1], nil
+}
+
+// Close removes the scratch repositories created for object inspection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for remote, store := range c.stores {
+		errs = append(errs, os.RemoveAll(store.dir))
+		delete(c.stores, remote)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,297 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/moby/buildkit/util/gitutil/gitobject"
+	"github.com/moby/buildkit/util/gitutil/gitsign"
+	"golang.org/x/crypto/ssh"
+)
+
+// Signature formats reported in Signature.Format
+const (
+	SignatureFormatOpenPGP = "openpgp"
+	SignatureFormatSSH     = "ssh"
+)
+
+// TrustRoot holds the keys a remote's tags or commits must be signed with
+type TrustRoot struct {
+	// Keyring is an armored OpenPGP public keyring
+	Keyring string
+	// AllowedSigners is an ssh allowed signers file (principals [options] key)
+	AllowedSigners string
+}
+
+// Signature describes a verified signature on a tag or commit
+type Signature struct {
+	// Object is the signed object type: "tag" or "commit"
+	Object string
+	// SHA is the signed object's SHA
+	SHA string
+	// Format is "openpgp" or "ssh"
+	Format string
+	// Signer identifies the key: the OpenPGP key ID or the ssh principal (tagger or committer email)
+	Signer string
+}
+
+// SignatureError indicates that neither the tag nor the commit carries a valid
+// signature from a trusted key
+type SignatureError struct {
+	URL    string
+	Reason string
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("no trusted signature for %s: %s", e.URL, e.Reason)
+}
+
+// IsSignatureError checks if an error is a SignatureError
+func IsSignatureError(err error) bool {
+	var sigErr *SignatureError
+	return errors.As(err, &sigErr)
+}
+
+// VerifySignature fetches the objects a resolved ref points at and checks their
+// OpenPGP or SSH signatures against trust. For annotated tags the tag signature
+// is checked first, then the commit's; a valid signature on either is enough.
+func (c *Client) VerifySignature(ctx context.Context, rawURL string, resolved *ResolvedRef, trust TrustRoot) (*Signature, error) {
+	if trust.Keyring == "" && trust.AllowedSigners == "" {
+		return nil, &SignatureError{URL: rawURL, Reason: "no keyring or allowed signers configured for this remote"}
+	}
+
+	gitRef, err := ParseGitURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse git URL: %w", err)
+	}
+	store, err := c.objectStore(ctx, gitRef.Remote)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err := store.fetch(ctx, resolved); err != nil {
+		return nil, err
+	}
+
+	candidates := []Signature{{Object: "commit", SHA: resolved.Commit}}
+	if resolved.Kind == RefKindAnnotatedTag {
+		candidates = slices.Insert(candidates, 0, Signature{Object: "tag", SHA: resolved.Object})
+	}
+
+	var reasons []string
+	for _, candidate := range candidates {
+		raw, err := store.readObject(ctx, candidate.Object, candidate.SHA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s %s: %w", candidate.Object, candidate.SHA, err)
+		}
+		sig, err := verifyObject(raw, candidate.SHA, trust)
+		if err == nil {
+			sig.Object, sig.SHA = candidate.Object, candidate.SHA
+			return sig, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("%s %s: %v", candidate.Object, candidate.SHA[:12], err))
+	}
+
+	return nil, &SignatureError{URL: rawURL, Reason: strings.Join(reasons, "; ")}
+}
+
+// verifyObject checks the raw object against its SHA and verifies its signature
+func verifyObject(raw []byte, sha string, trust TrustRoot) (*Signature, error) {
+	obj, err := gitobject.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse object: %w", err)
+	}
+	if err := obj.VerifyChecksum(sha); err != nil {
+		return nil, err
+	}
+	if obj.Signature == "" {
+		return nil, errors.New("not signed")
+	}
+
+	parsed, err := gitsign.ParseSignature([]byte(obj.Signature))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case parsed.PGPSignature != nil:
+		if trust.Keyring == "" {
+			return nil, errors.New("signed with OpenPGP but no keyring is configured")
+		}
+		keyring, err := os.ReadFile(trust.Keyring)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyring: %w", err)
+		}
+		if err := gitsign.VerifySignature(obj, keyring, nil); err != nil {
+			return nil, err
+		}
+		signer := "unknown key"
+		if parsed.PGPSignature.IssuerKeyId != nil {
+			signer = fmt.Sprintf("%016X", *parsed.PGPSignature.IssuerKeyId)
+		}
+		return &Signature{Format: SignatureFormatOpenPGP, Signer: signer}, nil
+
+	case parsed.SSHSignature != nil:
+		if trust.AllowedSigners == "" {
+			return nil, errors.New("signed with SSH but no allowed signers file is configured")
+		}
+		signers, err := loadAllowedSigners(trust.AllowedSigners)
+		if err != nil {
+			return nil, err
+		}
+		// Like git, the key must be allowed for the tagger or committer email
+		principal, err := signerEmail(obj)
+		if err != nil {
+			return nil, err
+		}
+		fingerprint := ssh.FingerprintSHA256(parsed.SSHSignature.PublicKey)
+		known := false
+		for _, signer := range signers {
+			if !signer.allowsGit || ssh.FingerprintSHA256(signer.key) != fingerprint {
+				continue
+			}
+			known = true
+			if !matchPrincipals(signer.principals, principal) {
+				continue
+			}
+			if err := gitsign.VerifySignature(obj, ssh.MarshalAuthorizedKey(signer.key), nil); err != nil {
+				return nil, err
+			}
+			return &Signature{Format: SignatureFormatSSH, Signer: principal}, nil
+		}
+		if known {
+			return nil, fmt.Errorf("SSH key %s is not allowed to sign as %q", fingerprint, principal)
+		}
+		return nil, fmt.Errorf("signed by unknown SSH key %s", fingerprint)
+
+	default:
+		return nil, errors.New("unsupported signature format")
+	}
+}
+
+// signerEmail returns the identity git checks ssh signatures against: the tagger email for tags,
+// the committer email for commits
+func signerEmail(obj *gitobject.GitObject) (string, error) {
+	var email string
+	switch obj.Type {
+	case "tag":
+		tag, err := obj.ToTag()
+		if err != nil {
+			return "", err
+		}
+		email = tag.Tagger.Email
+	case "commit":
+		commit, err := obj.ToCommit()
+		if err != nil {
+			return "", err
+		}
+		email = commit.Committer.Email
+	}
+	if email == "" {
+		return "", fmt.Errorf("%s has no signer email", obj.Type)
+	}
+	return email, nil
+}
+
+// matchPrincipals matches an identity against the comma-separated principals of an allowed signers entry.
+// As in OpenSSH, principals may use * and ? wildcards, and a matching !negated principal rejects the identity.
+func matchPrincipals(principals, identity string) bool {
+	matched := false
+	for pattern := range strings.SplitSeq(principals, ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		if !matchWildcard(strings.TrimPrefix(pattern, "!"), identity) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// matchWildcard matches s against a pattern where * matches any run of characters and ? any single one
+func matchWildcard(pattern, s string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := range len(s) + 1 {
+				if matchWildcard(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+// allowedSigner is one entry of an ssh allowed signers file
+type allowedSigner struct {
+	principals string
+	key        ssh.PublicKey
+	allowsGit  bool // no namespaces= option, or "git" among them
+}
+
+// loadAllowedSigners parses an ssh allowed signers file: principals [options] keytype key [comment]
+func loadAllowedSigners(path string) ([]allowedSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowed signers: %w", err)
+	}
+
+	var signers []allowedSigner
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		principals, rest, _ := strings.Cut(line, " ")
+		// The remainder uses the authorized_keys syntax, including its options
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid allowed signers entry: %w", path, lineNo, err)
+		}
+		signers = append(signers, allowedSigner{
+			principals: principals,
+			key:        key,
+			allowsGit:  allowsNamespace(options, "git"),
+		})
+	}
+	return signers, scanner.Err()
+}
+
+// allowsNamespace checks the namespaces="a,b" option of an allowed signers entry
+func allowsNamespace(options []string, namespace string) bool {
+	for _, option := range options {
+		value, ok := strings.CutPrefix(option, "namespaces=")
+		if !ok {
+			continue
+		}
+		return slices.Contains(strings.Split(strings.Trim(value, `"`), ","), namespace)
+	}
+	return true
+}
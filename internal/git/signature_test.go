@@ -0,0 +1,267 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // git object IDs
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/wharflab/container-source-policy/internal/testutil"
+)
+
+func TestVerifyObject_OpenPGP(t *testing.T) {
+	entity, err := openpgp.NewEntity("Release Bot", "", "release@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyringPath := filepath.Join(t.TempDir(), "keyring.asc")
+	var keyring bytes.Buffer
+	w, err := armor.Encode(&keyring, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	if err := os.WriteFile(keyringPath, keyring.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	header := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"author Release Bot <release@example.com> 1700000000 +0000\n" +
+		"committer Release Bot <release@example.com> 1700000000 +0000\n"
+	message := "\nsigned release\n"
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entity, strings.NewReader(header+message), nil); err != nil {
+		t.Fatal(err)
+	}
+	gpgsig := "gpgsig " + strings.ReplaceAll(strings.TrimSpace(sig.String()), "\n", "\n ") + "\n"
+
+	signed := []byte(header + gpgsig + message)
+	unsigned := []byte(header + message)
+
+	got, err := verifyObject(signed, objectSHA("commit", signed), TrustRoot{Keyring: keyringPath})
+	if err != nil {
+		t.Fatalf("verifyObject() error = %v", err)
+	}
+	if got.Format != SignatureFormatOpenPGP || got.Signer != fmt.Sprintf("%016X", entity.PrimaryKey.KeyId) {
+		t.Errorf("verifyObject() = %+v, want openpgp signature by %016X", got, entity.PrimaryKey.KeyId)
+	}
+
+	if _, err := verifyObject(unsigned, objectSHA("commit", unsigned), TrustRoot{Keyring: keyringPath}); err == nil {
+		t.Error("verifyObject() expected error for unsigned commit")
+	}
+	if _, err := verifyObject(signed, objectSHA("commit", unsigned), TrustRoot{Keyring: keyringPath}); err == nil {
+		t.Error("verifyObject() expected error for checksum mismatch")
+	}
+	if _, err := verifyObject(signed, objectSHA("commit", signed), TrustRoot{AllowedSigners: keyringPath}); err == nil {
+		t.Error("verifyObject() expected error without a keyring")
+	}
+}
+
+func TestLoadAllowedSigners(t *testing.T) {
+	_, pub := newSSHKey(t)
+	path := filepath.Join(t.TempDir(), "allowed_signers")
+	content := "# release signers\n" +
+		"dev@example.com " + pub +
+		"ci@example.com namespaces=\"file,git\" " + pub +
+		"mail@example.com namespaces=\"email\" " + pub
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	signers, err := loadAllowedSigners(path)
+	if err != nil {
+		t.Fatalf("loadAllowedSigners() error = %v", err)
+	}
+	want := []struct {
+		principals string
+		allowsGit  bool
+	}{
+		{"dev@example.com", true},
+		{"ci@example.com", true},
+		{"mail@example.com", false},
+	}
+	if len(signers) != len(want) {
+		t.Fatalf("loadAllowedSigners() returned %d entries, want %d", len(signers), len(want))
+	}
+	for i, w := range want {
+		if signers[i].principals != w.principals || signers[i].allowsGit != w.allowsGit {
+			t.Errorf("entry %d = %s (git: %v), want %s (git: %v)", i, signers[i].principals, signers[i].allowsGit, w.principals, w.allowsGit)
+		}
+	}
+}
+
+// TestVerifySignature_SSH signs tags with ssh keys in a real repository served
+// over smart HTTP by git-http-backend, then verifies them through the client.
+func TestVerifySignature_SSH(t *testing.T) {
+	for _, bin := range []string{"git", "ssh-keygen"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not available", bin)
+		}
+	}
+
+	tmp := t.TempDir()
+	trustedKey, trustedPub := newSSHKey(t)
+	untrustedKey, _ := newSSHKey(t)
+	otherKey, otherPub := newSSHKey(t)
+	allowedSigners := filepath.Join(tmp, "allowed_signers")
+	signersFile := "dev@example.com namespaces=\"git\" " + trustedPub + "other@example.com " + otherPub
+	if err := os.WriteFile(allowedSigners, []byte(signersFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	work := filepath.Join(tmp, "work")
+	runGit(t, tmp, "init", "--quiet", "--initial-branch=main", work)
+	runGit(t, work, "commit", "--quiet", "--allow-empty", "-m", "initial")
+	runGit(t, work, "tag", "v0.9.0")
+	runGit(t, work, "-c", "gpg.format=ssh", "-c", "user.signingkey="+trustedKey, "tag", "-s", "-m", "release", "v1.0.0")
+	runGit(t, work, "-c", "gpg.format=ssh", "-c", "user.signingkey="+untrustedKey, "tag", "-s", "-m", "release", "v2.0.0")
+	// Signed with a trusted key, but not the one allowed for the tagger's email
+	runGit(t, work, "-c", "gpg.format=ssh", "-c", "user.signingkey="+otherKey, "tag", "-s", "-m", "release", "v3.0.0")
+
+	root := filepath.Join(tmp, "srv")
+	runGit(t, tmp, "clone", "--quiet", "--bare", work, filepath.Join(root, "repo.git"))
+	runGit(t, filepath.Join(root, "repo.git"), "config", "uploadpack.allowFilter", "true")
+
+	server, err := testutil.NewGitHTTPBackend(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client := NewClient(WithBackend(BackendCLI))
+	defer func() { _ = client.Close() }()
+	trust := TrustRoot{AllowedSigners: allowedSigners}
+
+	tests := []struct {
+		ref        string
+		wantObject string
+		wantErr    string
+	}{
+		{ref: "v1.0.0", wantObject: "tag"},
+		{ref: "v0.9.0", wantErr: "not signed"},
+		{ref: "v2.0.0", wantErr: "unknown SSH key"},
+		{ref: "v3.0.0", wantErr: `not allowed to sign as "dev@example.com"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			url := server.URL + "/repo.git#" + tt.ref
+			resolved, err := client.ResolveRef(context.Background(), url)
+			if err != nil {
+				t.Fatalf("ResolveRef() error = %v", err)
+			}
+
+			sig, err := client.VerifySignature(context.Background(), url, resolved, trust)
+			if tt.wantErr != "" {
+				if !IsSignatureError(err) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("VerifySignature() error = %v, want SignatureError containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifySignature() error = %v", err)
+			}
+			if sig.Object != tt.wantObject || sig.Format != SignatureFormatSSH || sig.Signer != "dev@example.com" {
+				t.Errorf("VerifySignature() = %+v, want %s signed over ssh by dev@example.com", sig, tt.wantObject)
+			}
+		})
+	}
+
+	// The objects the ref resolved to are fetched, not whatever the ref points at now
+	t.Run("moved ref", func(t *testing.T) {
+		url := server.URL + "/repo.git#v1.0.0"
+		resolved, err := client.ResolveRef(context.Background(), url)
+		if err != nil {
+			t.Fatalf("ResolveRef() error = %v", err)
+		}
+		stale := *resolved
+		stale.Object = strings.Repeat("1", 40)
+		_, err = client.VerifySignature(context.Background(), url, &stale, trust)
+		if err == nil || !strings.Contains(err.Error(), "no longer points at") {
+			t.Errorf("VerifySignature() error = %v, want the ref to no longer point at the resolved object", err)
+		}
+	})
+}
+
+func TestMatchPrincipals(t *testing.T) {
+	tests := []struct {
+		principals string
+		identity   string
+		want       bool
+	}{
+		{principals: "dev@example.com", identity: "dev@example.com", want: true},
+		{principals: "dev@example.com", identity: "ops@example.com", want: false},
+		{principals: "ops@example.com,dev@example.com", identity: "dev@example.com", want: true},
+		{principals: "*@example.com", identity: "dev@example.com", want: true},
+		{principals: "*@example.com", identity: "dev@example.org", want: false},
+		{principals: "de?@example.com", identity: "dev@example.com", want: true},
+		{principals: "*@example.com,!ops@example.com", identity: "ops@example.com", want: false},
+		{principals: "!ops@example.com", identity: "dev@example.com", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchPrincipals(tt.principals, tt.identity); got != tt.want {
+			t.Errorf("matchPrincipals(%q, %q) = %v, want %v", tt.principals, tt.identity, got, tt.want)
+		}
+	}
+}
+
+// newSSHKey writes an unencrypted ed25519 private key and returns its path and authorized_keys line
+func newSSHKey(t *testing.T) (string, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, string(ssh.MarshalAuthorizedKey(sshPub))
+}
+
+// runGit runs git in dir with an isolated configuration and a fixed identity
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL="+os.DevNull,
+		"GIT_AUTHOR_NAME=Dev", "GIT_AUTHOR_EMAIL=dev@example.com",
+		"GIT_COMMITTER_NAME=Dev", "GIT_COMMITTER_EMAIL=dev@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func objectSHA(objType string, raw []byte) string {
+	sum := sha1.Sum(append(fmt.Appendf(nil, "%s %d\x00", objType, len(raw)), raw...)) //nolint:gosec // git object IDs
+	return hex.EncodeToString(sum[:])
+}
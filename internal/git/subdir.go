@@ -0,0 +1,154 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/moby/buildkit/util/gitutil"
+)
+
+const defaultGitHubAPI = "https://api.github.com"
+
+// ErrSubdirUnchecked is returned by CheckSubdir when the subdir cannot be inspected: without the git binary
+// only GitHub remotes can be checked (through the contents API), and fetch, auth or timeout failures are not
+// evidence that the subdir is missing
+var ErrSubdirUnchecked = errors.New("subdir not checked")
+
+// SubdirError reports a #ref:subdir that is missing (or not a directory) at the pinned commit
+type SubdirError struct {
+	Subdir string
+	Commit string
+	Reason string
+}
+
+func (e *SubdirError) Error() string {
+	return fmt.Sprintf("subdir %q %s at commit %s", e.Subdir, e.Reason, e.Commit)
+}
+
+// IsSubdirError checks if an error is a SubdirError
+func IsSubdirError(err error) bool {
+	var subdirErr *SubdirError
+	return errors.As(err, &subdirErr)
+}
+
+// CheckSubdir verifies that the URL's subdir (#ref:subdir or ?subdir=) is a directory
+// in the resolved commit's tree. The commit is fetched shallow and blob-less with the
+// git binary; the native backend asks the GitHub contents API instead.
+func (c *Client) CheckSubdir(ctx context.Context, rawURL string, resolved *ResolvedRef) error {
+	gitRef, err := ParseGitURL(rawURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse git URL: %w", err)
+	}
+	// BuildKit cleans the subdir the same way before checking out
+	subdir := strings.TrimPrefix(path.Clean("/"+gitRef.Subdir), "/")
+	if subdir == "" {
+		return nil
+	}
+
+	_, native := c.lister.(*nativeLister)
+	if owner, repo, ok := githubRepo(gitRef.Remote); ok && native {
+		return c.checkSubdirGitHub(ctx, owner, repo, subdir, resolved.Commit)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("%w: inspecting %s requires the git binary", ErrSubdirUnchecked, gitRef.Remote)
+	}
+
+	store, err := c.objectStore(ctx, gitRef.Remote)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSubdirUnchecked, err)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// Servers without shallow or filter support, auth failures and timeouts all end here
+	if err := store.fetch(ctx, resolved); err != nil {
+		return fmt.Errorf("%w: %w", ErrSubdirUnchecked, err)
+	}
+	entryType, err := store.treeEntryType(ctx, resolved.Commit, subdir)
+	if err != nil {
+		return fmt.Errorf("%w: failed to list tree of %s: %w", ErrSubdirUnchecked, resolved.Commit, err)
+	}
+	return subdirResult(subdir, resolved.Commit, entryType)
+}
+
+// checkSubdirGitHub looks the subdir up with the contents API (GET /repos/{owner}/{repo}/contents/{path}?ref=)
+func (c *Client) checkSubdirGitHub(ctx context.Context, owner, repo, subdir, commit string) error {
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s",
+		c.githubAPI, url.PathEscape(owner), url.PathEscape(repo), escapePath(subdir), commit)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	// The object media type describes directories as {"type": "dir", "entries": [...]}
+	req.Header.Set("Accept", "application/vnd.github.object+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: GitHub API request failed: %w", ErrSubdirUnchecked, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return subdirResult(subdir, commit, "")
+	default:
+		// Rate limits and private repositories without a token land here
+		return fmt.Errorf("%w: GitHub API returned HTTP %d", ErrSubdirUnchecked, resp.StatusCode)
+	}
+
+	var content struct {
+		Type string `json:"type"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&content); err != nil {
+		return fmt.Errorf("%w: failed to decode GitHub API response: %w", ErrSubdirUnchecked, err)
+	}
+	if content.Type == "dir" {
+		return subdirResult(subdir, commit, "tree")
+	}
+	return subdirResult(subdir, commit, content.Type)
+}
+
+// subdirResult turns the type of the tree entry at subdir into an error unless it is a directory
+func subdirResult(subdir, commit, entryType string) error {
+	switch entryType {
+	case "tree":
+		return nil
+	case "":
+		return &SubdirError{Subdir: subdir, Commit: commit, Reason: "does not exist"}
+	default:
+		return &SubdirError{Subdir: subdir, Commit: commit, Reason: "is not a directory"}
+	}
+}
+
+// githubRepo extracts owner and repository from a github.com remote (HTTPS or SSH)
+func githubRepo(remote string) (string, string, bool) {
+	u, err := gitutil.ParseURL(remote)
+	if err != nil || !strings.EqualFold(u.Host, "github.com") {
+		return "", "", false
+	}
+	owner, repo, ok := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return "", "", false
+	}
+	return owner, strings.TrimSuffix(repo, ".git"), true
+}
+
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
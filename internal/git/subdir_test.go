@@ -0,0 +1,174 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wharflab/container-source-policy/internal/testutil"
+)
+
+func TestCheckSubdir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	tmp := t.TempDir()
+	work := filepath.Join(tmp, "work")
+	runGit(t, tmp, "init", "--quiet", "--initial-branch=main", work)
+	if err := os.MkdirAll(filepath.Join(work, "docs", "guide"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"README.md", "docs/guide/index.md"} {
+		if err := os.WriteFile(filepath.Join(work, file), []byte("# "+file+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "--quiet", "-m", "docs")
+	runGit(t, work, "tag", "v1.0.0")
+
+	root := filepath.Join(tmp, "srv")
+	runGit(t, tmp, "clone", "--quiet", "--bare", work, filepath.Join(root, "repo.git"))
+	runGit(t, filepath.Join(root, "repo.git"), "config", "uploadpack.allowFilter", "true")
+
+	server, err := testutil.NewGitHTTPBackend(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client := NewClient(WithBackend(BackendCLI))
+	defer func() { _ = client.Close() }()
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr string
+	}{
+		{name: "no subdir", url: "/repo.git#v1.0.0"},
+		{name: "nested directory", url: "/repo.git#v1.0.0:docs/guide"},
+		{name: "query form", url: "/repo.git?ref=v1.0.0&subdir=docs"},
+		{name: "uncleaned path", url: "/repo.git#v1.0.0:./docs/"},
+		{name: "missing directory", url: "/repo.git#v1.0.0:doc", wantErr: `subdir "doc" does not exist`},
+		{name: "file", url: "/repo.git#v1.0.0:README.md", wantErr: `subdir "README.md" is not a directory`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := server.URL + tt.url
+			resolved, err := client.ResolveRef(context.Background(), url)
+			if err != nil {
+				t.Fatalf("ResolveRef() error = %v", err)
+			}
+
+			err = client.CheckSubdir(context.Background(), url, resolved)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckSubdir() error = %v", err)
+				}
+				return
+			}
+			if !IsSubdirError(err) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckSubdir() error = %v, want SubdirError containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A remote that cannot be fetched says nothing about the subdir
+	t.Run("unreachable remote", func(t *testing.T) {
+		unreachable := httptest.NewServer(http.NotFoundHandler())
+		unreachable.Close()
+		url := unreachable.URL + "/repo.git#v1.0.0:docs"
+		resolved := &ResolvedRef{Ref: "refs/tags/v1.0.0", Kind: RefKindLightweightTag, Commit: strings.Repeat("1", 40)}
+		resolved.Object = resolved.Commit
+
+		err := client.CheckSubdir(context.Background(), url, resolved)
+		if !errors.Is(err, ErrSubdirUnchecked) || IsSubdirError(err) {
+			t.Errorf("CheckSubdir() error = %v, want ErrSubdirUnchecked", err)
+		}
+	})
+}
+
+func TestCheckSubdirGitHub(t *testing.T) {
+	const commit = "54d56cab3a0882b43ac794df59924dc3f93bb75c"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != commit {
+			http.Error(w, "wrong ref", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/repos/owner/repo/contents/docs":
+			_, _ = w.Write([]byte(`{"type":"dir","entries":[]}`))
+		case "/repos/owner/repo/contents/README.md":
+			_, _ = w.Write([]byte(`{"type":"file"}`))
+		case "/repos/owner/private/contents/docs":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBackend(BackendNative))
+	client.githubAPI = server.URL
+
+	tests := []struct {
+		repo      string
+		subdir    string
+		wantErr   string
+		unchecked bool
+	}{
+		{repo: "repo", subdir: "docs"},
+		{repo: "repo", subdir: "missing", wantErr: "does not exist"},
+		{repo: "repo", subdir: "README.md", wantErr: "is not a directory"},
+		{repo: "private", subdir: "docs", unchecked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo+"/"+tt.subdir, func(t *testing.T) {
+			err := client.checkSubdirGitHub(context.Background(), "owner", tt.repo, tt.subdir, commit)
+			switch {
+			case tt.unchecked:
+				if !errors.Is(err, ErrSubdirUnchecked) {
+					t.Errorf("checkSubdirGitHub() error = %v, want ErrSubdirUnchecked", err)
+				}
+			case tt.wantErr != "":
+				if !IsSubdirError(err) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("checkSubdirGitHub() error = %v, want SubdirError containing %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Errorf("checkSubdirGitHub() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestGithubRepo(t *testing.T) {
+	tests := []struct {
+		remote    string
+		wantOwner string
+		wantRepo  string
+		wantOK    bool
+	}{
+		{"https://github.com/owner/repo.git", "owner", "repo", true},
+		{"https://github.com/owner/repo", "owner", "repo", true},
+		{"git@github.com:owner/repo.git", "owner", "repo", true},
+		{"ssh://git@github.com/owner/repo.git", "owner", "repo", true},
+		{"https://gitlab.com/owner/repo.git", "", "", false},
+		{"https://github.com/owner", "", "", false},
+	}
+
+	for _, tt := range tests {
+		owner, repo, ok := githubRepo(tt.remote)
+		if owner != tt.wantOwner || repo != tt.wantRepo || ok != tt.wantOK {
+			t.Errorf("githubRepo(%q) = %q, %q, %v, want %q, %q, %v", tt.remote, owner, repo, ok, tt.wantOwner, tt.wantRepo, tt.wantOK)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package integration
 
 import (
 	"context"
+	"crypto/sha1" //nolint:gosec // SHA-1 only mimics repository manager ETags
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"os"
@@ -26,6 +29,17 @@ func normalizeTestOutput(output []byte) string {
 	return localhostPortRegex.ReplaceAllString(string(output), "http://127.0.0.1:PORT")
 }
 
+// sha1Hex and sha256Hex return hex digests for fake repository manager checksum headers
+func sha1Hex(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
 var (
 	binaryPath   string
 	mockRegistry *testutil.MockRegistry
@@ -296,6 +310,11 @@ func TestPin(t *testing.T) {
 				)
 			}
 
+			// Digests are resolved with HEAD, which does not count as a pull
+			if gets := mockRegistry.ManifestRequests("GET"); gets != 0 {
+				t.Errorf("expected only HEAD manifest requests, got %d GET.\nRequests: %v", gets, mockRegistry.Requests())
+			}
+
 			// Validate the policy using BuildKit's sourcepolicy types
 			var pol policy.Policy
 			if err := json.Unmarshal(output, &pol); err != nil {
@@ -424,6 +443,91 @@ ADD ` + mockHTTP.URL() + `/stable/file.txt /app/stable.txt
 	snaps.WithConfig(snaps.Ext(".json")).MatchStandaloneSnapshot(t, normalizeTestOutput(output))
 }
 
+// TestPinHTTPSourcesRepositoryManagerChecksum tests that Artifactory and Nexus X-Checksum-Sha256 headers
+// are used instead of downloading the file
+func TestPinHTTPSourcesRepositoryManagerChecksum(t *testing.T) {
+	mockHTTP := testutil.NewMockHTTPServer()
+	defer mockHTTP.Close()
+
+	// Repository managers return a SHA-1 ETag, so without X-Checksum-Sha256 the file would be downloaded
+	artifactoryContent := "artifactory content"
+	artifactoryChecksum := mockHTTP.AddFileWithHeaders("/artifactory/libs-release/tool.tar.gz", artifactoryContent, map[string]string{
+		"ETag":              `"` + sha1Hex(artifactoryContent) + `"`,
+		"X-Artifactory-Id":  "a1b2c3d4",
+		"X-Checksum-Sha1":   sha1Hex(artifactoryContent),
+		"X-Checksum-Sha256": sha256Hex(artifactoryContent),
+	})
+	nexusContent := "nexus content"
+	nexusChecksum := mockHTTP.AddFileWithHeaders("/repository/raw-hosted/tool.tar.gz", nexusContent, map[string]string{
+		"ETag":              `"{SHA1{` + sha1Hex(nexusContent) + `}}"`,
+		"Server":            "Nexus/3.68.1-02 (OSS)",
+		"X-Checksum-Sha256": sha256Hex(nexusContent),
+	})
+
+	tmpDir := t.TempDir()
+	dockerfilePath := filepath.Join(tmpDir, "Dockerfile")
+	dockerfileContent := `FROM alpine:3.18
+ADD ` + mockHTTP.URL() + `/artifactory/libs-release/tool.tar.gz /tmp/a.tar.gz
+ADD ` + mockHTTP.URL() + `/repository/raw-hosted/tool.tar.gz /tmp/n.tar.gz
+`
+	if err := os.WriteFile(dockerfilePath, []byte(dockerfileContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mockRegistry.ResetRequests()
+	mockHTTP.ResetRequests()
+
+	cmd := exec.Command(binaryPath, "pin", "--stdout", dockerfilePath)
+	cmd.Env = append(os.Environ(),
+		"CONTAINERS_REGISTRIES_CONF="+registryConf,
+		"GOCOVERDIR="+coverageDir,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			t.Fatalf("command failed: %v\nstderr: %s", err, exitErr.Stderr)
+		}
+		t.Fatalf("command failed: %v", err)
+	}
+
+	// Checksums come from HEAD responses only
+	if mockHTTP.HasRequest("GET ") {
+		t.Errorf("expected no downloads, got requests: %v", mockHTTP.Requests())
+	}
+
+	var pol policy.Policy
+	if err := json.Unmarshal(output, &pol); err != nil {
+		t.Fatalf("failed to parse policy output: %v\noutput: %s", err, output)
+	}
+	if err := policy.Validate(&pol); err != nil {
+		t.Fatalf("policy validation failed: %v", err)
+	}
+
+	want := map[string]string{
+		"/artifactory/libs-release/tool.tar.gz": artifactoryChecksum,
+		"/repository/raw-hosted/tool.tar.gz":    nexusChecksum,
+	}
+	for _, rule := range pol.Rules {
+		selector := rule.GetSelector()
+		if selector == nil {
+			continue
+		}
+		for path, checksum := range want {
+			if !strings.HasSuffix(selector.GetIdentifier(), path) {
+				continue
+			}
+			if got := rule.GetUpdates().GetAttrs()["http.checksum"]; got != checksum {
+				t.Errorf("%s: expected checksum %s, got %s", path, checksum, got)
+			}
+			delete(want, path)
+		}
+	}
+	for path := range want {
+		t.Errorf("expected rule for %s not found", path)
+	}
+}
+
 // TestPinHTTPSourcesWithExistingChecksum tests that ADD with --checksum is skipped
 func TestPinHTTPSourcesWithExistingChecksum(t *testing.T) {
 	// Create mock HTTP server
@@ -487,3 +591,360 @@ ADD --checksum=sha256:0000000000000000000000000000000000000000000000000000000000
 		t.Errorf("expected 1 rule (no HTTP rule since --checksum present), got %d", len(pol.Rules))
 	}
 }
+
+// TestPinOCILayoutBuildContext tests that oci-layout:// named contexts are pinned from the local
+// index.json under the source name BuildKit gives them, and that Dockerfile references overridden
+// by a named context are not resolved remotely
+func TestPinOCILayoutBuildContext(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	layoutDir := filepath.Join(tmpDir, "layout")
+	if err := os.MkdirAll(layoutDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	const layoutDigest = "sha256:4b0d3f1a2c5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8"
+	index := `{
+  "schemaVersion": 2,
+  "manifests": [
+    {
+      "mediaType": "application/vnd.oci.image.manifest.v1+json",
+      "digest": "` + layoutDigest + `",
+      "size": 401,
+      "annotations": {"org.opencontainers.image.ref.name": "v1"}
+    }
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(layoutDir, "index.json"), []byte(index), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dockerfilePath := filepath.Join(tmpDir, "Dockerfile")
+	dockerfileContent := `FROM base AS build
+FROM alpine:3.18
+COPY --from=build /out /out
+`
+	if err := os.WriteFile(dockerfilePath, []byte(dockerfileContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mockRegistry.ResetRequests()
+
+	cmd := exec.Command(binaryPath, "pin", "--stdout",
+		"--build-context", "base=oci-layout://"+layoutDir+":v1",
+		dockerfilePath,
+	)
+	cmd.Env = append(os.Environ(),
+		"CONTAINERS_REGISTRIES_CONF="+registryConf,
+		"GOCOVERDIR="+coverageDir,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("command failed: %v\noutput: %s", err, output)
+	}
+
+	// The named context must shadow docker.io/library/base
+	if mockRegistry.HasRequest("library/base") {
+		t.Errorf("expected no registry request for named context, got: %v", mockRegistry.Requests())
+	}
+
+	var pol policy.Policy
+	if err := json.Unmarshal(output, &pol); err != nil {
+		t.Fatalf("failed to parse policy output: %v\noutput: %s", err, output)
+	}
+	if err := policy.ValidateWithEvaluate(context.Background(), &pol); err != nil {
+		t.Fatalf("policy engine evaluation failed: %v", err)
+	}
+
+	if len(pol.Rules) != 2 {
+		t.Fatalf("expected 2 rules (alpine + oci-layout), got %d: %s", len(pol.Rules), output)
+	}
+
+	// buildx replaces the layout path with a session store ID, so the frontend names the source after the context
+	wantSelector := "oci-layout://docker.io/library/base@*"
+	wantUpdate := "oci-layout://docker.io/library/base@" + layoutDigest
+	found := false
+	for _, rule := range pol.Rules {
+		if rule.GetSelector().GetIdentifier() == wantSelector {
+			found = true
+			if got := rule.GetUpdates().GetIdentifier(); got != wantUpdate {
+				t.Errorf("expected update %s, got %s", wantUpdate, got)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected rule with selector %s, got: %s", wantSelector, output)
+	}
+}
+
+// TestPinNamedContextsNormalized tests that named contexts are matched by their normalized name and that
+// oci-layout contexts already pinned by digest are reported instead of getting a rule
+func TestPinNamedContextsNormalized(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	dockerfilePath := filepath.Join(tmpDir, "Dockerfile")
+	dockerfileContent := `FROM base AS build
+FROM cache AS deps
+FROM alpine:3.18
+COPY --from=build /out /out
+COPY --from=deps /deps /deps
+`
+	if err := os.WriteFile(dockerfilePath, []byte(dockerfileContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(tmpDir, "report.json")
+	const cacheDigest = "sha256:4b0d3f1a2c5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8"
+
+	mockRegistry.ResetRequests()
+
+	cmd := exec.Command(binaryPath, "pin", "--stdout", "--report", reportPath,
+		"--build-context", "docker.io/library/base:latest=docker-image://alpine:3.18",
+		"--build-context", "cache=oci-layout://"+filepath.Join(tmpDir, "missing")+"@"+cacheDigest,
+		dockerfilePath,
+	)
+	cmd.Env = append(os.Environ(),
+		"CONTAINERS_REGISTRIES_CONF="+registryConf,
+		"GOCOVERDIR="+coverageDir,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("command failed: %v\noutput: %s", err, output)
+	}
+
+	// BuildKit looks the context up as "base", so it shadows FROM base
+	if mockRegistry.HasRequest("library/base") || mockRegistry.HasRequest("library/cache") {
+		t.Errorf("expected no registry request for named contexts, got: %v", mockRegistry.Requests())
+	}
+
+	var pol policy.Policy
+	if err := json.Unmarshal(output, &pol); err != nil {
+		t.Fatalf("failed to parse policy output: %v\noutput: %s", err, output)
+	}
+	if len(pol.Rules) != 1 {
+		t.Fatalf("expected 1 rule (alpine only), got %d: %s", len(pol.Rules), output)
+	}
+
+	reportData, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		OCILayouts []struct {
+			Pinned        string `json:"pinned"`
+			AlreadyPinned bool   `json:"alreadyPinned"`
+		} `json:"ociLayouts"`
+	}
+	if err := json.Unmarshal(reportData, &report); err != nil {
+		t.Fatalf("failed to parse report: %v\n%s", err, reportData)
+	}
+	if len(report.OCILayouts) != 1 {
+		t.Fatalf("expected the pinned oci-layout context in the report, got: %s", reportData)
+	}
+	if got := report.OCILayouts[0]; !got.AlreadyPinned || got.Pinned != "docker.io/library/cache@"+cacheDigest {
+		t.Errorf("expected cache to be reported as already pinned, got %+v", got)
+	}
+}
+
+// TestPinAliasesResolvedOnce tests that different spellings of the same image are resolved once
+// and that each spelling gets its own rule pointing at the same digest
+func TestPinAliasesResolvedOnce(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	first := filepath.Join(tmpDir, "Dockerfile")
+	if err := os.WriteFile(first, []byte("FROM alpine:3.18\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	second := filepath.Join(tmpDir, "Dockerfile.ci")
+	if err := os.WriteFile(second, []byte("FROM docker.io/library/alpine:3.18\nFROM golang:1.21\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(tmpDir, "report.json")
+
+	mockRegistry.ResetRequests()
+
+	cmd := exec.Command(binaryPath, "pin", "--stdout", "--report", reportPath, first, second)
+	cmd.Env = append(os.Environ(),
+		"CONTAINERS_REGISTRIES_CONF="+registryConf,
+		"GOCOVERDIR="+coverageDir,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("command failed: %v\noutput: %s", err, output)
+	}
+
+	if got := mockRegistry.RequestCount("library/alpine/manifests/3.18"); got != 1 {
+		t.Errorf("expected alpine to be resolved once, got %d requests: %v", got, mockRegistry.Requests())
+	}
+
+	var pol policy.Policy
+	if err := json.Unmarshal(output, &pol); err != nil {
+		t.Fatalf("failed to parse policy output: %v\noutput: %s", err, output)
+	}
+	if len(pol.Rules) != 3 {
+		t.Fatalf("expected 3 rules (two alpine spellings + golang), got %d: %s", len(pol.Rules), output)
+	}
+	if pol.Rules[0].GetSelector().GetIdentifier() != "docker-image://alpine:3.18" ||
+		pol.Rules[1].GetSelector().GetIdentifier() != "docker-image://docker.io/library/alpine:3.18" {
+		t.Errorf("expected alias rules to be adjacent and in order of appearance: %s", output)
+	}
+	if pol.Rules[0].GetUpdates().GetIdentifier() != pol.Rules[1].GetUpdates().GetIdentifier() {
+		t.Errorf("expected aliases to be pinned to the same digest: %s", output)
+	}
+
+	reportData, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Images []struct {
+			Reference string   `json:"reference"`
+			Aliases   []string `json:"aliases"`
+			Pinned    string   `json:"pinned"`
+		} `json:"images"`
+	}
+	if err := json.Unmarshal(reportData, &report); err != nil {
+		t.Fatalf("failed to parse report: %v\n%s", err, reportData)
+	}
+	if len(report.Images) != 2 {
+		t.Fatalf("expected 2 images in report, got %d: %s", len(report.Images), reportData)
+	}
+	alpine := report.Images[0]
+	if alpine.Reference != "docker.io/library/alpine:3.18" {
+		t.Errorf("expected normalized reference, got %s", alpine.Reference)
+	}
+	if len(alpine.Aliases) != 2 || alpine.Aliases[0] != "alpine:3.18" || alpine.Aliases[1] != "docker.io/library/alpine:3.18" {
+		t.Errorf("expected aliases grouped together, got %v", alpine.Aliases)
+	}
+	if "docker-image://"+alpine.Pinned != pol.Rules[0].GetUpdates().GetIdentifier() {
+		t.Errorf("report pinned %s does not match policy %s", alpine.Pinned, pol.Rules[0].GetUpdates().GetIdentifier())
+	}
+}
+
+func TestPinGitRefsBatchedAndClassified(t *testing.T) {
+	gitServer := testutil.NewMockGitServer()
+	defer gitServer.Close()
+
+	const (
+		mainSHA   = "2222222222222222222222222222222222222222"
+		tagObject = "1111111111111111111111111111111111111111"
+		tagCommit = "54d56cab3a0882b43ac794df59924dc3f93bb75c"
+		lightSHA  = "3333333333333333333333333333333333333333"
+	)
+	gitServer.AddRepo("/owner/repo.git",
+		testutil.MockGitRef{Name: "HEAD", SHA: mainSHA},
+		testutil.MockGitRef{Name: "refs/heads/main", SHA: mainSHA},
+		testutil.MockGitRef{Name: "refs/tags/v1.0.0", SHA: tagObject, Peeled: tagCommit},
+		testutil.MockGitRef{Name: "refs/tags/v1.1.0", SHA: lightSHA},
+	)
+
+	repo := gitServer.URL() + "/owner/repo.git"
+	tmpDir := t.TempDir()
+	dockerfile := filepath.Join(tmpDir, "Dockerfile")
+	content := "FROM scratch\n" +
+		"ADD " + repo + "#v1.0.0 /annotated\n" +
+		"ADD " + repo + "#v1.1.0 /lightweight\n" +
+		"ADD " + repo + "#main /branch\n" +
+		"ADD " + repo + "#" + tagCommit + " /commit\n"
+	if err := os.WriteFile(dockerfile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(tmpDir, "report.json")
+
+	cmd := exec.Command(binaryPath, "pin", "--stdout", "--git-backend", "native", "--report", reportPath, dockerfile)
+	cmd.Env = append(os.Environ(), "GOCOVERDIR="+coverageDir)
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("command failed: %v\noutput: %s", err, output)
+	}
+
+	if got := gitServer.RequestCount("/owner/repo.git/info/refs"); got != 1 {
+		t.Errorf("expected one ref listing for the remote, got %d", got)
+	}
+
+	reportData, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Git []struct {
+			Source string `json:"source"`
+			Ref    string `json:"ref"`
+			Kind   string `json:"kind"`
+			Pinned string `json:"pinned"`
+		} `json:"git"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(reportData, &report); err != nil {
+		t.Fatalf("failed to parse report: %v\n%s", err, reportData)
+	}
+
+	want := []struct{ ref, kind, pinned string }{
+		{"refs/tags/v1.0.0", "annotated-tag", tagCommit},
+		{"refs/tags/v1.1.0", "lightweight-tag", lightSHA},
+		{"refs/heads/main", "branch", mainSHA},
+		{tagCommit, "commit", tagCommit},
+	}
+	if len(report.Git) != len(want) {
+		t.Fatalf("expected %d git sources in report, got %d: %s", len(want), len(report.Git), reportData)
+	}
+	for i, w := range want {
+		got := report.Git[i]
+		if got.Ref != w.ref || got.Kind != w.kind || got.Pinned != w.pinned {
+			t.Errorf("git[%d] = %s %s %s, want %s %s %s", i, got.Ref, got.Kind, got.Pinned, w.ref, w.kind, w.pinned)
+		}
+	}
+
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "#main is pinned from branch refs/heads/main") {
+		t.Errorf("expected a single branch warning, got %v", report.Warnings)
+	}
+}
+
+func TestPinGitSubdirMissing(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	tmpDir := t.TempDir()
+	work := filepath.Join(tmpDir, "work")
+	root := filepath.Join(tmpDir, "srv")
+	if err := os.MkdirAll(filepath.Join(work, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "docs", "index.md"), []byte("# docs\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-C", work, "init", "--quiet", "--initial-branch=main"},
+		{"-C", work, "add", "."},
+		{"-C", work, "-c", "user.name=Dev", "-c", "user.email=dev@example.com", "commit", "--quiet", "-m", "docs"},
+		{"-C", work, "tag", "v1.0.0"},
+		{"clone", "--quiet", "--bare", work, filepath.Join(root, "repo.git")},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	server, err := testutil.NewGitHTTPBackend(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	dockerfile := filepath.Join(tmpDir, "Dockerfile")
+	content := "FROM scratch\n" +
+		"ADD " + server.URL + "/repo.git#v1.0.0:docs /docs\n" +
+		"ADD " + server.URL + "/repo.git#v1.0.0:dcos /typo\n"
+	if err := os.WriteFile(dockerfile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(binaryPath, "pin", "--stdout", "--git-backend", "cli", dockerfile)
+	cmd.Env = append(os.Environ(), "GOCOVERDIR="+coverageDir)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected pin to fail for a missing subdir, got: %s", output)
+	}
+	if want := dockerfile + `:3: ADD ` + server.URL + `/repo.git#v1.0.0:dcos: subdir "dcos" does not exist`; !strings.Contains(string(output), want) {
+		t.Errorf("expected error pointing at the Dockerfile line %q, got: %s", want, output)
+	}
+}
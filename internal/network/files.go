@@ -0,0 +1,170 @@
+package network
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// systemBundles are the usual locations of the system CA bundle (as in crypto/x509)
+var systemBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// CertDir returns a directory in the layout containers/image expects for a registry (CA certificates
+// ending in .crt, client.cert and client.key), or "" when no TLS setting applies to the host.
+// containers/image reads only this directory once it is set, so the certificates and keys of the host's
+// certs.d directory (systemDir, if any) are copied in too, named so that the configured client certificate comes first.
+func (n *Network) CertDir(hostport, systemDir string) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	key := strings.ToLower(hostport)
+	if dir, ok := n.certDirs[key]; ok {
+		return dir, nil
+	}
+
+	files := make(map[string]string) // name in the directory -> source file
+	if n.cfg.CACert != "" {
+		files["ca.crt"] = n.cfg.CACert
+	}
+	certFile, keyFile := n.cfg.ClientCert, n.cfg.ClientKey
+	if host, ok := n.Host(hostport); ok {
+		if host.CACert != "" {
+			files["host-ca.crt"] = host.CACert
+		}
+		for i, caFile := range host.ExtraCACerts {
+			files["host-ca-"+strconv.Itoa(i+1)+".crt"] = caFile
+		}
+		if host.ClientCert != "" {
+			certFile, keyFile = host.ClientCert, host.ClientKey
+		}
+	}
+	if certFile != "" {
+		files["client.cert"] = certFile
+		files["client.key"] = keyFile
+	}
+	if len(files) == 0 {
+		n.certDirs[key] = ""
+		return "", nil
+	}
+
+	if systemDir != "" {
+		entries, err := os.ReadDir(systemDir)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".crt", ".cert", ".key":
+				files["system-"+entry.Name()] = filepath.Join(systemDir, entry.Name())
+			}
+		}
+	}
+
+	dir, err := n.writeTemp("certs.d-"+strings.ReplaceAll(key, ":", "_"), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	for name, source := range files {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			return "", err
+		}
+	}
+	n.certDirs[key] = dir
+	return dir, nil
+}
+
+// GitArgs returns the git -c options that apply the settings to git's HTTP(S) transport.
+// git replaces its CA bundle rather than adding to it, so CA bundles combine the system bundle with the configured CAs.
+func (n *Network) GitArgs() ([]string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var args []string
+	set := func(key, value string) {
+		args = append(args, "-c", key+"="+value)
+	}
+
+	if n.cfg.CACert != "" {
+		bundle, err := n.caBundle("ca-bundle.pem", n.cfg.CACert)
+		if err != nil {
+			return nil, err
+		}
+		set("http.sslCAInfo", bundle)
+	}
+	if n.cfg.ClientCert != "" {
+		set("http.sslCert", n.cfg.ClientCert)
+		set("http.sslKey", n.cfg.ClientKey)
+	}
+
+	for _, host := range n.cfg.Hosts {
+		prefix := "http.https://" + host.Host + "/."
+		if host.CACert != "" || len(host.ExtraCACerts) > 0 {
+			caFiles := append([]string{n.cfg.CACert, host.CACert}, host.ExtraCACerts...)
+			bundle, err := n.caBundle("ca-bundle-"+strings.ReplaceAll(host.Host, ":", "_")+".pem", caFiles...)
+			if err != nil {
+				return nil, err
+			}
+			set(prefix+"sslCAInfo", bundle)
+		}
+		if host.ClientCert != "" {
+			set(prefix+"sslCert", host.ClientCert)
+			set(prefix+"sslKey", host.ClientKey)
+		}
+		if host.Insecure {
+			set(prefix+"sslVerify", "false")
+		}
+	}
+
+	if n.proxy != nil && !n.bypassProxy("") {
+		set("http.proxy", n.proxy.String())
+		// An empty proxy disables proxying for the URLs it matches
+		for _, entry := range n.cfg.NoProxy {
+			domain := strings.TrimPrefix(entry, ".")
+			for _, scheme := range []string{"https", "http"} {
+				set("http."+scheme+"://"+domain+"/.proxy", "")
+				set("http."+scheme+"://*."+domain+"/.proxy", "")
+			}
+		}
+	}
+	return args, nil
+}
+
+// caBundle writes the system CA bundle followed by caFiles to name, and returns its path
+func (n *Network) caBundle(name string, caFiles ...string) (string, error) {
+	var bundle []byte
+	sources := append([]string{os.Getenv("SSL_CERT_FILE")}, systemBundles...)
+	for _, source := range sources {
+		if data, err := os.ReadFile(source); source != "" && err == nil {
+			bundle = append(bundle, data...)
+			break
+		}
+	}
+	for _, caFile := range caFiles {
+		if caFile == "" {
+			continue
+		}
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+		bundle = append(append(bundle, '\n'), data...)
+	}
+	path, err := n.writeTemp(name, bundle)
+	if err != nil {
+		return "", fmt.Errorf("failed to write CA bundle: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,244 @@
+// Package network applies the TLS and proxy settings of the configuration file (or the --cacert,
+// --client-cert and --client-key flags) to the HTTP, registry and git clients, so that a private CA,
+// a client certificate or a proxy is configured once for every connection the tool makes.
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/wharflab/container-source-policy/internal/config"
+)
+
+// Network holds the loaded certificates and proxy settings
+type Network struct {
+	cfg        config.NetworkConfig
+	proxy      *url.URL
+	defaultTLS *tls.Config            // nil when no global setting applies
+	hostTLS    map[string]*tls.Config // lowercase host or host:port -> TLS settings
+	hosts      map[string]config.NetworkHost
+	transport  http.RoundTripper
+
+	mu       sync.Mutex
+	tempDir  string            // certificate directories and CA bundles handed to other tools
+	certDirs map[string]string // registry host -> certificate directory
+}
+
+// New loads the certificates of cfg, failing on unreadable or invalid files
+func New(cfg config.NetworkConfig) (*Network, error) {
+	n := &Network{
+		cfg:      cfg,
+		hostTLS:  make(map[string]*tls.Config),
+		hosts:    make(map[string]config.NetworkHost),
+		certDirs: make(map[string]string),
+	}
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", cfg.Proxy, err)
+		}
+		n.proxy = proxy
+	}
+
+	roots, err := loadRoots(nil, cfg.CACert)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := loadClientCert(cfg.ClientCert, cfg.ClientKey)
+	if err != nil {
+		return nil, err
+	}
+	if roots != nil || cert != nil {
+		n.defaultTLS = newTLSConfig(roots, cert)
+	}
+
+	for _, host := range cfg.Hosts {
+		hostRoots, err := loadRoots(roots, append([]string{host.CACert}, host.ExtraCACerts...)...)
+		if err != nil {
+			return nil, err
+		}
+		hostCert := cert
+		if host.ClientCert != "" {
+			if hostCert, err = loadClientCert(host.ClientCert, host.ClientKey); err != nil {
+				return nil, err
+			}
+		}
+		tlsConfig := newTLSConfig(hostRoots, hostCert)
+		tlsConfig.InsecureSkipVerify = host.Insecure //nolint:gosec // explicitly requested per host
+		key := strings.ToLower(host.Host)
+		n.hostTLS[key] = tlsConfig
+		n.hosts[key] = host
+	}
+
+	n.transport = n.newTransport()
+	return n, nil
+}
+
+// Close removes the certificate directories and CA bundles written for other tools
+func (n *Network) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.tempDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(n.tempDir)
+	n.tempDir = ""
+	return err
+}
+
+// loadRoots returns base (or the system roots) with the certificates of caFiles added,
+// or base unchanged when caFiles are empty
+func loadRoots(base *x509.CertPool, caFiles ...string) (*x509.CertPool, error) {
+	pool := base
+	for _, caFile := range caFiles {
+		if caFile == "" {
+			continue
+		}
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+		if pool == base {
+			if base != nil {
+				pool = base.Clone()
+			} else if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", caFile)
+		}
+	}
+	return pool, nil
+}
+
+// loadClientCert loads a PEM client certificate and key, or returns nil when none is configured
+func loadClientCert(certFile, keyFile string) (*tls.Certificate, error) {
+	if certFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate %s: %w", certFile, err)
+	}
+	return &cert, nil
+}
+
+func newTLSConfig(roots *x509.CertPool, cert *tls.Certificate) *tls.Config {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+	return tlsConfig
+}
+
+// Host returns the settings for a host ("host" or "host:port"); an entry with the port wins over one without
+func (n *Network) Host(hostport string) (config.NetworkHost, bool) {
+	key := hostKey(n.hosts, hostport)
+	host, ok := n.hosts[key]
+	return host, ok
+}
+
+// hostKey returns the key of m that hostport matches: hostport itself, or its hostname
+func hostKey[V any](m map[string]V, hostport string) string {
+	hostport = strings.ToLower(hostport)
+	if _, ok := m[hostport]; ok {
+		return hostport
+	}
+	host := hostport
+	if u, err := url.Parse("//" + hostport); err == nil {
+		host = u.Hostname()
+	}
+	return host
+}
+
+// TLSConfig returns the TLS settings for a host, or nil when the defaults apply
+func (n *Network) TLSConfig(hostport string) *tls.Config {
+	if tlsConfig, ok := n.hostTLS[hostKey(n.hostTLS, hostport)]; ok {
+		return tlsConfig
+	}
+	return n.defaultTLS
+}
+
+// ProxyURL returns the proxy for a URL, or nil to connect directly
+func (n *Network) ProxyURL(u *url.URL) (*url.URL, error) {
+	if n.proxy == nil {
+		return http.ProxyFromEnvironment(&http.Request{URL: u})
+	}
+	if n.bypassProxy(u.Hostname()) {
+		return nil, nil
+	}
+	return n.proxy, nil
+}
+
+// bypassProxy reports whether host is reached without the configured proxy, following NO_PROXY conventions:
+// "example.com" and ".example.com" both match example.com and its subdomains, "*" matches everything
+func (n *Network) bypassProxy(host string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range n.cfg.NoProxy {
+		entry = strings.ToLower(strings.TrimPrefix(entry, "."))
+		if entry == "*" || host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Transport returns an http.RoundTripper that applies the TLS settings of each request's host and the proxy
+func (n *Network) Transport() http.RoundTripper {
+	return n.transport
+}
+
+func (n *Network) newTransport() http.RoundTripper {
+	proxy := func(req *http.Request) (*url.URL, error) { return n.ProxyURL(req.URL) }
+	newTransport := func(tlsConfig *tls.Config) *http.Transport {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = proxy
+		if tlsConfig != nil {
+			transport.TLSClientConfig = tlsConfig
+		}
+		return transport
+	}
+
+	hosts := make(map[string]*http.Transport, len(n.hostTLS))
+	for key, tlsConfig := range n.hostTLS {
+		hosts[key] = newTransport(tlsConfig)
+	}
+	return &hostTransport{fallback: newTransport(n.defaultTLS), hosts: hosts}
+}
+
+// hostTransport sends each request through the transport configured for its host
+type hostTransport struct {
+	fallback *http.Transport
+	hosts    map[string]*http.Transport
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := t.hosts[hostKey(t.hosts, req.URL.Host)]; ok {
+		return transport.RoundTrip(req)
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// writeTemp creates a file or directory in the Network's temporary directory, creating the directory on first use
+func (n *Network) writeTemp(name string, data []byte) (string, error) {
+	if n.tempDir == "" {
+		dir, err := os.MkdirTemp("", "container-source-policy-network-")
+		if err != nil {
+			return "", err
+		}
+		n.tempDir = dir
+	}
+	path := filepath.Join(n.tempDir, name)
+	if data == nil {
+		return path, os.MkdirAll(path, 0o700)
+	}
+	return path, os.WriteFile(path, data, 0o600)
+}
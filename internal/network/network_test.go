@@ -0,0 +1,303 @@
+package network
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wharflab/container-source-policy/internal/config"
+)
+
+// writePEM writes a PEM block to a file in dir and returns its path
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCert writes a self-signed client certificate and its key, and returns them with the certificate
+func newClientCert(t *testing.T) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ci"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile = writePEM(t, dir, "client.pem", "CERTIFICATE", der)
+	keyFile = writePEM(t, dir, "client-key.pem", "PRIVATE KEY", keyDER)
+	return certFile, keyFile, cert
+}
+
+// newTLSServer starts an HTTPS server and returns it with a file holding its certificate
+func newTLSServer(t *testing.T, clientCA *x509.Certificate) (*httptest.Server, string) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA)
+		server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+}
+
+func newNetwork(t *testing.T, cfg config.NetworkConfig) *Network {
+	t.Helper()
+	n, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = n.Close() })
+	return n
+}
+
+func get(n *Network, rawURL string) error {
+	resp, err := (&http.Client{Transport: n.Transport(), Timeout: 5 * time.Second}).Get(rawURL)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestTransport_TLS(t *testing.T) {
+	certFile, keyFile, clientCert := newClientCert(t)
+	server, serverCA := newTLSServer(t, nil)
+	mtlsServer, mtlsCA := newTLSServer(t, clientCert)
+	mtlsHost := mtlsServer.Listener.Addr().String()
+
+	tests := []struct {
+		name    string
+		cfg     config.NetworkConfig
+		url     string
+		wantErr bool
+	}{
+		{name: "unknown CA", url: server.URL, wantErr: true},
+		{name: "cacert", cfg: config.NetworkConfig{CACert: serverCA}, url: server.URL},
+		{
+			name: "host cacert",
+			cfg:  config.NetworkConfig{Hosts: []config.NetworkHost{{Host: "127.0.0.1", CACert: serverCA}}},
+			url:  server.URL,
+		},
+		{
+			name: "insecure host",
+			cfg:  config.NetworkConfig{Hosts: []config.NetworkHost{{Host: "127.0.0.1", Insecure: true}}},
+			url:  server.URL,
+		},
+		{
+			name:    "missing client certificate",
+			cfg:     config.NetworkConfig{CACert: mtlsCA},
+			url:     mtlsServer.URL,
+			wantErr: true,
+		},
+		{
+			name: "client certificate",
+			cfg:  config.NetworkConfig{CACert: mtlsCA, ClientCert: certFile, ClientKey: keyFile},
+			url:  mtlsServer.URL,
+		},
+		{
+			name: "host client certificate",
+			cfg: config.NetworkConfig{Hosts: []config.NetworkHost{
+				{Host: mtlsHost, CACert: mtlsCA, ClientCert: certFile, ClientKey: keyFile},
+			}},
+			url: mtlsServer.URL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := get(newNetwork(t, tt.cfg), tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidFiles(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cfg := range []config.NetworkConfig{
+		{CACert: filepath.Join(t.TempDir(), "missing.pem")},
+		{CACert: notPEM},
+		{ClientCert: notPEM, ClientKey: notPEM},
+		{Hosts: []config.NetworkHost{{Host: "example.com", CACert: notPEM}}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	n := newNetwork(t, config.NetworkConfig{
+		Proxy:   "http://proxy.internal:3128",
+		NoProxy: []string{".internal", "localhost"},
+	})
+
+	tests := []struct {
+		url       string
+		wantProxy bool
+	}{
+		{url: "https://github.com/moby/buildkit.git", wantProxy: true},
+		{url: "https://registry.internal:5000/v2/", wantProxy: false},
+		{url: "https://a.b.internal/file", wantProxy: false},
+		{url: "https://internal.example.com/file", wantProxy: true},
+		{url: "http://localhost:8080/", wantProxy: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			proxy, err := n.ProxyURL(u)
+			if err != nil {
+				t.Fatalf("ProxyURL() error = %v", err)
+			}
+			if (proxy != nil) != tt.wantProxy {
+				t.Errorf("ProxyURL() = %v, want proxy %v", proxy, tt.wantProxy)
+			}
+		})
+	}
+}
+
+func TestCertDir(t *testing.T) {
+	certFile, keyFile, _ := newClientCert(t)
+	_, serverCA := newTLSServer(t, nil)
+	n := newNetwork(t, config.NetworkConfig{
+		CACert: serverCA,
+		Hosts: []config.NetworkHost{
+			{Host: "registry.internal:5000", CACert: serverCA, ExtraCACerts: []string{serverCA}, ClientCert: certFile, ClientKey: keyFile},
+		},
+	})
+
+	// The host's certs.d files are kept next to the configured ones
+	systemDir := t.TempDir()
+	for _, name := range []string{"ca.crt", "client.cert", "client.key", "README"} {
+		if err := os.WriteFile(filepath.Join(systemDir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, err := n.CertDir("registry.internal:5000", systemDir)
+	if err != nil {
+		t.Fatalf("CertDir() error = %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{
+		"ca.crt", "client.cert", "client.key", "host-ca-1.crt", "host-ca.crt",
+		"system-ca.crt", "system-client.cert", "system-client.key",
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("CertDir() files = %v, want %v", names, want)
+	}
+
+	// Without TLS settings containers/image finds the certs.d directory itself
+	if dir, err := newNetwork(t, config.NetworkConfig{}).CertDir("docker.io", systemDir); err != nil || dir != "" {
+		t.Errorf("CertDir() = %q, %v, want no directory without TLS settings", dir, err)
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Close() left %s behind", dir)
+	}
+}
+
+func TestGitArgs(t *testing.T) {
+	certFile, keyFile, _ := newClientCert(t)
+	_, serverCA := newTLSServer(t, nil)
+	n := newNetwork(t, config.NetworkConfig{
+		CACert:  serverCA,
+		Proxy:   "http://proxy.internal:3128",
+		NoProxy: []string{".internal"},
+		Hosts: []config.NetworkHost{
+			{Host: "git.internal", ClientCert: certFile, ClientKey: keyFile, Insecure: true},
+		},
+	})
+
+	args, err := n.GitArgs()
+	if err != nil {
+		t.Fatalf("GitArgs() error = %v", err)
+	}
+	options := make(map[string]string)
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] != "-c" {
+			t.Fatalf("GitArgs() = %v, want -c pairs", args)
+		}
+		key, value, _ := strings.Cut(args[i+1], "=")
+		options[key] = value
+	}
+
+	bundle, err := os.ReadFile(options["http.sslCAInfo"])
+	if err != nil {
+		t.Fatalf("http.sslCAInfo: %v", err)
+	}
+	ca, _ := os.ReadFile(serverCA)
+	if !bytes.Contains(bundle, ca) {
+		t.Errorf("CA bundle %s does not include the configured CA", options["http.sslCAInfo"])
+	}
+
+	want := map[string]string{
+		"http.https://git.internal/.sslCert":   certFile,
+		"http.https://git.internal/.sslKey":    keyFile,
+		"http.https://git.internal/.sslVerify": "false",
+		"http.proxy":                           "http://proxy.internal:3128",
+		"http.https://internal/.proxy":         "",
+		"http.https://*.internal/.proxy":       "",
+	}
+	for key, value := range want {
+		if got, ok := options[key]; !ok || got != value {
+			t.Errorf("git option %s = %q, want %q", key, got, value)
+		}
+	}
+}
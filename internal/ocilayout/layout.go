@@ -0,0 +1,159 @@
+// Package ocilayout resolves oci-layout:// sources (as used by BuildKit named contexts)
+// to manifest digests by reading the layout's index.json from the local filesystem.
+package ocilayout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Scheme is the BuildKit source scheme for OCI layouts
+const Scheme = "oci-layout://"
+
+// DefaultTag is used when an oci-layout reference has neither a tag nor a digest.
+// Matches the behavior of docker buildx for --build-context name=oci-layout://<path>.
+const DefaultTag = "latest"
+
+// annotationImageName is the containerd annotation BuildKit checks before the OCI ref name
+const annotationImageName = "io.containerd.image.name"
+
+// ErrNotOCILayout is returned when an identifier does not use the oci-layout:// scheme.
+var ErrNotOCILayout = errors.New("not an oci-layout:// reference")
+
+// Ref represents a parsed oci-layout:// reference
+type Ref struct {
+	// Original is the identifier as written, without the oci-layout:// prefix
+	Original string
+	// Path is the local filesystem path of the OCI layout directory
+	Path string
+	// Tag is the tag to resolve (empty if Digest is set and no tag was given)
+	Tag string
+	// Digest is the manifest digest if the reference is already pinned
+	Digest digest.Digest
+}
+
+// IsOCILayout reports whether s uses the oci-layout:// scheme
+func IsOCILayout(s string) bool {
+	return strings.HasPrefix(s, Scheme)
+}
+
+// ParseRef parses an oci-layout://<path>[:<tag>][@<digest>] identifier.
+// Examples:
+//   - oci-layout://./build/image:v1
+//   - oci-layout:///srv/layouts/app@sha256:...
+//   - oci-layout://./build/image (tag defaults to "latest")
+func ParseRef(s string) (*Ref, error) {
+	rest, ok := strings.CutPrefix(s, Scheme)
+	if !ok {
+		return nil, ErrNotOCILayout
+	}
+	if rest == "" {
+		return nil, fmt.Errorf("invalid oci-layout reference %q: missing path", s)
+	}
+
+	ref := &Ref{Original: rest}
+
+	if before, after, found := strings.Cut(rest, "@"); found {
+		d, err := digest.Parse(after)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oci-layout reference %q: %w", s, err)
+		}
+		ref.Digest = d
+		rest = before
+	}
+
+	// A tag is the part after the last ':' that follows the last path separator
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		ref.Tag = rest[i+1:]
+		rest = rest[:i]
+	}
+	if rest == "" {
+		return nil, fmt.Errorf("invalid oci-layout reference %q: missing path", s)
+	}
+	ref.Path = rest
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DefaultTag
+	}
+
+	return ref, nil
+}
+
+// IsPinned reports whether the reference already includes a digest
+func (r *Ref) IsPinned() bool {
+	return r.Digest != ""
+}
+
+// SourceName returns the name BuildKit gives the source of an oci-layout named context, as in
+// oci-layout://<name>@<digest>. buildx replaces the layout path with a random store ID before sending the
+// context, so the Dockerfile frontend names the source after the context name, normalized as an image reference
+// (base -> docker.io/library/base); the path never reaches BuildKit.
+func SourceName(contextName string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(contextName)
+	if err != nil {
+		return "", fmt.Errorf("context name %q is not a valid image reference: %w", contextName, err)
+	}
+	return named.String(), nil
+}
+
+// ResolveDigest looks up the reference's tag in the layout's index.json and returns
+// the digest of the matching manifest or index. No network access is performed.
+//
+// Lookup follows BuildKit's ociindex semantics: manifests annotated with
+// io.containerd.image.name are checked first, then org.opencontainers.image.ref.name.
+// If the default tag is requested and the index holds exactly one untagged manifest,
+// that manifest is used.
+func ResolveDigest(ref *Ref) (digest.Digest, error) {
+	if ref.IsPinned() {
+		return ref.Digest, nil
+	}
+
+	indexPath := filepath.Join(ref.Path, ocispecs.ImageIndexFile)
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read OCI layout index: %w", err)
+	}
+
+	var index ocispecs.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", indexPath, err)
+	}
+
+	if desc := findTag(index.Manifests, ref.Tag); desc != nil {
+		if err := desc.Digest.Validate(); err != nil {
+			return "", fmt.Errorf("invalid digest for tag %s in %s: %w", ref.Tag, indexPath, err)
+		}
+		return desc.Digest, nil
+	}
+
+	return "", fmt.Errorf("tag %s not found in %s", ref.Tag, indexPath)
+}
+
+// findTag returns the descriptor matching tag, or nil if none matches
+func findTag(manifests []ocispecs.Descriptor, tag string) *ocispecs.Descriptor {
+	for i, m := range manifests {
+		if m.Annotations[annotationImageName] == tag {
+			return &manifests[i]
+		}
+	}
+	for i, m := range manifests {
+		if m.Annotations[ocispecs.AnnotationRefName] == tag {
+			return &manifests[i]
+		}
+	}
+	// Single untagged manifest: buildx falls back to it for the default tag
+	if tag == DefaultTag && len(manifests) == 1 {
+		if _, ok := manifests[0].Annotations[ocispecs.AnnotationRefName]; !ok {
+			return &manifests[0]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package ocilayout
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	testDigestA = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testDigestB = "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantPath   string
+		wantTag    string
+		wantDigest string
+		wantErr    bool
+	}{
+		{"relative path with tag", "oci-layout://./build/image:v1", "./build/image", "v1", "", false},
+		{"absolute path with tag", "oci-layout:///srv/layouts/app:1.2.3", "/srv/layouts/app", "1.2.3", "", false},
+		{"no tag defaults to latest", "oci-layout://./build/image", "./build/image", "latest", "", false},
+		{"digest only", "oci-layout://./image@" + testDigestA, "./image", "", testDigestA, false},
+		{"tag and digest", "oci-layout://./image:v1@" + testDigestA, "./image", "v1", testDigestA, false},
+		{"colon in directory is not a tag", "oci-layout://./dir:x/image", "./dir:x/image", "latest", "", false},
+		{"wrong scheme", "docker-image://alpine:3.18", "", "", "", true},
+		{"empty path", "oci-layout://", "", "", "", true},
+		{"tag without path", "oci-layout://:v1", "", "", "", true},
+		{"invalid digest", "oci-layout://./image@sha256:xyz", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRef(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRef(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Path != tt.wantPath {
+				t.Errorf("Path = %q, want %q", got.Path, tt.wantPath)
+			}
+			if got.Tag != tt.wantTag {
+				t.Errorf("Tag = %q, want %q", got.Tag, tt.wantTag)
+			}
+			if got.Digest.String() != tt.wantDigest {
+				t.Errorf("Digest = %q, want %q", got.Digest, tt.wantDigest)
+			}
+		})
+	}
+}
+
+func writeIndex(t *testing.T, manifests ...ocispecs.Descriptor) string {
+	t.Helper()
+	dir := t.TempDir()
+	index := ocispecs.Index{Manifests: manifests}
+	index.SchemaVersion = 2
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ocispecs.ImageIndexFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func descriptor(d string, annotations map[string]string) ocispecs.Descriptor {
+	return ocispecs.Descriptor{
+		MediaType:   ocispecs.MediaTypeImageManifest,
+		Digest:      digest.Digest(d),
+		Size:        100,
+		Annotations: annotations,
+	}
+}
+
+func TestResolveDigest(t *testing.T) {
+	dir := writeIndex(t,
+		descriptor(testDigestA, map[string]string{ocispecs.AnnotationRefName: "v1"}),
+		descriptor(testDigestB, map[string]string{
+			ocispecs.AnnotationRefName: "v2",
+			annotationImageName:        "docker.io/library/app:v2",
+		}),
+	)
+
+	tests := []struct {
+		name    string
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{"OCI ref name", "v1", testDigestA, false},
+		{"containerd image name", "docker.io/library/app:v2", testDigestB, false},
+		{"missing tag", "v3", "", true},
+		{"default tag with multiple manifests", DefaultTag, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveDigest(&Ref{Path: dir, Tag: tt.tag})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveDigest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ResolveDigest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveDigest_SingleUntaggedManifest(t *testing.T) {
+	dir := writeIndex(t, descriptor(testDigestA, nil))
+
+	got, err := ResolveDigest(&Ref{Path: dir, Tag: DefaultTag})
+	if err != nil {
+		t.Fatalf("ResolveDigest() error = %v", err)
+	}
+	if got.String() != testDigestA {
+		t.Errorf("ResolveDigest() = %q, want %q", got, testDigestA)
+	}
+}
+
+func TestResolveDigest_Pinned(t *testing.T) {
+	// Already pinned references must not touch the filesystem
+	got, err := ResolveDigest(&Ref{Path: "/does/not/exist", Digest: testDigestB})
+	if err != nil {
+		t.Fatalf("ResolveDigest() error = %v", err)
+	}
+	if got.String() != testDigestB {
+		t.Errorf("ResolveDigest() = %q, want %q", got, testDigestB)
+	}
+}
+
+func TestResolveDigest_MissingLayout(t *testing.T) {
+	if _, err := ResolveDigest(&Ref{Path: t.TempDir(), Tag: "v1"}); err == nil {
+		t.Error("expected error for directory without index.json")
+	}
+}
+
+func TestSourceName(t *testing.T) {
+	tests := []struct {
+		contextName string
+		want        string
+		wantErr     bool
+	}{
+		{"base", "docker.io/library/base", false},
+		{"myorg/base", "docker.io/myorg/base", false},
+		{"registry.example.com/base", "registry.example.com/base", false},
+		{"base:v1", "docker.io/library/base:v1", false},
+		{"Base", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contextName, func(t *testing.T) {
+			got, err := SourceName(tt.contextName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SourceName(%q) error = %v, wantErr %v", tt.contextName, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SourceName(%q) = %q, want %q", tt.contextName, got, tt.want)
+			}
+		})
+	}
+}
@@ -7,12 +7,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/dustin/go-humanize"
@@ -23,11 +26,14 @@ import (
 	"golang.org/x/term"
 
 	httpclient "github.com/wharflab/container-source-policy/httpchecksum"
+	"github.com/wharflab/container-source-policy/internal/config"
 	"github.com/wharflab/container-source-policy/internal/dhi"
 	"github.com/wharflab/container-source-policy/internal/dockerfile"
 	"github.com/wharflab/container-source-policy/internal/ecrpublic"
 	"github.com/wharflab/container-source-policy/internal/git"
 	"github.com/wharflab/container-source-policy/internal/mcr"
+	"github.com/wharflab/container-source-policy/internal/network"
+	"github.com/wharflab/container-source-policy/internal/ocilayout"
 	"github.com/wharflab/container-source-policy/internal/policy"
 	"github.com/wharflab/container-source-policy/internal/registry"
 )
@@ -38,66 +44,177 @@ type Options struct {
 	PreferDHI       bool // Prefer Docker Hardened Images (dhi.io) when available
 	PreferECRPublic bool // Prefer AWS ECR Public Gallery (public.ecr.aws) when available
 	PreferMCR       bool // Prefer Microsoft Container Registry (mcr.microsoft.com) mirror when available
+	// BuildContexts are named build contexts in "name=value" form (as passed to docker buildx --build-context).
+	// oci-layout:// values are pinned; any named context shadows the image of the same name in the Dockerfiles.
+	BuildContexts []string
+	// GitBackend selects how git refs are resolved (auto, cli, or native; empty means auto)
+	GitBackend string
+	// VerifyGitSignatures checks tag/commit signatures against the keys configured per remote before pinning
+	VerifyGitSignatures bool
+	// ArchiveAsGit converts GitHub archive URLs to git sources pinned with git.checksum instead of hashing the archive
+	ArchiveAsGit bool
+	// MaxDownloadSize skips HTTP sources whose checksum needs downloading more than this many bytes (0 means no limit)
+	MaxDownloadSize int64
+	// DownloadBudget caps the bytes downloaded for HTTP checksums across the run (0 means no limit)
+	DownloadBudget int64
+	// HTTPTimeout bounds each HTTP checksum request, including the download (0 means 5 minutes)
+	HTTPTimeout time.Duration
+	// GitTimeout bounds each git network operation (0 means 30 seconds)
+	GitTimeout time.Duration
+	// AuthFile replaces the default registry auth files (REGISTRY_AUTH_FILE, auth.json, Docker's config.json)
+	AuthFile string
+	// RegistryCredentials take precedence over the auth files for their registries
+	RegistryCredentials []registry.Credential
+	// DebugAuth logs where the credentials of each registry come from
+	DebugAuth bool
+	// RegistryMirrors are tried before their registry when resolving images (registry -> host[/path prefix])
+	RegistryMirrors map[string][]string
+	// Config is the loaded configuration file (nil means defaults)
+	Config *config.Config
 }
 
-// imageTask represents an image to pin
+// imageTask represents an image to pin.
+// All spellings of the same normalized reference share one task, so each image is resolved once.
 type imageTask struct {
-	index    int // original order in Dockerfile
-	original string
-	ref      reference.Named
+	index   int      // original order in Dockerfile
+	aliases []string // spellings as written in the Dockerfiles, in order of appearance
+	ref     reference.Named
 }
 
 // httpTask represents an HTTP source to checksum
 type httpTask struct {
 	index int // original order in Dockerfile
 	url   string
+	at    position // first occurrence, for error messages and warnings
 }
 
 // gitTask represents a git source to resolve
 type gitTask struct {
-	index int // original order in Dockerfile
-	url   string
+	index      int // original order in Dockerfile
+	url        string
+	at         position // first occurrence, for error messages and warnings
+	archiveURL string   // GitHub archive URL this git source replaces (with ArchiveAsGit)
+}
+
+// ociLayoutTask represents an OCI layout build context to resolve
+type ociLayoutTask struct {
+	index  int // original order of --build-context flags
+	ref    *ocilayout.Ref
+	source string // source name BuildKit gives the context (see ocilayout.SourceName)
 }
 
 // pinResult holds the result of a pin operation
 type pinResult struct {
-	index    int // original order in Dockerfile
-	original string
-	pinned   string
+	index   int // original order in Dockerfile
+	ref     string
+	aliases []string
+	pinned  string
 }
 
 // httpResult holds the result of an HTTP checksum operation
 type httpResult struct {
-	index    int // original order in Dockerfile
-	url      string
-	checksum string
-	headers  map[string]string
+	index        int // original order in Dockerfile
+	url          string
+	checksum     string
+	headers      map[string]string
+	authRequired bool     // the source was only reachable with credentials
+	redirects    []string // locations the URL redirected to
+	stableURL    string   // URL suggested instead of a moving one
+}
+
+// ociLayoutResult holds the result of an OCI layout resolution
+type ociLayoutResult struct {
+	index    int    // original order of --build-context flags
+	original string // layout path and tag as given, without the scheme
+	source   string // source name BuildKit gives the context
+	digest   string
+	pinned   bool // the context was already written with a digest, so no rule is needed
 }
 
 // gitResult holds the result of a git resolution
 type gitResult struct {
-	index    int // original order in Dockerfile
-	url      string
-	checksum string
+	index      int // original order in Dockerfile
+	url        string
+	checksum   string
+	ref        string         // full ref name the URL resolved to
+	kind       git.RefKind    // branch, tag or commit
+	signature  *git.Signature // verified signature (with --verify-git-signatures)
+	archiveURL string         // GitHub archive URL converted to this git source
 }
 
 // taskCollector collects unique tasks from Dockerfiles
 type taskCollector struct {
-	imageTasks []imageTask
-	httpTasks  []httpTask
-	gitTasks   []gitTask
-	seenImages map[string]bool
-	seenHTTP   map[string]bool
-	seenGit    map[string]bool
-	orderIndex int
+	imageTasks    []imageTask
+	httpTasks     []httpTask
+	gitTasks      []gitTask
+	ociTasks      []ociLayoutTask
+	seenImages    map[string]bool
+	imageByName   map[string]int // normalized reference -> position in imageTasks
+	seenHTTP      map[string]bool
+	seenGit       map[string]bool
+	seenOCI       map[string]bool
+	namedContexts map[string]bool
+	orderIndex    int
 }
 
 func newTaskCollector() *taskCollector {
 	return &taskCollector{
-		seenImages: make(map[string]bool),
-		seenHTTP:   make(map[string]bool),
-		seenGit:    make(map[string]bool),
+		seenImages:    make(map[string]bool),
+		imageByName:   make(map[string]int),
+		seenHTTP:      make(map[string]bool),
+		seenGit:       make(map[string]bool),
+		seenOCI:       make(map[string]bool),
+		namedContexts: make(map[string]bool),
+	}
+}
+
+// collectBuildContext records a "name=value" named build context.
+// oci-layout:// values become tasks; other values are only recorded so that
+// Dockerfile references overridden by the context are not resolved against a registry.
+func (c *taskCollector) collectBuildContext(spec string) error {
+	name, value, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || value == "" {
+		return fmt.Errorf("invalid build context %q: expected name=value", spec)
+	}
+	c.namedContexts[contextKey(name)] = true
+
+	if !ocilayout.IsOCILayout(value) {
+		return nil
+	}
+	ref, err := ocilayout.ParseRef(value)
+	if err != nil {
+		return fmt.Errorf("invalid build context %s: %w", name, err)
+	}
+	source, err := ocilayout.SourceName(name)
+	if err != nil {
+		return fmt.Errorf("invalid build context %s: %w", name, err)
+	}
+	if c.seenOCI[source] {
+		return nil
+	}
+	c.seenOCI[source] = true
+	c.ociTasks = append(c.ociTasks, ociLayoutTask{index: c.orderIndex, ref: ref, source: source})
+	c.orderIndex++
+	return nil
+}
+
+// contextKey normalizes a named context the way BuildKit looks it up:
+// the familiar image name without a ":latest" suffix (docker.io/library/base:latest -> base).
+// Names that are not image references are kept as given.
+func contextKey(name string) string {
+	named, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return name
+	}
+	return strings.TrimSuffix(reference.FamiliarString(named), ":latest")
+}
+
+// isNamedContext reports whether an image reference is overridden by a named build context.
+func (c *taskCollector) isNamedContext(ref dockerfile.ImageRef) bool {
+	if len(c.namedContexts) == 0 {
+		return false
 	}
+	return c.namedContexts[contextKey(ref.Ref.String())]
 }
 
 func (c *taskCollector) collect(ctx context.Context, dockerfilePath string) error {
@@ -115,11 +232,22 @@ func (c *taskCollector) collect(ctx context.Context, dockerfilePath string) erro
 		if _, ok := ref.Ref.(reference.Digested); ok {
 			continue
 		}
+		if c.isNamedContext(ref) {
+			continue
+		}
+
+		// Different spellings (alpine:3.18, docker.io/library/alpine:3.18) share one resolution
+		key := reference.TagNameOnly(ref.Ref).String()
+		if i, ok := c.imageByName[key]; ok {
+			c.imageTasks[i].aliases = append(c.imageTasks[i].aliases, ref.Original)
+			continue
+		}
+		c.imageByName[key] = len(c.imageTasks)
 
 		c.imageTasks = append(c.imageTasks, imageTask{
-			index:    c.orderIndex,
-			original: ref.Original,
-			ref:      ref.Ref,
+			index:   c.orderIndex,
+			aliases: []string{ref.Original},
+			ref:     ref.Ref,
 		})
 		c.orderIndex++
 	}
@@ -129,7 +257,11 @@ func (c *taskCollector) collect(ctx context.Context, dockerfilePath string) erro
 			continue
 		}
 		c.seenHTTP[httpRef.URL] = true
-		c.httpTasks = append(c.httpTasks, httpTask{index: c.orderIndex, url: httpRef.URL})
+		c.httpTasks = append(c.httpTasks, httpTask{
+			index: c.orderIndex,
+			url:   httpRef.URL,
+			at:    newPosition(dockerfilePath, httpRef.Line),
+		})
 		c.orderIndex++
 	}
 
@@ -138,15 +270,44 @@ func (c *taskCollector) collect(ctx context.Context, dockerfilePath string) erro
 			continue
 		}
 		c.seenGit[gitRef.URL] = true
-		c.gitTasks = append(c.gitTasks, gitTask{index: c.orderIndex, url: gitRef.URL})
+		c.gitTasks = append(c.gitTasks, gitTask{
+			index: c.orderIndex,
+			url:   gitRef.URL,
+			at:    newPosition(dockerfilePath, gitRef.Line),
+		})
 		c.orderIndex++
 	}
 
 	return nil
 }
 
+// position is a line in a Dockerfile
+type position struct {
+	file string
+	line int
+}
+
+func newPosition(dockerfilePath string, line int) position {
+	if dockerfilePath == "-" {
+		dockerfilePath = "<stdin>"
+	}
+	return position{file: dockerfilePath, line: line}
+}
+
+// String formats the position as path:line
+func (p position) String() string {
+	return fmt.Sprintf("%s:%d", p.file, p.line)
+}
+
+// warning is a warning recorded for the report, with what it is about so that the report can be ordered
+type warning struct {
+	at      position
+	source  string
+	message string
+}
+
 func (c *taskCollector) isEmpty() bool {
-	return len(c.imageTasks) == 0 && len(c.httpTasks) == 0 && len(c.gitTasks) == 0
+	return len(c.imageTasks) == 0 && len(c.httpTasks) == 0 && len(c.gitTasks) == 0 && len(c.ociTasks) == 0
 }
 
 // resultCollector safely collects results from concurrent operations
@@ -154,6 +315,8 @@ type resultCollector struct {
 	pinResults  []pinResult
 	httpResults []httpResult
 	gitResults  []gitResult
+	ociResults  []ociLayoutResult
+	warnings    []warning
 	mu          sync.Mutex
 }
 
@@ -175,31 +338,94 @@ func (r *resultCollector) addGit(result gitResult) {
 	r.gitResults = append(r.gitResults, result)
 }
 
-func (r *resultCollector) buildPolicy() *policy.Policy {
-	// Sort results by original Dockerfile order
+func (r *resultCollector) addOCILayout(result ociLayoutResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ociResults = append(r.ociResults, result)
+}
+
+// warn logs a warning about the source first used at the given position and records it for the report
+func (r *resultCollector) warn(at position, source, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("Warning: %s", msg)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, warning{at: at, source: source, message: msg})
+}
+
+// sort orders results by original Dockerfile order
+func (r *resultCollector) sort() {
 	slices.SortFunc(r.pinResults, func(a, b pinResult) int { return cmp.Compare(a.index, b.index) })
 	slices.SortFunc(r.httpResults, func(a, b httpResult) int { return cmp.Compare(a.index, b.index) })
 	slices.SortFunc(r.gitResults, func(a, b gitResult) int { return cmp.Compare(a.index, b.index) })
+	slices.SortFunc(r.ociResults, func(a, b ociLayoutResult) int { return cmp.Compare(a.index, b.index) })
+	// Warnings are recorded as concurrent tasks finish; order them by where the source appears
+	slices.SortFunc(r.warnings, func(a, b warning) int {
+		return cmp.Or(
+			cmp.Compare(a.at.file, b.at.file),
+			cmp.Compare(a.at.line, b.at.line),
+			cmp.Compare(a.source, b.source),
+			cmp.Compare(a.message, b.message),
+		)
+	})
+}
+
+func (r *resultCollector) buildPolicy() *policy.Policy {
+	r.sort()
 
 	pol := policy.NewPolicy()
 
+	// One rule per distinct spelling, all pointing at the same pinned digest
 	for _, res := range r.pinResults {
-		policy.AddPinRule(pol, res.original, res.pinned)
+		for _, alias := range res.aliases {
+			policy.AddPinRule(pol, alias, res.pinned)
+		}
+	}
+	for _, res := range r.ociResults {
+		if res.pinned {
+			continue
+		}
+		policy.AddOCILayoutPinRule(pol, res.source, res.digest)
 	}
 	for _, res := range r.httpResults {
 		policy.AddHTTPChecksumRuleWithHeaders(pol, res.url, res.checksum, res.headers)
 	}
 	for _, res := range r.gitResults {
+		if archive, ok := git.ParseGitHubArchiveURL(res.archiveURL); ok {
+			policy.AddHTTPToGitRule(pol, res.archiveURL, archive.Remote, archive.Ref, res.checksum)
+			continue
+		}
 		policy.AddGitChecksumRule(pol, res.url, res.checksum)
 	}
 
 	return pol
 }
 
+// Result holds the generated policy along with a report describing how it was built
+type Result struct {
+	Policy *policy.Policy
+	Report *Report
+}
+
 // GeneratePolicy parses Dockerfiles and generates a source policy with pinned digests
 func GeneratePolicy(ctx context.Context, opts Options) (*policy.Policy, error) {
+	result, err := Generate(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.Policy, nil
+}
+
+// Generate parses Dockerfiles and generates a source policy with pinned digests and a report
+func Generate(ctx context.Context, opts Options) (*Result, error) {
 	// Phase 1: Parse all Dockerfiles and collect unique sources
 	collector := newTaskCollector()
+	// Build contexts first: they determine which Dockerfile references are overridden
+	for _, spec := range opts.BuildContexts {
+		if err := collector.collectBuildContext(spec); err != nil {
+			return nil, err
+		}
+	}
 	for _, dockerfilePath := range opts.Dockerfiles {
 		if err := collector.collect(ctx, dockerfilePath); err != nil {
 			return nil, err
@@ -207,10 +433,33 @@ func GeneratePolicy(ctx context.Context, opts Options) (*policy.Policy, error) {
 	}
 
 	if collector.isEmpty() {
-		return policy.NewPolicy(), nil
+		return &Result{Policy: policy.NewPolicy(), Report: &Report{}}, nil
+	}
+
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	nw, err := network.New(cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = nw.Close() }()
+	gitArgs, err := nw.GitArgs()
+	if err != nil {
+		return nil, err
 	}
 
-	registryClient := registry.NewClient()
+	registryOpts := []registry.Option{
+		registry.WithNetwork(nw),
+		registry.WithAuthFile(opts.AuthFile),
+		registry.WithCredentials(opts.RegistryCredentials...),
+		registry.WithMirrors(opts.RegistryMirrors),
+	}
+	if opts.DebugAuth {
+		registryOpts = append(registryOpts, registry.WithAuthDebug(log.Printf))
+	}
+	registryClient := registry.NewClient(registryOpts...)
 
 	// Phase 1.5: If DHI preference is enabled, verify authentication upfront
 	if opts.PreferDHI {
@@ -234,8 +483,26 @@ func GeneratePolicy(ctx context.Context, opts Options) (*policy.Policy, error) {
 	progress := newProgressContainer()
 	results := &resultCollector{}
 
-	baseHTTPClient := httpclient.NewClient()
-	gitClient := git.NewClient()
+	baseHTTPClient, err := newHTTPClient(cfg,
+		httpclient.WithMaxDownloadSize(opts.MaxDownloadSize),
+		httpclient.WithDownloadBudget(opts.DownloadBudget),
+		httpclient.WithTimeout(opts.HTTPTimeout),
+		httpclient.WithTransport(nw.Transport()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	gitBackend, err := git.ParseBackend(opts.GitBackend)
+	if err != nil {
+		return nil, err
+	}
+	gitClient := git.NewClient(
+		git.WithBackend(gitBackend),
+		git.WithTimeout(opts.GitTimeout),
+		git.WithTransport(nw.Transport()),
+		git.WithGitArgs(gitArgs...),
+	)
+	defer func() { _ = gitClient.Close() }()
 
 	g, ctx := errgroup.WithContext(ctx)
 
@@ -246,12 +513,28 @@ func GeneratePolicy(ctx context.Context, opts Options) (*policy.Policy, error) {
 		))
 	}
 
+	for _, task := range collector.ociTasks {
+		g.Go(processOCILayout(task, progress, results))
+	}
+
 	for _, task := range collector.httpTasks {
+		// GitHub generates archives on the fly; their bytes have changed before while the commit cannot
+		if archive, ok := git.ParseGitHubArchiveURL(task.url); ok {
+			if opts.ArchiveAsGit {
+				gitTask := gitTask{index: task.index, url: archive.URL(), at: task.at, archiveURL: task.url}
+				results.warn(task.at, task.url, "%s is converted to %s: the build gets the repository tree instead of the "+
+					"archive file, so the instructions that unpack it need to change", task.url, archive.URL())
+				g.Go(processGit(ctx, gitTask, gitClient, progress, results, cfg, opts.VerifyGitSignatures))
+				continue
+			}
+			results.warn(task.at, task.url, "%s is a GitHub archive generated on the fly, whose checksum has changed before; "+
+				"consider ADD %s or --archive-as-git", task.url, archive.URL())
+		}
 		g.Go(processHTTP(ctx, task, baseHTTPClient, progress, results))
 	}
 
 	for _, task := range collector.gitTasks {
-		g.Go(processGit(ctx, task, gitClient, progress, results))
+		g.Go(processGit(ctx, task, gitClient, progress, results, cfg, opts.VerifyGitSignatures))
 	}
 
 	if err := g.Wait(); err != nil {
@@ -261,7 +544,10 @@ func GeneratePolicy(ctx context.Context, opts Options) (*policy.Policy, error) {
 
 	progress.Wait()
 
-	return results.buildPolicy(), nil
+	return &Result{
+		Policy: results.buildPolicy(),
+		Report: results.buildReport(),
+	}, nil
 }
 
 func newProgressContainer() *mpb.Progress {
@@ -291,7 +577,7 @@ func processImage(
 	preferMCR bool,
 ) func() error {
 	return func() error {
-		name := truncateLeft(task.original, 40)
+		name := truncateLeft(task.aliases[0], 40)
 		bar := progress.AddSpinner(
 			0,
 			mpb.PrependDecorators(
@@ -320,7 +606,7 @@ func processImage(
 			)
 			if err != nil {
 				bar.Abort(true)
-				return fmt.Errorf("failed to resolve DHI image for %s: %w", task.original, err)
+				return fmt.Errorf("failed to resolve DHI image for %s: %w", task.aliases[0], err)
 			}
 		}
 
@@ -336,7 +622,7 @@ func processImage(
 			)
 			if err != nil {
 				bar.Abort(true)
-				return fmt.Errorf("failed to resolve ECR Public image for %s: %w", task.original, err)
+				return fmt.Errorf("failed to resolve ECR Public image for %s: %w", task.aliases[0], err)
 			}
 		}
 
@@ -352,7 +638,7 @@ func processImage(
 			)
 			if err != nil {
 				bar.Abort(true)
-				return fmt.Errorf("failed to resolve MCR image for %s: %w", task.original, err)
+				return fmt.Errorf("failed to resolve MCR image for %s: %w", task.aliases[0], err)
 			}
 		}
 
@@ -361,7 +647,7 @@ func processImage(
 			digestStr, err = client.GetDigest(ctx, task.ref)
 			if err != nil {
 				bar.Abort(true)
-				return fmt.Errorf("failed to get digest for %s: %w", task.original, err)
+				return fmt.Errorf("failed to get digest for %s: %w", task.aliases[0], err)
 			}
 			pinnedRef = task.ref
 		}
@@ -375,13 +661,14 @@ func processImage(
 		pinnedRefWithDigest, err := reference.WithDigest(pinnedRef, d)
 		if err != nil {
 			bar.Abort(true)
-			return fmt.Errorf("failed to create pinned reference for %s: %w", task.original, err)
+			return fmt.Errorf("failed to create pinned reference for %s: %w", task.aliases[0], err)
 		}
 
 		results.addPin(pinResult{
-			index:    task.index,
-			original: task.original,
-			pinned:   pinnedRefWithDigest.String(),
+			index:   task.index,
+			ref:     reference.TagNameOnly(task.ref).String(),
+			aliases: task.aliases,
+			pinned:  pinnedRefWithDigest.String(),
 		})
 
 		return nil
@@ -389,8 +676,9 @@ func processImage(
 }
 
 // tryPreferredRegistry attempts to resolve an image via a preferred registry mapper.
-// Returns (mappedRef, digest, nil) on success, or (nil, "", nil) to signal fallback.
-// Only returns a non-nil error on unexpected failures.
+// Returns (mappedRef, digest, nil) on success, or (nil, "", nil) to signal fallback when the image
+// does not exist there or access is refused. Any other failure, rate limiting in particular, is an error:
+// falling back would silently pin a different image.
 func tryPreferredRegistry(
 	ctx context.Context,
 	ref reference.Named,
@@ -416,12 +704,111 @@ func tryPreferredRegistry(
 	if err == nil {
 		return mapped, digestStr, nil
 	}
-	if registry.IsNotFoundOrAuthError(err) {
+	if errors.Is(err, registry.ErrNotFound) || errors.Is(err, registry.ErrUnauthorized) {
 		return nil, "", nil
 	}
 	return nil, "", fmt.Errorf("failed to check image %s: %w", mapped.String(), err)
 }
 
+func processOCILayout(
+	task ociLayoutTask,
+	progress *mpb.Progress,
+	results *resultCollector,
+) func() error {
+	return func() error {
+		name := truncateLeft(task.ref.Original, 40)
+		bar := progress.AddSpinner(
+			0,
+			mpb.PrependDecorators(
+				decor.Name("🗃 ", decor.WC{C: decor.DindentRight}),
+				decor.Name(name, decor.WCSyncSpaceR),
+			),
+			mpb.AppendDecorators(
+				decor.OnComplete(decor.Name("resolving..."), "✓"),
+			),
+		)
+		defer bar.SetTotal(0, true)
+
+		d, err := ocilayout.ResolveDigest(task.ref)
+		if err != nil {
+			bar.Abort(true)
+			return fmt.Errorf("failed to resolve %s%s: %w", ocilayout.Scheme, task.ref.Original, err)
+		}
+
+		results.addOCILayout(ociLayoutResult{
+			index:    task.index,
+			original: task.ref.Original,
+			source:   task.source,
+			digest:   d.String(),
+			pinned:   task.ref.IsPinned(),
+		})
+
+		return nil
+	}
+}
+
+// newHTTPClient creates the checksum client with the per-host settings from the config file, followed by extra.
+// Credentials come from the netrc file, overridden by the ones in the config file.
+func newHTTPClient(cfg *config.Config, extra ...httpclient.Option) (*httpclient.Client, error) {
+	var sidecars []httpclient.SidecarConfig
+	var registries []httpclient.RegistryHost
+	var credentials []httpclient.Credential
+	var githubHosts []httpclient.GitHubHost
+	var gitlabHosts []httpclient.GitLabHost
+
+	if netrcPath := httpclient.DefaultNetrcPath(); netrcPath != "" {
+		netrc, err := httpclient.LoadNetrc(netrcPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read %s: %w", netrcPath, err)
+		}
+		credentials = append(credentials, netrc...)
+	}
+
+	for _, host := range cfg.HTTP.Hosts {
+		if host.Sidecars {
+			sidecars = append(sidecars, httpclient.SidecarConfig{Host: host.Host, Keyring: host.SidecarKeyring})
+		}
+		if host.Registry != "" {
+			registries = append(registries, httpclient.RegistryHost{
+				Host:        host.Host,
+				Kind:        host.Registry,
+				MetadataURL: host.RegistryURL,
+			})
+		}
+		if host.GitHub {
+			githubHosts = append(githubHosts, httpclient.GitHubHost{Host: host.Host, APIURL: host.GitHubAPIURL})
+		}
+		if host.GitLab {
+			gitlabHosts = append(gitlabHosts, httpclient.GitLabHost{Host: host.Host, APIURL: host.GitLabAPIURL})
+		}
+		token, username, password, err := host.Credentials()
+		if err != nil {
+			return nil, err
+		}
+		if token != "" || username != "" {
+			credentials = append(credentials, httpclient.Credential{
+				Host:     host.Host,
+				Username: username,
+				Password: password,
+				Token:    token,
+			})
+		}
+	}
+	opts := []httpclient.Option{
+		httpclient.WithSidecars(sidecars...),
+		httpclient.WithRegistryHosts(registries...),
+		httpclient.WithCredentials(credentials...),
+		httpclient.WithGitHubHosts(githubHosts...),
+		httpclient.WithGitLabHosts(gitlabHosts...),
+		httpclient.WithRedirectPolicy(httpclient.RedirectPolicy{
+			MaxRedirects: cfg.HTTP.MaxRedirects,
+			SameHostOnly: cfg.HTTP.SameHostRedirects,
+			AllowedHosts: cfg.HTTP.RedirectHosts,
+		}),
+	}
+	return httpclient.NewClient(append(opts, extra...)...), nil
+}
+
 func processHTTP(
 	ctx context.Context,
 	task httpTask,
@@ -466,11 +853,16 @@ func processHTTP(
 		if err != nil {
 			bar.Abort(true)
 			if httpclient.IsAuthError(err) {
-				log.Printf("Warning: Skipping %s (authentication required)", task.url)
+				results.warn(task.at, task.url,
+					"Skipping %s (authentication required; add credentials to ~/.netrc or the config file)", task.url)
 				return nil
 			}
 			if httpclient.IsVolatileContentError(err) {
-				log.Printf("Warning: Skipping %s (%s)", task.url, err.Error())
+				results.warn(task.at, task.url, "Skipping %s (%s)", task.url, err.Error())
+				return nil
+			}
+			if httpclient.IsDownloadLimitError(err) {
+				results.warn(task.at, task.url, "Skipping %s (%s; pin it with ADD --checksum)", task.url, err.Error())
 				return nil
 			}
 			return fmt.Errorf("failed to get checksum for %s: %w", task.url, err)
@@ -478,11 +870,26 @@ func processHTTP(
 
 		bar.SetTotal(bar.Current(), true)
 
+		if result.StableURL != "" {
+			results.warn(task.at, task.url,
+				"%s may change: %s; use %s instead", task.url, result.MutableReason, result.StableURL)
+		} else if result.MutableReason != "" {
+			results.warn(task.at, task.url, "%s may change: %s", task.url, result.MutableReason)
+		}
+		if result.AuthRequired {
+			// Credentials are deliberately kept out of the policy
+			results.warn(task.at, task.url,
+				"%s required authentication; BuildKit needs credentials for it at build time", task.url)
+		}
+
 		results.addHTTP(httpResult{
-			index:    task.index,
-			url:      task.url,
-			checksum: result.Checksum,
-			headers:  result.Headers,
+			index:        task.index,
+			url:          task.url,
+			checksum:     result.Checksum,
+			headers:      result.Headers,
+			authRequired: result.AuthRequired,
+			redirects:    result.Redirects,
+			stableURL:    result.StableURL,
 		})
 
 		return nil
@@ -495,6 +902,8 @@ func processGit(
 	client *git.Client,
 	progress *mpb.Progress,
 	results *resultCollector,
+	cfg *config.Config,
+	verifySignatures bool,
 ) func() error {
 	return func() error {
 		name := truncateLeft(task.url, 40)
@@ -510,16 +919,51 @@ func processGit(
 		)
 		defer bar.SetTotal(0, true)
 
-		checksum, err := client.GetCommitChecksum(ctx, task.url)
+		resolved, err := client.ResolveRef(ctx, task.url)
 		if err != nil {
 			bar.Abort(true)
 			return fmt.Errorf("failed to get commit checksum for %s: %w", task.url, err)
 		}
+		if resolved.Kind == git.RefKindBranch {
+			results.warn(task.at, task.url,
+				"%s is pinned from branch %s, which moves as commits are pushed; consider a tag or commit", task.url, resolved.Ref)
+		}
+
+		// A typo in #ref:subdir would otherwise only surface halfway through the build
+		if err := client.CheckSubdir(ctx, task.url, resolved); err != nil {
+			if git.IsSubdirError(err) {
+				bar.Abort(true)
+				return fmt.Errorf("%s: ADD %s: %w", task.at, task.url, err)
+			}
+			results.warn(task.at, task.url, "%s: %v", task.url, err)
+		}
+
+		var signature *git.Signature
+		if verifySignatures {
+			trust, onFailure := git.TrustRoot{}, config.OnFailureError
+			if remote := cfg.Git.Remote(resolved.Remote); remote != nil {
+				trust = git.TrustRoot{Keyring: remote.Keyring, AllowedSigners: remote.AllowedSigners}
+				onFailure = remote.OnFailure
+			}
+			signature, err = client.VerifySignature(ctx, task.url, resolved, trust)
+			switch {
+			case err == nil:
+			case git.IsSignatureError(err) && onFailure == config.OnFailureWarn:
+				results.warn(task.at, task.url, "%v (pinning anyway)", err)
+			default:
+				bar.Abort(true)
+				return fmt.Errorf("refusing to pin %s: %w", task.url, err)
+			}
+		}
 
 		results.addGit(gitResult{
-			index:    task.index,
-			url:      task.url,
-			checksum: checksum,
+			index:      task.index,
+			url:        task.url,
+			checksum:   resolved.Commit,
+			ref:        resolved.Ref,
+			kind:       resolved.Kind,
+			signature:  signature,
+			archiveURL: task.archiveURL,
 		})
 
 		return nil
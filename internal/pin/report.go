@@ -0,0 +1,121 @@
+package pin
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/wharflab/container-source-policy/internal/git"
+)
+
+// Report describes how each source in the policy was pinned.
+// It is meant for human review and CI logs; BuildKit only consumes the policy.
+type Report struct {
+	Images     []ImageReport  `json:"images,omitempty"`
+	OCILayouts []SourceReport `json:"ociLayouts,omitempty"`
+	HTTP       []SourceReport `json:"http,omitempty"`
+	Git        []GitReport    `json:"git,omitempty"`
+	Warnings   []string       `json:"warnings,omitempty"`
+}
+
+// ImageReport describes a pinned container image.
+// Aliases groups every spelling of the image found in the Dockerfiles; each one
+// gets its own policy rule, but all of them resolve to the same Pinned reference.
+type ImageReport struct {
+	// Reference is the normalized image reference (e.g., docker.io/library/alpine:3.18)
+	Reference string `json:"reference"`
+	// Aliases are the spellings as written in the Dockerfiles (e.g., alpine:3.18)
+	Aliases []string `json:"aliases"`
+	// Pinned is the reference the policy converts to, including the digest
+	Pinned string `json:"pinned"`
+}
+
+// SourceReport describes a pinned non-image source
+type SourceReport struct {
+	// Source is the selector as written (URL or oci-layout path)
+	Source string `json:"source"`
+	// Pinned is the checksum, commit SHA, or pinned identifier
+	Pinned string `json:"pinned"`
+	// AuthRequired is set for HTTP sources that were only reachable with credentials
+	AuthRequired bool `json:"authRequired,omitempty"`
+	// Redirects are the locations an HTTP source redirected to, in order
+	Redirects []string `json:"redirects,omitempty"`
+	// StableURL is suggested for HTTP sources that point at a moving target (e.g., a "latest" URL)
+	StableURL string `json:"stableURL,omitempty"`
+	// AlreadyPinned is set for oci-layout contexts written with a digest; they need no policy rule
+	AlreadyPinned bool `json:"alreadyPinned,omitempty"`
+}
+
+// GitReport describes a pinned git source and the kind of ref it was resolved from
+type GitReport struct {
+	// Source is the git URL as written
+	Source string `json:"source"`
+	// Ref is the full ref name the URL resolved to (e.g., refs/tags/v1.0.0)
+	Ref string `json:"ref"`
+	// Kind is branch, lightweight-tag, annotated-tag, commit, or other
+	Kind git.RefKind `json:"kind"`
+	// Pinned is the commit SHA
+	Pinned string `json:"pinned"`
+	// Signature is the verified tag or commit signature (with --verify-git-signatures)
+	Signature *SignatureReport `json:"signature,omitempty"`
+	// Archive is the GitHub archive URL written in the Dockerfile that was converted to this source (with --archive-as-git)
+	Archive string `json:"archive,omitempty"`
+}
+
+// SignatureReport describes a verified git signature
+type SignatureReport struct {
+	// Object is the signed object: tag or commit
+	Object string `json:"object"`
+	// SHA is the signed object's SHA
+	SHA string `json:"sha"`
+	// Format is openpgp or ssh
+	Format string `json:"format"`
+	// Signer is the OpenPGP key ID or the ssh principal from the allowed signers file
+	Signer string `json:"signer"`
+}
+
+func (r *resultCollector) buildReport() *Report {
+	r.sort()
+
+	report := &Report{}
+	for _, w := range r.warnings {
+		report.Warnings = append(report.Warnings, w.message)
+	}
+	for _, res := range r.pinResults {
+		report.Images = append(report.Images, ImageReport{
+			Reference: res.ref,
+			Aliases:   res.aliases,
+			Pinned:    res.pinned,
+		})
+	}
+	for _, res := range r.ociResults {
+		report.OCILayouts = append(report.OCILayouts, SourceReport{
+			Source:        res.original,
+			Pinned:        res.source + "@" + res.digest,
+			AlreadyPinned: res.pinned,
+		})
+	}
+	for _, res := range r.httpResults {
+		report.HTTP = append(report.HTTP, SourceReport{
+			Source:       res.url,
+			Pinned:       res.checksum,
+			AuthRequired: res.authRequired,
+			Redirects:    res.redirects,
+			StableURL:    res.stableURL,
+		})
+	}
+	for _, res := range r.gitResults {
+		entry := GitReport{Source: res.url, Ref: res.ref, Kind: res.kind, Pinned: res.checksum, Archive: res.archiveURL}
+		if sig := res.signature; sig != nil {
+			entry.Signature = &SignatureReport{Object: sig.Object, SHA: sig.SHA, Format: sig.Format, Signer: sig.Signer}
+		}
+		report.Git = append(report.Git, entry)
+	}
+	return report
+}
+
+// WriteReport writes a report to the given writer as JSON
+func WriteReport(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"path"
 
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/sourcepolicy"
@@ -63,6 +65,23 @@ func AddPinRule(p *Policy, originalRef, pinnedRef string) {
 	p.Rules = append(p.Rules, rule)
 }
 
+// AddOCILayoutPinRule adds a rule that pins the source of an oci-layout named context to a specific digest.
+// name is the source name without the oci-layout:// scheme (e.g., "docker.io/library/base"). buildx always sends
+// the digest it read from the layout, so the selector matches any digest and converts it to the pinned one.
+func AddOCILayoutPinRule(p *Policy, name, dgst string) {
+	rule := &Rule{
+		Action: PolicyActionConvert,
+		Selector: &Selector{
+			Identifier: "oci-layout://" + name + "@*",
+			MatchType:  MatchTypeWildcard,
+		},
+		Updates: &Update{
+			Identifier: "oci-layout://" + name + "@" + dgst,
+		},
+	}
+	p.Rules = append(p.Rules, rule)
+}
+
 // AddHTTPChecksumRule adds a rule that pins an HTTP/HTTPS source to a specific checksum
 // The checksum should be in the format "sha256:..." or similar digest format
 func AddHTTPChecksumRule(p *Policy, url, checksum string) {
@@ -124,6 +143,33 @@ func AddGitChecksumRule(p *Policy, gitURL, checksum string) {
 	p.Rules = append(p.Rules, rule)
 }
 
+// AddHTTPToGitRule adds a rule that converts an HTTP source to a git source pinned to a commit.
+// The build output changes shape: ADD receives a checked-out tree instead of the downloaded file.
+// remote is the repository URL (e.g., https://github.com/owner/repo.git) and ref the tag, branch or commit;
+// the git identifier is built the way BuildKit's LLB does (git://<host>/<path>#<ref>, with the remote in git.fullurl).
+func AddHTTPToGitRule(p *Policy, httpURL, remote, ref, checksum string) {
+	// Like LLB, fall back to the full URL when it cannot be parsed (the git operation then fails)
+	id := remote
+	if u, err := url.Parse(remote); err == nil {
+		id = u.Host + path.Join("/", u.Path)
+	}
+	rule := &Rule{
+		Action: PolicyActionConvert,
+		Selector: &Selector{
+			Identifier: httpURL,
+			MatchType:  MatchTypeExact,
+		},
+		Updates: &Update{
+			Identifier: "git://" + id + "#" + ref,
+			Attrs: map[string]string{
+				"git.fullurl":  remote,
+				"git.checksum": checksum,
+			},
+		},
+	}
+	p.Rules = append(p.Rules, rule)
+}
+
 // Validate checks that the policy is valid by performing a JSON round-trip
 // through the BuildKit sourcepolicy/pb types. This is the same validation
 // that BuildKit performs when loading a policy file via json.Unmarshal.
@@ -0,0 +1,292 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	"github.com/containers/image/v5/types"
+	helperclient "github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// dockerHubServer is the key Docker uses for Docker Hub in config.json and with credential helpers
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// Credential is a username and password for one registry, as given with --creds
+type Credential struct {
+	Registry string
+	Username string
+	Password string
+}
+
+// ParseCredential parses a --creds value: registry=username:password
+func ParseCredential(s string) (Credential, error) {
+	registry, userpass, ok := strings.Cut(s, "=")
+	username, password, hasPassword := strings.Cut(userpass, ":")
+	if !ok || registry == "" || username == "" || !hasPassword {
+		// Never echo the value: it holds a password
+		return Credential{}, errors.New("invalid --creds value: expected registry=username:password")
+	}
+	return Credential{Registry: registry, Username: username, Password: password}, nil
+}
+
+// WithAuthFile reads credentials from path (as podman --authfile) instead of the default auth files
+func WithAuthFile(path string) Option {
+	return func(c *Client) {
+		c.authFile = path
+	}
+}
+
+// WithCredentials sets the credentials of registries, taking precedence over every auth file
+func WithCredentials(creds ...Credential) Option {
+	return func(c *Client) {
+		for _, cred := range creds {
+			c.creds[normalizeRegistry(cred.Registry)] = cred
+		}
+	}
+}
+
+// WithAuthDebug reports through logf where the credentials of each registry come from (never the secrets)
+func WithAuthDebug(logf func(format string, args ...any)) Option {
+	return func(c *Client) {
+		c.authDebug = logf
+	}
+}
+
+// registryAuth is the credential lookup result for a repository
+type registryAuth struct {
+	once   sync.Once
+	config *types.DockerAuthConfig // empty for anonymous access
+	source string                  // where config came from, for messages
+	err    error
+}
+
+// auth returns the credentials for a repository (registry host and path, as quay.io/org/app) and where
+// they came from, looking them up once per repository since auth files can hold namespaced entries
+func (c *Client) auth(repository string) (*types.DockerAuthConfig, string, error) {
+	host, path, _ := strings.Cut(repository, "/")
+	repository = normalizeRegistry(host)
+	if path != "" {
+		repository += "/" + path
+	}
+
+	c.authMu.Lock()
+	entry, ok := c.auths[repository]
+	if !ok {
+		entry = &registryAuth{}
+		c.auths[repository] = entry
+	}
+	c.authMu.Unlock()
+
+	entry.once.Do(func() {
+		entry.config, entry.source, entry.err = c.lookupAuth(repository)
+		if c.authDebug == nil {
+			return
+		}
+		if entry.err != nil {
+			c.authDebug("auth: %s: %v", repository, entry.err)
+		} else {
+			c.authDebug("auth: %s: %s", repository, entry.source)
+		}
+	})
+	return entry.config, entry.source, entry.err
+}
+
+// lookupAuth finds the credentials of a normalized repository: --creds for its registry first, then the
+// credential-helpers of registries.conf in order, where the default containers-auth.json stands for the auth files
+func (c *Client) lookupAuth(repository string) (*types.DockerAuthConfig, string, error) {
+	registry, _, _ := strings.Cut(repository, "/")
+	if cred, ok := c.creds[registry]; ok {
+		return &types.DockerAuthConfig{Username: cred.Username, Password: cred.Password}, "--creds", nil
+	}
+	helpers, err := sysregistriesv2.CredentialHelpers(c.sysCtx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read credential helpers from registries configuration: %w", err)
+	}
+	for _, helper := range helpers {
+		if helper != sysregistriesv2.AuthenticationFileHelper {
+			// As in Podman, these helpers are asked for the registry name itself
+			source := fmt.Sprintf("credential helper %s (credential-helpers in registries.conf)", helper)
+			config, source, err := authFromHelper(helper, registry, registry, source)
+			if err != nil || config != nil {
+				return config, source, err
+			}
+			continue
+		}
+		for _, path := range c.authFiles() {
+			config, source, err := authFromFile(path, repository)
+			if err != nil || config != nil {
+				return config, source, err
+			}
+		}
+	}
+	return &types.DockerAuthConfig{}, "no credentials (anonymous)", nil
+}
+
+// authFiles returns the auth files searched, in order: the --authfile or REGISTRY_AUTH_FILE file alone,
+// or else the containers auth.json files followed by Docker's config.json
+func (c *Client) authFiles() []string {
+	if c.authFile != "" {
+		return []string{c.authFile}
+	}
+	if path := os.Getenv("REGISTRY_AUTH_FILE"); path != "" {
+		return []string{path}
+	}
+
+	var paths []string
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		paths = append(paths, filepath.Join(runtimeDir, "containers", "auth.json"))
+	}
+	home, _ := os.UserHomeDir()
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" && home != "" {
+		configHome = filepath.Join(home, ".config")
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, "containers", "auth.json"))
+	}
+	if dockerConfig := os.Getenv("DOCKER_CONFIG"); dockerConfig != "" {
+		paths = append(paths, filepath.Join(dockerConfig, "config.json"))
+	} else if home != "" {
+		paths = append(paths, filepath.Join(home, ".docker", "config.json"))
+	}
+	return paths
+}
+
+// authFile is the part of auth.json and Docker's config.json read for credentials
+type authFile struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredHelpers map[string]string `json:"credHelpers"`
+	CredsStore  string            `json:"credsStore"`
+}
+
+// authFromFile looks up a repository in an auth file, following Docker's order: a credHelpers entry
+// for its registry, then an auths entry with credentials, then credsStore.
+// It returns nil when the file has nothing for the repository.
+func authFromFile(path, repository string) (*types.DockerAuthConfig, string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	var file authFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, "", fmt.Errorf("failed to parse auth file %s: %w", path, err)
+	}
+
+	registry, _, _ := strings.Cut(repository, "/")
+	// Helpers hold credentials per registry, never per namespace
+	if keys := authKeys(file.CredHelpers, registry); len(keys) > 0 {
+		helper := file.CredHelpers[keys[0]]
+		return authFromHelper(helper, registry, dockerServer(registry), fmt.Sprintf("credential helper %s (credHelpers in %s)", helper, path))
+	}
+	for _, key := range authKeys(file.Auths, repository) {
+		entry := file.Auths[key]
+		if entry.IdentityToken != "" {
+			return &types.DockerAuthConfig{IdentityToken: entry.IdentityToken}, "identity token in " + path, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid auth entry for %s in %s: %w", key, path, err)
+		}
+		// Docker writes empty entries for registries whose credentials are in a helper
+		if username, password, ok := strings.Cut(string(decoded), ":"); ok {
+			return &types.DockerAuthConfig{Username: username, Password: password}, fmt.Sprintf("auths %s in %s", key, path), nil
+		}
+	}
+	if helper := file.CredsStore; helper != "" {
+		return authFromHelper(helper, registry, dockerServer(registry), fmt.Sprintf("credential helper %s (credsStore in %s)", helper, path))
+	}
+	return nil, "", nil
+}
+
+// authKeys returns the keys of an auth file section that apply to a normalized repository, best match first,
+// as containers/image does: the repository and each parent namespace up to the registry exactly as written,
+// then the keys naming the registry in another form (https://index.docker.io/v1/ for docker.io), sorted
+func authKeys[V any](entries map[string]V, repository string) []string {
+	var keys []string
+	for name := repository; ; {
+		if _, ok := entries[name]; ok {
+			keys = append(keys, name)
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+
+	registry, _, _ := strings.Cut(repository, "/")
+	var aliases []string
+	for key := range entries {
+		if key != registry && authKeyRegistry(key) == registry {
+			aliases = append(aliases, key)
+		}
+	}
+	slices.Sort(aliases)
+	return append(keys, aliases...)
+}
+
+// authKeyRegistry returns the registry an auth file key stands for, or "" for a namespaced key.
+// URL keys (https://ghcr.io, https://index.docker.io/v1/) drop their path; others keep it.
+func authKeyRegistry(key string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	if host != key {
+		host, _, _ = strings.Cut(host, "/")
+	}
+	if strings.Contains(host, "/") {
+		return ""
+	}
+	return normalizeRegistry(host)
+}
+
+// dockerServer returns the server name Docker keeps the credentials of registry under in credential helpers
+func dockerServer(registry string) string {
+	if registry == "docker.io" {
+		return dockerHubServer
+	}
+	return registry
+}
+
+// authFromHelper asks docker-credential-<helper> for the credentials of registry, stored under server;
+// nil means the helper has none
+func authFromHelper(helper, registry, server, source string) (*types.DockerAuthConfig, string, error) {
+	creds, err := helperclient.Get(helperclient.NewShellProgramFunc("docker-credential-"+helper), server)
+	if credentials.IsErrCredentialsNotFound(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("credential helper %s failed for %s: %w", helper, registry, err)
+	}
+	// Helpers return identity tokens with this placeholder username
+	if creds.Username == "<token>" {
+		return &types.DockerAuthConfig{IdentityToken: creds.Secret}, source, nil
+	}
+	return &types.DockerAuthConfig{Username: creds.Username, Password: creds.Secret}, source, nil
+}
+
+// normalizeRegistry reduces an auth file key or registry name to the registry host
+// (https://index.docker.io/v1/ -> docker.io, https://ghcr.io -> ghcr.io)
+func normalizeRegistry(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	key, _, _ = strings.Cut(key, "/")
+	key = strings.ToLower(key)
+	switch key {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return key
+}
@@ -0,0 +1,266 @@
+package registry
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseCredential(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Credential
+		wantErr bool
+	}{
+		{value: "ghcr.io=ci:s3cr=t:x", want: Credential{Registry: "ghcr.io", Username: "ci", Password: "s3cr=t:x"}},
+		{value: "ci:secret", wantErr: true},
+		{value: "ghcr.io=ci", wantErr: true},
+		{value: "=ci:secret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseCredential(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCredential() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCredential() = %+v, want %+v", got, tt.want)
+			}
+			if err != nil && strings.Contains(err.Error(), "secret") {
+				t.Errorf("ParseCredential() error %q contains the password", err)
+			}
+		})
+	}
+}
+
+// writeAuthFile writes an auth file and returns its path
+func writeAuthFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "auth.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// installHelper puts a docker-credential-<name> script on PATH that returns username/secret for server
+func installHelper(t *testing.T, name, server, username, secret string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper scripts need a POSIX shell")
+	}
+	dir := t.TempDir()
+	script := fmt.Sprintf(`#!/bin/sh
+read server
+if [ "$server" = %q ]; then
+  echo '{"ServerURL":"%s","Username":"%s","Secret":"%s"}'
+else
+  echo "credentials not found in native keychain"
+  exit 1
+fi
+`, server, server, username, secret)
+	if err := os.WriteFile(filepath.Join(dir, "docker-credential-"+name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+func TestClientAuth(t *testing.T) {
+	installHelper(t, "test", "ghcr.io", "helper-user", "helper-secret")
+	installHelper(t, "store", "https://index.docker.io/v1/", "<token>", "hub-token")
+	authFile := writeAuthFile(t, fmt.Sprintf(`{
+  "auths": {
+    "https://index.docker.io/v1/": {},
+    "registry.internal:5000": {"auth": %q}
+  },
+  "credHelpers": {"ghcr.io": "test"},
+  "credsStore": "store"
+}`, basicAuth("file-user", "file-secret")))
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		repository   string
+		wantUser     string
+		wantPassword string
+		wantToken    string
+		wantSource   string
+	}{
+		{
+			name: "creds take precedence",
+			opts: []Option{
+				WithAuthFile(authFile),
+				WithCredentials(Credential{Registry: "GHCR.io", Username: "u", Password: "p"}),
+			},
+			repository:   "ghcr.io/org/app",
+			wantUser:     "u",
+			wantPassword: "p",
+			wantSource:   "--creds",
+		},
+		{
+			name:         "credHelpers entry",
+			opts:         []Option{WithAuthFile(authFile)},
+			repository:   "ghcr.io/org/app",
+			wantUser:     "helper-user",
+			wantPassword: "helper-secret",
+			wantSource:   "credential helper test (credHelpers in " + authFile + ")",
+		},
+		{
+			name:         "auths entry",
+			opts:         []Option{WithAuthFile(authFile)},
+			repository:   "registry.internal:5000/app",
+			wantUser:     "file-user",
+			wantPassword: "file-secret",
+			wantSource:   "auths registry.internal:5000 in " + authFile,
+		},
+		{
+			name:       "credsStore with an identity token",
+			opts:       []Option{WithAuthFile(authFile)},
+			repository: "docker.io/library/alpine",
+			wantToken:  "hub-token",
+			wantSource: "credential helper store (credsStore in " + authFile + ")",
+		},
+		{
+			name:       "not in the helper",
+			opts:       []Option{WithAuthFile(authFile)},
+			repository: "quay.io/org/app",
+			wantSource: "no credentials (anonymous)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logged strings.Builder
+			opts := append(tt.opts, WithAuthDebug(func(format string, args ...any) {
+				fmt.Fprintf(&logged, format+"\n", args...)
+			}))
+			config, source, err := NewClient(opts...).auth(tt.repository)
+			if err != nil {
+				t.Fatalf("auth() error = %v", err)
+			}
+			if config.Username != tt.wantUser || config.Password != tt.wantPassword || config.IdentityToken != tt.wantToken {
+				t.Errorf("auth() = %+v, want %s/%s token %q", config, tt.wantUser, tt.wantPassword, tt.wantToken)
+			}
+			if source != tt.wantSource {
+				t.Errorf("source = %q, want %q", source, tt.wantSource)
+			}
+			if !strings.Contains(logged.String(), tt.wantSource) {
+				t.Errorf("debug output %q does not name the source", logged.String())
+			}
+			for _, secret := range []string{"secret", "hub-token", ": p"} {
+				if strings.Contains(logged.String(), secret) {
+					t.Errorf("debug output %q contains a secret", logged.String())
+				}
+			}
+		})
+	}
+}
+
+func TestClientAuth_Keys(t *testing.T) {
+	authFile := writeAuthFile(t, fmt.Sprintf(`{
+  "auths": {
+    "quay.io/org-a": {"auth": %q},
+    "quay.io/org-b": {"auth": %q},
+    "quay.io": {"auth": %q},
+    "https://index.docker.io/v1/": {"auth": %q},
+    "docker.io": {"auth": %q},
+    "index.docker.io": {"auth": %q}
+  }
+}`, basicAuth("org-a", "pw"), basicAuth("org-b", "pw"), basicAuth("quay", "pw"),
+		basicAuth("hub-url", "pw"), basicAuth("hub", "pw"), basicAuth("hub-host", "pw")))
+
+	tests := []struct {
+		repository string
+		wantUser   string
+		wantSource string
+	}{
+		{repository: "quay.io/org-a/app", wantUser: "org-a", wantSource: "auths quay.io/org-a in " + authFile},
+		{repository: "quay.io/org-b/app", wantUser: "org-b", wantSource: "auths quay.io/org-b in " + authFile},
+		{repository: "quay.io/org-c/app", wantUser: "quay", wantSource: "auths quay.io in " + authFile},
+		// The exact key wins over the other spellings of Docker Hub, which are tried in sorted order
+		{repository: "docker.io/library/alpine", wantUser: "hub", wantSource: "auths docker.io in " + authFile},
+		{repository: "index.docker.io/library/alpine", wantUser: "hub", wantSource: "auths docker.io in " + authFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repository, func(t *testing.T) {
+			// Lookups must not depend on map iteration order
+			for range 10 {
+				config, source, err := NewClient(WithAuthFile(authFile)).auth(tt.repository)
+				if err != nil {
+					t.Fatalf("auth() error = %v", err)
+				}
+				if config.Username != tt.wantUser || source != tt.wantSource {
+					t.Fatalf("auth() = %s from %q, want %s from %q", config.Username, source, tt.wantUser, tt.wantSource)
+				}
+			}
+		})
+	}
+
+	// Without an exact key, the URL and host spellings of Docker Hub are tried in sorted order
+	authFile = writeAuthFile(t, fmt.Sprintf(`{"auths": {"index.docker.io": {"auth": %q}, "https://index.docker.io/v1/": {"auth": %q}}}`,
+		basicAuth("hub-host", "pw"), basicAuth("hub-url", "pw")))
+	for range 10 {
+		config, _, err := NewClient(WithAuthFile(authFile)).auth("docker.io/library/alpine")
+		if err != nil {
+			t.Fatalf("auth() error = %v", err)
+		}
+		if config.Username != "hub-url" {
+			t.Fatalf("auth() = %+v, want the https://index.docker.io/v1/ entry", config)
+		}
+	}
+}
+
+func TestClientAuth_RegistryAuthFile(t *testing.T) {
+	content := fmt.Sprintf(`{"auths": {"quay.io": {"auth": %q}}}`, basicAuth("env-user", "pw"))
+	t.Setenv("REGISTRY_AUTH_FILE", writeAuthFile(t, content))
+
+	config, _, err := NewClient().auth("quay.io/org/app")
+	if err != nil {
+		t.Fatalf("auth() error = %v", err)
+	}
+	if config.Username != "env-user" {
+		t.Errorf("auth() = %+v, want the REGISTRY_AUTH_FILE credentials", config)
+	}
+
+	// --authfile wins over the environment
+	config, _, err = NewClient(WithAuthFile(writeAuthFile(t, `{}`))).auth("quay.io/org/app")
+	if err != nil {
+		t.Fatalf("auth() error = %v", err)
+	}
+	if config.Username != "" {
+		t.Errorf("auth() = %+v, want anonymous access with an empty --authfile", config)
+	}
+}
+
+func TestClientAuth_RegistriesConfHelpers(t *testing.T) {
+	installHelper(t, "podman", "quay.io", "helper-user", "helper-secret")
+	authFile := writeAuthFile(t, fmt.Sprintf(`{"auths": {"quay.io": {"auth": %q}}}`, basicAuth("file-user", "pw")))
+	conf := filepath.Join(t.TempDir(), "registries.conf")
+	if err := os.WriteFile(conf, []byte(`credential-helpers = ["podman", "containers-auth.json"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONTAINERS_REGISTRIES_CONF", conf)
+
+	// The helpers are asked in the configured order, the auth files standing in for containers-auth.json
+	client := NewClient(WithAuthFile(authFile))
+	config, source, err := client.auth("quay.io/org/app")
+	if err != nil {
+		t.Fatalf("auth() error = %v", err)
+	}
+	if config.Username != "helper-user" || source != "credential helper podman (credential-helpers in registries.conf)" {
+		t.Errorf("auth() = %+v from %q, want the podman helper's credentials", config, source)
+	}
+	if config, _, _ := client.auth("ghcr.io/org/app"); config.Username != "" {
+		t.Errorf("auth() = %+v, want anonymous access for a registry neither source knows", config)
+	}
+}
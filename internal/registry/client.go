@@ -2,25 +2,78 @@ package registry
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
-	"strings"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/containers/image/v5/docker"
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/cli/environment"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
 	"github.com/containers/image/v5/types"
+
+	"github.com/wharflab/container-source-policy/internal/network"
 )
 
+// certsDirs are the per-registry certificate directories containers/image looks in, in its order
+var certsDirs = []string{"/etc/containers/certs.d", "/etc/docker/certs.d"}
+
 // Client provides methods for interacting with container registries
 type Client struct {
+	sysCtx    *types.SystemContext
+	network   *network.Network
+	authFile  string                // replaces the default auth files; empty uses REGISTRY_AUTH_FILE or the defaults
+	creds     map[string]Credential // registry -> --creds credentials
+	authDebug func(format string, args ...any)
+	mirrors   map[string][]string // registry -> mirrors tried before it, as host[/path prefix]
+
+	// Transient failures are retried up to attempts times in all, waiting retryDelay and then twice as long each time.
+	// containers/image itself retries 429 responses, as long as Retry-After says.
+	attempts   int
+	retryDelay time.Duration
+
+	authMu sync.Mutex
+	auths  map[string]*registryAuth // repository -> credentials looked up
+
+	hostMu sync.Mutex
+	hosts  map[string]*hostContext // registry host -> settings shared by every lookup on it
+}
+
+// hostContext is the SystemContext of a registry host, without credentials
+type hostContext struct {
+	once   sync.Once
 	sysCtx *types.SystemContext
+	err    error
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithNetwork applies custom CAs, client certificates, insecure and plain-HTTP registries and the proxy
+func WithNetwork(n *network.Network) Option {
+	return func(c *Client) {
+		c.network = n
+	}
+}
+
+// WithMirrors sets mirrors to resolve images through before their registry, as in buildkitd.toml: each mirror
+// is a host, optionally followed by a path prefix that the repository is appended to
+func WithMirrors(mirrors map[string][]string) Option {
+	return func(c *Client) {
+		for registry, hosts := range mirrors {
+			c.mirrors[normalizeRegistry(registry)] = hosts
+		}
+	}
 }
 
 // NewClient creates a new registry client
 // It respects CONTAINERS_REGISTRIES_CONF environment variable for registry configuration
-func NewClient() *Client {
+func NewClient(opts ...Option) *Client {
 	sysCtx := &types.SystemContext{}
 
 	// Apply CONTAINERS_REGISTRIES_CONF or REGISTRIES_CONFIG_PATH env vars if set
@@ -28,12 +81,98 @@ func NewClient() *Client {
 		fmt.Fprintf(os.Stderr, "warning: failed to load registries config: %v\n", err)
 	}
 
-	return &Client{
-		sysCtx: sysCtx,
+	c := &Client{
+		sysCtx:     sysCtx,
+		creds:      make(map[string]Credential),
+		mirrors:    make(map[string][]string),
+		attempts:   3,
+		retryDelay: time.Second,
+		auths:      make(map[string]*registryAuth),
+		hosts:      make(map[string]*hostContext),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// systemContext returns the SystemContext for a lookup of ref: the settings of its registry host
+// with the credentials of its repository
+func (c *Client) systemContext(ref reference.Named) (*types.SystemContext, error) {
+	hostCtx, err := c.hostContext(reference.Domain(ref))
+	if err != nil {
+		return nil, err
+	}
+	authConfig, _, err := c.auth(ref.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up credentials for %s: %w", ref.Name(), err)
 	}
+	sysCtx := *hostCtx
+	sysCtx.DockerAuthConfig = authConfig
+	return &sysCtx, nil
 }
 
-// GetDigest resolves an image reference to its digest
+// hostContext returns the SystemContext for a registry host, with the network settings that apply to it,
+// preparing it once per host
+func (c *Client) hostContext(host string) (*types.SystemContext, error) {
+	c.hostMu.Lock()
+	entry, ok := c.hosts[host]
+	if !ok {
+		entry = &hostContext{}
+		c.hosts[host] = entry
+	}
+	c.hostMu.Unlock()
+
+	entry.once.Do(func() {
+		entry.sysCtx, entry.err = c.newHostContext(host)
+	})
+	return entry.sysCtx, entry.err
+}
+
+// newHostContext applies the network settings of host: its certificates, whether it is verified and the proxy
+func (c *Client) newHostContext(host string) (*types.SystemContext, error) {
+	sysCtx := *c.sysCtx
+	if c.network == nil {
+		return &sysCtx, nil
+	}
+
+	certDir, err := c.network.CertDir(host, systemCertDir(host))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare certificates for %s: %w", host, err)
+	}
+	// containers/image adds the CAs of the directory to the system roots
+	sysCtx.DockerCertPath = certDir
+
+	// containers/image falls back to plain HTTP only for registries it does not verify
+	if settings, ok := c.network.Host(host); ok && (settings.Insecure || settings.PlainHTTP) {
+		sysCtx.DockerInsecureSkipTLSVerify = types.OptionalBoolTrue
+	}
+
+	proxy, err := c.network.ProxyURL(&url.URL{Scheme: "https", Host: host})
+	if err != nil {
+		return nil, err
+	}
+	sysCtx.DockerProxyURL = proxy
+	return &sysCtx, nil
+}
+
+// systemCertDir returns the certs.d directory containers/image would use for host, or ""
+func systemCertDir(host string) string {
+	dirs := certsDirs
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append([]string{filepath.Join(home, ".config", "containers", "certs.d")}, dirs...)
+	}
+	for _, dir := range dirs {
+		if info, err := os.Stat(filepath.Join(dir, host)); err == nil && info.IsDir() {
+			return filepath.Join(dir, host)
+		}
+	}
+	return ""
+}
+
+// GetDigest resolves an image reference to its digest.
+// Errors match ErrNotFound, ErrUnauthorized, ErrRateLimited or ErrTransient with errors.Is when they can be
+// classified; transient failures are retried a few times first.
 func (c *Client) GetDigest(ctx context.Context, ref reference.Named) (string, error) {
 	// Add default tag if not present
 	if _, ok := ref.(reference.Tagged); !ok {
@@ -46,51 +185,137 @@ func (c *Client) GetDigest(ctx context.Context, ref reference.Named) (string, er
 		}
 	}
 
+	for attempt := 1; ; attempt++ {
+		digest, err := c.resolveDigest(ctx, ref)
+		if err == nil || !errors.Is(err, ErrTransient) || attempt == c.attempts {
+			return digest, err
+		}
+		select {
+		case <-time.After(c.retryDelay << (attempt - 1)):
+		case <-ctx.Done():
+			return "", err
+		}
+	}
+}
+
+// pullSource is a location a manifest can be fetched from: a mirror, or the location registries.conf gives
+type pullSource struct {
+	ref      reference.Named
+	insecure bool // registries.conf marks the location insecure
+}
+
+// resolveDigest returns the manifest digest of ref from the first source that has it. When every source
+// fails, the error is the last one: the registry itself, after its mirrors.
+func (c *Client) resolveDigest(ctx context.Context, ref reference.Named) (string, error) {
+	sources, err := c.pullSources(ref)
+	if err != nil {
+		return "", err
+	}
+	for _, source := range sources {
+		var digest string
+		digest, err = c.fetchDigest(ctx, source)
+		if err == nil || ctx.Err() != nil {
+			return digest, err
+		}
+	}
+	return "", err
+}
+
+// pullSources returns where ref can be fetched from, in order: the mirrors set with WithMirrors, then the
+// sources registries.conf gives (location rewrites, mirrors, insecure and blocked registries). containers/image
+// applies registries.conf only when it reads whole manifests, so the digest lookups follow it here.
+func (c *Client) pullSources(ref reference.Named) ([]pullSource, error) {
+	var result []pullSource
+	for _, mirror := range c.mirrors[reference.Domain(ref)] {
+		mirrorRef, err := mirrorReference(ref, mirror)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pullSource{ref: mirrorRef})
+	}
+
+	reg, err := sysregistriesv2.FindRegistry(c.sysCtx, ref.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registries configuration: %w", err)
+	}
+	if reg == nil {
+		return append(result, pullSource{ref: ref}), nil
+	}
+	if reg.Blocked {
+		return nil, fmt.Errorf("registry %s is blocked in registries configuration", reg.Prefix)
+	}
+	sources, err := reg.PullSourcesFromReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		result = append(result, pullSource{ref: source.Reference, insecure: source.Endpoint.Insecure})
+	}
+	return result, nil
+}
+
+// mirrorReference returns ref on a mirror given as host[/path prefix], keeping its tag or digest
+func mirrorReference(ref reference.Named, mirror string) (reference.Named, error) {
+	mirrored, err := reference.ParseNamed(mirror + "/" + reference.Path(ref))
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror %q for %s: %w", mirror, reference.Domain(ref), err)
+	}
+	if digested, ok := ref.(reference.Digested); ok {
+		return reference.WithDigest(mirrored, digested.Digest())
+	}
+	if tagged, ok := ref.(reference.Tagged); ok {
+		return reference.WithTag(mirrored, tagged.Tag())
+	}
+	return mirrored, nil
+}
+
+// fetchDigest returns the digest of the manifest at source, with errors classified. The digest comes from
+// a HEAD request's Docker-Content-Digest header, which registries do not count as a pull; the manifest is
+// only downloaded and hashed when the header is missing or the HEAD fails in a way a GET might not.
+func (c *Client) fetchDigest(ctx context.Context, source pullSource) (string, error) {
+	ref := source.ref
 	imgRef, err := docker.NewReference(ref)
 	if err != nil {
 		return "", fmt.Errorf("failed to create docker reference: %w", err)
 	}
+	sysCtx, err := c.systemContext(ref)
+	if err != nil {
+		return "", err
+	}
+	if source.insecure {
+		sysCtx.DockerInsecureSkipTLSVerify = types.OptionalBoolTrue
+	}
+
+	digest, err := docker.GetDigest(ctx, sysCtx, imgRef)
+	if err == nil {
+		return digest.String(), nil
+	}
+	if errorKind(err) != nil || ctx.Err() != nil {
+		// A GET would fail the same way, and count against the rate limit
+		return "", fmt.Errorf("failed to get digest for %s: %w", ref.String(), classify(err))
+	}
 
-	imgSrc, err := imgRef.NewImageSource(ctx, c.sysCtx)
+	imgSrc, err := imgRef.NewImageSource(ctx, sysCtx)
 	if err != nil {
-		return "", fmt.Errorf("failed to create image source for %s: %w", ref.String(), err)
+		return "", fmt.Errorf("failed to create image source for %s: %w", ref.String(), classify(err))
 	}
 	defer func() { _ = imgSrc.Close() }()
 
 	manifestBytes, _, err := imgSrc.GetManifest(ctx, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to get manifest for %s: %w", ref.String(), err)
+		return "", fmt.Errorf("failed to get manifest for %s: %w", ref.String(), classify(err))
 	}
 
-	digest, err := manifest.Digest(manifestBytes)
+	manifestDigest, err := manifest.Digest(manifestBytes)
 	if err != nil {
 		return "", fmt.Errorf("failed to compute manifest digest for %s: %w", ref.String(), err)
 	}
 
-	return digest.String(), nil
-}
-
-// isNotFoundError checks if the lowercase error string indicates a "not found" condition.
-func isNotFoundError(errStr string) bool {
-	return strings.Contains(errStr, "404") ||
-		strings.Contains(errStr, "not found") ||
-		strings.Contains(errStr, "manifest unknown") ||
-		strings.Contains(errStr, "name unknown") ||
-		strings.Contains(errStr, "unknown name") ||
-		strings.Contains(errStr, "does not exist")
-}
-
-// isAuthError checks if the lowercase error string indicates an authentication error.
-func isAuthError(errStr string) bool {
-	return strings.Contains(errStr, "401") ||
-		strings.Contains(errStr, "403") ||
-		strings.Contains(errStr, "unauthorized") ||
-		strings.Contains(errStr, "authentication required") ||
-		strings.Contains(errStr, "denied")
+	return manifestDigest.String(), nil
 }
 
 // CheckAuth verifies that the client can authenticate to a registry.
-// It does this by attempting to access an image reference, which triggers auth.
+// It does this by resolving an image reference, which triggers auth.
 // Returns nil if authentication succeeds (even if image doesn't exist),
 // or an error describing the auth failure.
 func (c *Client) CheckAuth(ctx context.Context, registry string) error {
@@ -102,46 +327,24 @@ func (c *Client) CheckAuth(ctx context.Context, registry string) error {
 		return fmt.Errorf("invalid registry reference: %w", err)
 	}
 
-	imgRef, err := docker.NewReference(ref)
-	if err != nil {
-		return fmt.Errorf("failed to create docker reference: %w", err)
-	}
-
-	// Try to create an image source - this will trigger authentication
-	imgSrc, err := imgRef.NewImageSource(ctx, c.sysCtx)
-	if err != nil {
-		errStr := strings.ToLower(err.Error())
-
+	if _, err := c.resolveDigest(ctx, ref); err != nil {
 		// 404/not found means auth succeeded but image doesn't exist - that's OK
-		if isNotFoundError(errStr) {
+		if errors.Is(err, ErrNotFound) {
 			return nil
 		}
 
 		// Check if it's an auth error
-		if isAuthError(errStr) {
-			return fmt.Errorf("authentication failed for %s: run 'docker login %s' first", registry, registry)
+		if errors.Is(err, ErrUnauthorized) {
+			_, source, _ := c.auth(ref.Name())
+			return fmt.Errorf(
+				"authentication failed for %s with %s: run 'docker login %s' or 'podman login %s', or pass --authfile or --creds",
+				registry, source, registry, registry,
+			)
+		}
+		if errors.Is(err, ErrRateLimited) {
+			return fmt.Errorf("%s is rate limiting requests, try again later: %w", registry, err)
 		}
 		return fmt.Errorf("failed to connect to %s: %w", registry, err)
 	}
-	_ = imgSrc.Close()
-
 	return nil
 }
-
-// IsNotFoundOrAuthError checks if an error indicates that an image was not found
-// or that authentication is required. These are expected errors when checking
-// for DHI equivalents that may not exist.
-//
-// Returns true for:
-//   - 404 Not Found (image doesn't exist)
-//   - 401 Unauthorized (authentication required)
-//   - 403 Forbidden (access denied)
-//   - "manifest unknown" errors (common registry response for missing images)
-func IsNotFoundOrAuthError(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	errStr := strings.ToLower(err.Error())
-	return isNotFoundError(errStr) || isAuthError(errStr)
-}
@@ -0,0 +1,159 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/wharflab/container-source-policy/internal/config"
+	"github.com/wharflab/container-source-policy/internal/network"
+	"github.com/wharflab/container-source-policy/internal/testutil"
+)
+
+// newPlainHTTPClient returns a client that talks to hosts over plain HTTP, without credentials unless opts add some
+func newPlainHTTPClient(t *testing.T, hosts []string, opts ...Option) *Client {
+	t.Helper()
+	var cfg config.NetworkConfig
+	for _, host := range hosts {
+		cfg.Hosts = append(cfg.Hosts, config.NetworkHost{Host: host, PlainHTTP: true})
+	}
+	nw, err := network.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = nw.Close() })
+	opts = append([]Option{WithNetwork(nw), WithAuthFile(filepath.Join(t.TempDir(), "auth.json"))}, opts...)
+	return NewClient(opts...)
+}
+
+func getDigest(t *testing.T, client *Client, image string) string {
+	t.Helper()
+	ref, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := client.GetDigest(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("GetDigest(%s) error = %v", image, err)
+	}
+	return dgst
+}
+
+func TestGetDigest_HEAD(t *testing.T) {
+	registry := testutil.NewMockRegistry()
+	t.Cleanup(registry.Close)
+	want, err := registry.AddImage("library/alpine", "3.18", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.ResetRequests()
+	client := newPlainHTTPClient(t, []string{registry.Host()})
+	image := registry.Host() + "/library/alpine:3.18"
+
+	if got := getDigest(t, client, image); got != want {
+		t.Errorf("GetDigest() = %s, want %s", got, want)
+	}
+	if heads, gets := registry.ManifestRequests("HEAD"), registry.ManifestRequests("GET"); heads != 1 || gets != 0 {
+		t.Errorf("manifest requests: %d HEAD, %d GET; want the digest from a single HEAD", heads, gets)
+	}
+
+	// Without Docker-Content-Digest, the manifest is downloaded and hashed
+	registry.ResetRequests()
+	registry.OmitDigestHeader(true)
+	if got := getDigest(t, client, image); got != want {
+		t.Errorf("GetDigest() = %s, want %s", got, want)
+	}
+	if heads, gets := registry.ManifestRequests("HEAD"), registry.ManifestRequests("GET"); heads != 1 || gets != 1 {
+		t.Errorf("manifest requests: %d HEAD, %d GET; want a GET after the HEAD", heads, gets)
+	}
+}
+
+func TestGetDigest_Mirrors(t *testing.T) {
+	upstream := testutil.NewMockRegistry()
+	t.Cleanup(upstream.Close)
+	mirror := testutil.NewMockRegistry()
+	t.Cleanup(mirror.Close)
+
+	mirrored, err := mirror.AddImage("proxy/library/alpine", "3.18", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := upstream.AddImage("library/alpine", "3.18", 2); err != nil {
+		t.Fatal(err)
+	}
+	busybox, err := upstream.AddImage("library/busybox", "1.36", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream.ResetRequests()
+	mirror.ResetRequests()
+
+	client := newPlainHTTPClient(t, []string{upstream.Host(), mirror.Host()},
+		WithMirrors(map[string][]string{upstream.Host(): {mirror.Host() + "/proxy"}}))
+
+	// The mirror answers, so the registry is not contacted
+	if got := getDigest(t, client, upstream.Host()+"/library/alpine:3.18"); got != mirrored {
+		t.Errorf("GetDigest() = %s, want the mirror's %s", got, mirrored)
+	}
+	if upstream.RequestCount("/manifests/") != 0 {
+		t.Errorf("registry was contacted although the mirror has the image: %v", upstream.Requests())
+	}
+
+	// An image missing from the mirror comes from the registry
+	if got := getDigest(t, client, upstream.Host()+"/library/busybox:1.36"); got != busybox {
+		t.Errorf("GetDigest() = %s, want the registry's %s", got, busybox)
+	}
+	if !mirror.HasRequest("HEAD /v2/proxy/library/busybox/manifests/1.36") {
+		t.Errorf("mirror was not tried first: %v", mirror.Requests())
+	}
+}
+
+// newTokenRegistry serves manifests behind bearer tokens, handing out tokens for a namespace's repositories
+// only to the user named after the namespace
+func newTokenRegistry(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			scope := r.URL.Query().Get("scope")
+			namespace, _, _ := strings.Cut(strings.TrimPrefix(scope, "repository:"), "/")
+			if user, pass, ok := r.BasicAuth(); !ok || user != namespace || pass != "secret" {
+				http.Error(w, "bad credentials", http.StatusUnauthorized)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"token": %q, "expires_in": 300}`, "token-"+scope)
+			return
+		}
+
+		repo, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/")
+		if r.Header.Get("Authorization") != "Bearer token-repository:"+repo+":pull" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="test"`, r.Host))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest.FromString(repo).String())
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetDigest_NamespacedCredentials(t *testing.T) {
+	server := newTokenRegistry(t)
+	host := server.Listener.Addr().String()
+	authFile := writeAuthFile(t, fmt.Sprintf(`{"auths": {%q: {"auth": %q}, %q: {"auth": %q}}}`,
+		host+"/org-a", basicAuth("org-a", "secret"), host+"/org-b", basicAuth("org-b", "secret")))
+	client := newPlainHTTPClient(t, []string{host}, WithAuthFile(authFile))
+
+	// Each repository gets the credentials of its namespace
+	for _, repo := range []string{"org-a/app", "org-b/app", "org-a/tool"} {
+		if got, want := getDigest(t, client, host+"/"+repo+":1"), digest.FromString(repo).String(); got != want {
+			t.Errorf("GetDigest(%s) = %s, want %s", repo, got, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"syscall"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+// Errors returned by Client, checked with errors.Is. They are derived from the registry's error codes
+// and HTTP status, never from the wording of error messages.
+var (
+	// ErrNotFound means the repository, tag or digest does not exist
+	ErrNotFound = errors.New("not found in registry")
+	// ErrUnauthorized means the registry refused the credentials, or access without credentials
+	ErrUnauthorized = errors.New("not authorized by registry")
+	// ErrRateLimited means the registry kept answering 429 Too Many Requests
+	ErrRateLimited = errors.New("rate limited by registry")
+	// ErrTransient means a failure that may go away on retry: a 5xx status, a timeout or a dropped connection
+	ErrTransient = errors.New("transient registry failure")
+)
+
+// registryError is a failure classified as one of the errors above
+type registryError struct {
+	kind error
+	err  error
+}
+
+func (e *registryError) Error() string   { return e.err.Error() }
+func (e *registryError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// classify wraps err so that errors.Is reports its kind, or returns err unchanged when it has none
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	if kind := errorKind(err); kind != nil {
+		return &registryError{kind: kind, err: err}
+	}
+	return err
+}
+
+// errorKind returns the error above that describes err, or nil
+func errorKind(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// The caller gave up; retrying would not help
+		return nil
+	case errors.Is(err, docker.ErrTooManyRequests):
+		return ErrRateLimited
+	case errors.As(err, new(docker.ErrUnauthorizedForCredentials)):
+		return ErrUnauthorized
+	}
+
+	var coder errcode.ErrorCoder
+	if errors.As(err, &coder) {
+		switch coder.ErrorCode() {
+		case v2.ErrorCodeManifestUnknown, v2.ErrorCodeNameUnknown, v2.ErrorCodeBlobUnknown:
+			return ErrNotFound
+		case errcode.ErrorCodeUnauthorized, errcode.ErrorCodeDenied:
+			return ErrUnauthorized
+		case errcode.ErrorCodeTooManyRequests:
+			return ErrRateLimited
+		case errcode.ErrorCodeUnavailable:
+			return ErrTransient
+		}
+	}
+
+	if status, ok := httpStatus(err); ok {
+		switch {
+		case status == http.StatusNotFound:
+			return ErrNotFound
+		case status == http.StatusUnauthorized, status == http.StatusForbidden:
+			return ErrUnauthorized
+		case status == http.StatusTooManyRequests:
+			return ErrRateLimited
+		case status == http.StatusRequestTimeout, status >= 500:
+			return ErrTransient
+		}
+	}
+
+	if isTransientNetworkError(err) {
+		return ErrTransient
+	}
+	return nil
+}
+
+// httpStatus returns the HTTP status carried by an error in err's tree. Besides UnexpectedHTTPStatusError,
+// containers/image reports 4xx responses whose body is not a registry error with an unexported type
+// that has a StatusCode field, so the field is read by reflection.
+func httpStatus(err error) (int, bool) {
+	var unexpected docker.UnexpectedHTTPStatusError
+	if errors.As(err, &unexpected) {
+		return unexpected.StatusCode, true
+	}
+
+	for _, e := range errorTree(err) {
+		v := reflect.ValueOf(e)
+		if v.Kind() == reflect.Pointer {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		if field := v.FieldByName("StatusCode"); field.IsValid() && field.CanInt() {
+			return int(field.Int()), true
+		}
+	}
+	return 0, false
+}
+
+// errorTree returns err and every error it wraps
+func errorTree(err error) []error {
+	if err == nil {
+		return nil
+	}
+	tree := []error{err}
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		tree = append(tree, errorTree(e.Unwrap())...)
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			tree = append(tree, errorTree(inner)...)
+		}
+	}
+	return tree
+}
+
+// isTransientNetworkError reports timeouts, reset connections and responses cut off mid-body.
+// A refused connection means nothing listens there, and a bare EOF is how a TLS or protocol mismatch
+// usually ends, so neither is retried.
+func isTransientNetworkError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
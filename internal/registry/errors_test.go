@@ -0,0 +1,167 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/wharflab/container-source-policy/internal/config"
+	"github.com/wharflab/container-source-policy/internal/network"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "manifest unknown", err: v2.ErrorCodeManifestUnknown.WithMessage("manifest unknown"), want: ErrNotFound},
+		{name: "name unknown", err: fmt.Errorf("reading manifest: %w", v2.ErrorCodeNameUnknown), want: ErrNotFound},
+		{name: "denied", err: errcode.ErrorCodeDenied.WithMessage("requested access is denied"), want: ErrUnauthorized},
+		{name: "bad credentials", err: docker.ErrUnauthorizedForCredentials{Err: errors.New("401")}, want: ErrUnauthorized},
+		{name: "rate limited", err: fmt.Errorf("pinging: %w", docker.ErrTooManyRequests), want: ErrRateLimited},
+		{name: "toomanyrequests code", err: errcode.ErrorCodeTooManyRequests.WithMessage("slow down"), want: ErrRateLimited},
+		{name: "bad gateway", err: docker.UnexpectedHTTPStatusError{StatusCode: http.StatusBadGateway}, want: ErrTransient},
+		{name: "not found", err: docker.UnexpectedHTTPStatusError{StatusCode: http.StatusNotFound}, want: ErrNotFound},
+		{name: "forbidden", err: docker.UnexpectedHTTPStatusError{StatusCode: http.StatusForbidden}, want: ErrUnauthorized},
+		{name: "method not allowed", err: docker.UnexpectedHTTPStatusError{StatusCode: http.StatusMethodNotAllowed}},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: ErrTransient},
+		{name: "truncated body", err: fmt.Errorf("reading manifest: %w", io.ErrUnexpectedEOF), want: ErrTransient},
+		// Nothing listens there, or the TLS or protocol settings are wrong: retrying would not help
+		{name: "connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED)},
+		{name: "bare EOF", err: fmt.Errorf("ping: %w", io.EOF)},
+		{name: "canceled", err: fmt.Errorf("fetching: %w", context.Canceled), want: nil},
+		// Substrings of the message do not count
+		{name: "image named like an error", err: errors.New("invalid reference docker.io/library/404-denied:does-not-exist")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(tt.err)
+			for _, kind := range []error{ErrNotFound, ErrUnauthorized, ErrRateLimited, ErrTransient} {
+				if got := errors.Is(err, kind); got != errors.Is(kind, tt.want) {
+					t.Errorf("errors.Is(classify(err), %v) = %v", kind, got)
+				}
+			}
+			if !errors.Is(err, tt.err) || err.Error() != tt.err.Error() {
+				t.Errorf("classify() = %v, want the original error kept", err)
+			}
+		})
+	}
+}
+
+const testManifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+	`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:` +
+	`44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`
+
+// newErrorRegistry serves manifests that fail in the way their repository name says
+func newErrorRegistry(t *testing.T) (*httptest.Server, func(repo string) int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		repo, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/")
+		mu.Lock()
+		requests[repo]++
+		count := requests[repo]
+		mu.Unlock()
+
+		switch repo {
+		case "missing":
+			http.NotFound(w, r)
+		case "unknown":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`))
+		case "private":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"UNAUTHORIZED","message":"authentication required"}]}`))
+		case "limited":
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		case "down":
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case "flaky":
+			if count < 3 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", digest.FromString(testManifest).String())
+			_, _ = w.Write([]byte(testManifest))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func(repo string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[repo]
+	}
+}
+
+func TestGetDigest_Errors(t *testing.T) {
+	server, requests := newErrorRegistry(t)
+	host := server.Listener.Addr().String()
+	nw, err := network.New(config.NetworkConfig{Hosts: []config.NetworkHost{{Host: host, PlainHTTP: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = nw.Close() })
+	client := NewClient(WithNetwork(nw), WithAuthFile(filepath.Join(t.TempDir(), "auth.json")))
+	client.retryDelay = time.Millisecond
+
+	tests := []struct {
+		repo         string
+		want         error
+		wantRequests int
+	}{
+		{repo: "missing", want: ErrNotFound, wantRequests: 1},
+		{repo: "unknown", want: ErrNotFound, wantRequests: 1},
+		{repo: "private", want: ErrUnauthorized, wantRequests: 1},
+		{repo: "down", want: ErrTransient, wantRequests: 3},
+		{repo: "flaky", wantRequests: 3},
+		// containers/image retries 429 responses itself
+		{repo: "limited", want: ErrRateLimited},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			ref, err := reference.ParseNormalizedNamed(host + "/" + tt.repo + ":latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = client.GetDigest(context.Background(), ref)
+			if (err != nil) != (tt.want != nil) {
+				t.Fatalf("GetDigest() error = %v, want %v", err, tt.want)
+			}
+			// Exactly one kind matches: a rate limit must never look like a missing image
+			for _, kind := range []error{ErrNotFound, ErrUnauthorized, ErrRateLimited, ErrTransient} {
+				if got := errors.Is(err, kind); got != errors.Is(kind, tt.want) {
+					t.Errorf("errors.Is(%v, %v) = %v", err, kind, got)
+				}
+			}
+			if tt.wantRequests > 0 && requests(tt.repo) != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requests(tt.repo), tt.wantRequests)
+			}
+		})
+	}
+}
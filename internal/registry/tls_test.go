@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/wharflab/container-source-policy/internal/config"
+	"github.com/wharflab/container-source-policy/internal/network"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to dir
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ci"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile, cert
+}
+
+// newMTLSRegistry serves manifest digests over HTTPS, with a self-signed certificate, to clients presenting clientCert
+func newMTLSRegistry(t *testing.T, clientCert *x509.Certificate) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", digest.FromString(r.URL.Path).String())
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetDigest_InsecureHostWithClientCert(t *testing.T) {
+	certFile, keyFile, cert := writeClientCert(t, t.TempDir())
+	server := newMTLSRegistry(t, cert)
+	host := server.Listener.Addr().String()
+
+	nw, err := network.New(config.NetworkConfig{Hosts: []config.NetworkHost{
+		{Host: host, Insecure: true, ClientCert: certFile, ClientKey: keyFile},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = nw.Close() })
+	client := NewClient(WithNetwork(nw), WithAuthFile(filepath.Join(t.TempDir(), "auth.json")))
+
+	// The unverified server certificate is accepted, and the client certificate still presented
+	want := digest.FromString("/v2/team/app/manifests/1").String()
+	if got := getDigest(t, client, host+"/team/app:1"); got != want {
+		t.Errorf("GetDigest() = %s, want %s", got, want)
+	}
+}
+
+func TestGetDigest_BuildkitdMirrorWithKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	_, _, cert := writeClientCert(t, dir)
+	mirror := newMTLSRegistry(t, cert)
+	mirrorHost := mirror.Listener.Addr().String()
+
+	// The keypair is relative to the file, and the mirror's certificate is not trusted
+	path := filepath.Join(dir, "buildkitd.toml")
+	buildkitdConfig := `
+[registry."registry.example.com"]
+mirrors = ["` + mirrorHost + `/proxy"]
+
+[registry."` + mirrorHost + `"]
+insecure = true
+
+[[registry."` + mirrorHost + `".keypair]]
+key = "client-key.pem"
+cert = "client.pem"
+`
+	if err := os.WriteFile(path, []byte(buildkitdConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	buildkitd, err := config.LoadBuildkitd(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var networkConfig config.NetworkConfig
+	networkConfig.MergeHosts(buildkitd.NetworkHosts()...)
+	nw, err := network.New(networkConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = nw.Close() })
+	client := NewClient(
+		WithNetwork(nw),
+		WithMirrors(buildkitd.Mirrors()),
+		WithAuthFile(filepath.Join(t.TempDir(), "auth.json")),
+	)
+
+	want := digest.FromString("/v2/proxy/team/app/manifests/1").String()
+	if got := getDigest(t, client, "registry.example.com/team/app:1"); got != want {
+		t.Errorf("GetDigest() = %s, want the mirror's %s", got, want)
+	}
+}
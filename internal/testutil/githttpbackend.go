@@ -0,0 +1,24 @@
+package testutil
+
+import (
+	"fmt"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// NewGitHTTPBackend serves the bare repositories under projectRoot over smart HTTP
+// with git-http-backend, so the git CLI can ls-remote and fetch from them.
+// Requires the git binary.
+func NewGitHTTPBackend(projectRoot string) (*httptest.Server, error) {
+	out, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate git exec path: %w", err)
+	}
+	return httptest.NewServer(&cgi.Handler{
+		Path: filepath.Join(strings.TrimSpace(string(out)), "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + projectRoot, "GIT_HTTP_EXPORT_ALL=1"},
+	}), nil
+}
@@ -0,0 +1,102 @@
+package testutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// MockGitRef is a ref advertised by MockGitServer.
+// Peeled, when set, makes the ref an annotated tag pointing at that commit.
+type MockGitRef struct {
+	Name   string
+	SHA    string
+	Peeled string
+}
+
+// MockGitServer is a test git server speaking the smart HTTP ref advertisement (info/refs)
+type MockGitServer struct {
+	Server   *httptest.Server
+	repos    map[string][]MockGitRef // repository path (e.g., /owner/repo.git) -> refs
+	requests []string                // tracks all requests made to the server
+	mu       sync.Mutex
+}
+
+// NewMockGitServer creates a new mock git server
+func NewMockGitServer() *MockGitServer {
+	ms := &MockGitServer{
+		repos: make(map[string][]MockGitRef),
+	}
+
+	ms.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms.mu.Lock()
+		ms.requests = append(ms.requests, r.Method+" "+r.URL.Path)
+		refs, ok := ms.repos[strings.TrimSuffix(r.URL.Path, "/info/refs")]
+		ms.mu.Unlock()
+
+		if !ok || !strings.HasSuffix(r.URL.Path, "/info/refs") || r.URL.Query().Get("service") != "git-upload-pack" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		writePktLine(w, "# service=git-upload-pack\n")
+		_, _ = w.Write([]byte("0000"))
+		for i, ref := range refs {
+			line := ref.SHA + " " + ref.Name
+			if i == 0 {
+				line += "\x00agent=git/mock"
+			}
+			writePktLine(w, line+"\n")
+			if ref.Peeled != "" {
+				writePktLine(w, ref.Peeled+" "+ref.Name+"^{}\n")
+			}
+		}
+		_, _ = w.Write([]byte("0000"))
+	}))
+
+	return ms
+}
+
+func writePktLine(w http.ResponseWriter, s string) {
+	_, _ = fmt.Fprintf(w, "%04x%s", len(s)+4, s)
+}
+
+// Close shuts down the mock git server
+func (ms *MockGitServer) Close() {
+	ms.Server.Close()
+}
+
+// AddRepo registers a repository at path (e.g., /owner/repo.git) advertising refs in order
+func (ms *MockGitServer) AddRepo(path string, refs ...MockGitRef) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.repos[path] = refs
+}
+
+// RequestCount returns the number of requests matching the pattern
+func (ms *MockGitServer) RequestCount(pattern string) int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	count := 0
+	for _, req := range ms.requests {
+		if strings.Contains(req, pattern) {
+			count++
+		}
+	}
+	return count
+}
+
+// ResetRequests clears the tracked requests
+func (ms *MockGitServer) ResetRequests() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.requests = nil
+}
+
+// URL returns the base URL of the mock git server
+func (ms *MockGitServer) URL() string {
+	return ms.Server.URL
+}
@@ -49,10 +49,12 @@ func NewMockHTTPServer() *MockHTTPServer {
 
 		// For HEAD requests, only return headers
 		if r.Method == http.MethodHead {
-			// Compute SHA256 and return as ETag (simulating raw.githubusercontent.com behavior)
-			hash := sha256.Sum256(file.content)
-			etag := hex.EncodeToString(hash[:])
-			w.Header().Set("ETag", etag)
+			// Compute SHA256 and return as ETag (simulating raw.githubusercontent.com behavior),
+			// unless the file was added with its own ETag
+			if w.Header().Get("ETag") == "" {
+				hash := sha256.Sum256(file.content)
+				w.Header().Set("ETag", hex.EncodeToString(hash[:]))
+			}
 			w.Header().Set("Content-Length", strconv.Itoa(len(file.content)))
 			w.WriteHeader(http.StatusOK)
 			return
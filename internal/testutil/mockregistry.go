@@ -20,9 +20,10 @@ import (
 
 // MockRegistry is a test registry server that serves images with deterministic digests
 type MockRegistry struct {
-	Server   *httptest.Server
-	requests []string // tracks all requests made to the registry
-	mu       sync.Mutex
+	Server     *httptest.Server
+	requests   []string // tracks all requests made to the registry
+	omitDigest bool     // strip Docker-Content-Digest from manifest responses
+	mu         sync.Mutex
 }
 
 // NewMockRegistry creates a new mock registry server
@@ -35,7 +36,11 @@ func NewMockRegistry() *MockRegistry {
 		req := r.Method + " " + r.URL.Path
 		mr.mu.Lock()
 		mr.requests = append(mr.requests, req)
+		omitDigest := mr.omitDigest
 		mr.mu.Unlock()
+		if omitDigest && strings.Contains(r.URL.Path, "/manifests/") {
+			w = &noDigestWriter{ResponseWriter: w}
+		}
 		registryHandler.ServeHTTP(w, r)
 	}))
 
@@ -89,6 +94,42 @@ func (mr *MockRegistry) RequestCount(pattern string) int {
 	return count
 }
 
+// ManifestRequests returns the number of manifest requests made with method (e.g. "HEAD" or "GET")
+func (mr *MockRegistry) ManifestRequests(method string) int {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	count := 0
+	for _, req := range mr.requests {
+		if strings.HasPrefix(req, method+" ") && strings.Contains(req, "/manifests/") {
+			count++
+		}
+	}
+	return count
+}
+
+// OmitDigestHeader makes manifest responses leave out Docker-Content-Digest, like registries that
+// only return it for GET or not at all
+func (mr *MockRegistry) OmitDigestHeader(omit bool) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.omitDigest = omit
+}
+
+// noDigestWriter drops the Docker-Content-Digest header of a response
+type noDigestWriter struct {
+	http.ResponseWriter
+}
+
+func (w *noDigestWriter) WriteHeader(status int) {
+	w.Header().Del("Docker-Content-Digest")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *noDigestWriter) Write(b []byte) (int, error) {
+	w.Header().Del("Docker-Content-Digest")
+	return w.ResponseWriter.Write(b)
+}
+
 // Host returns the host:port of the mock registry
 func (mr *MockRegistry) Host() string {
 	return mr.Server.Listener.Addr().String()